@@ -0,0 +1,477 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+)
+
+// sample er én verdi brukt til rate-of-change.
+type sample struct {
+	t time.Time
+	v float64
+}
+
+// alarm er managerens interne tilstand for én definisjon.
+type alarm struct {
+	def   config.AlarmDefinition
+	tag   *opcua.Tag
+	state Alarm
+
+	delay      time.Duration
+	rateWindow time.Duration
+	staleAfter time.Duration
+	alarmOn    bool
+
+	value      *float64
+	lastUpdate time.Time
+	history    []sample   // rate: verdier innenfor rateWindow
+	pending    *time.Time // når tilstanden først ble oppfylt (for delay)
+}
+
+// Manager evaluerer alarmdefinisjoner mot tag-oppdateringer, holder styr på
+// tilstand og kvittering, og lagrer alt i SQLite.
+type Manager struct {
+	log           zerolog.Logger
+	store         *SQLiteStore
+	checkInterval time.Duration
+
+	mu        sync.Mutex
+	alarms    map[string]*alarm
+	byNode    map[string][]*alarm
+	order     []string
+	listeners []func(Event, Alarm)
+}
+
+// NewManager bygger alarmene fra config og henter lagret tilstand.
+func NewManager(log zerolog.Logger, store *SQLiteStore, tags *opcua.TagMap, cfg config.AlarmsConfig) (*Manager, error) {
+	interval, err := time.ParseDuration(cfg.CheckInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid alarms.check_interval %q", cfg.CheckInterval)
+	}
+
+	m := &Manager{
+		log:           log,
+		store:         store,
+		checkInterval: interval,
+		alarms:        make(map[string]*alarm),
+		byNode:        make(map[string][]*alarm),
+	}
+
+	now := time.Now()
+	for _, def := range cfg.Definitions {
+		tag, ok := tags.Lookup(def.Tag)
+		if !ok {
+			return nil, fmt.Errorf("alarm %q: unknown tag %q", def.Name, def.Tag)
+		}
+
+		a := &alarm{
+			def:        def,
+			tag:        tag,
+			alarmOn:    def.AlarmOn == nil || *def.AlarmOn,
+			lastUpdate: now,
+			state: Alarm{
+				Name:      def.Name,
+				Tag:       tag.Name,
+				Type:      def.Type,
+				Severity:  def.Severity,
+				Message:   def.Message,
+				Limit:     def.Limit,
+				State:     StateCleared,
+				Acked:     true,
+				UpdatedAt: now,
+			},
+		}
+		if a.state.Message == "" {
+			a.state.Message = defaultMessage(def, tag)
+		}
+		for _, f := range []struct {
+			val string
+			dst *time.Duration
+		}{{def.Delay, &a.delay}, {def.RateWindow, &a.rateWindow}, {def.StaleAfter, &a.staleAfter}} {
+			if f.val == "" {
+				continue
+			}
+			d, err := time.ParseDuration(f.val)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("alarm %q: invalid duration %q", def.Name, f.val)
+			}
+			*f.dst = d
+		}
+
+		m.alarms[def.Name] = a
+		m.byNode[tag.NodeID] = append(m.byNode[tag.NodeID], a)
+		m.order = append(m.order, def.Name)
+	}
+
+	// Gjenopprett aktive/ukvitterte alarmer fra forrige kjøring
+	saved, err := store.ListStates()
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range saved {
+		a, ok := m.alarms[st.Name]
+		if !ok {
+			continue
+		}
+		a.state.State = st.State
+		a.state.Active = st.Active
+		a.state.Acked = st.Acked
+		a.state.Value = st.Value
+		a.state.ActivatedAt = st.ActivatedAt
+		a.state.ClearedAt = st.ClearedAt
+		a.state.AckedAt = st.AckedAt
+		a.state.AckedBy = st.AckedBy
+		a.state.ShelvedUntil = st.ShelvedUntil
+		a.state.UpdatedAt = st.UpdatedAt
+	}
+
+	return m, nil
+}
+
+// OnEvent registrerer en funksjon som kalles for hver overgang, med
+// alarmens tilstand etter overgangen.
+func (m *Manager) OnEvent(fn func(Event, Alarm)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Record evaluerer alarmene på taggen. Kalles fra dispatcheren.
+func (m *Manager) Record(u opcua.TagUpdate) {
+	m.record(u, time.Now())
+}
+
+func (m *Manager) record(u opcua.TagUpdate, now time.Time) {
+	m.mu.Lock()
+	alarms := m.byNode[u.Name]
+	if len(alarms) == 0 {
+		m.mu.Unlock()
+		return
+	}
+
+	var events []pendingEvent
+	for _, a := range alarms {
+		a.lastUpdate = now
+		if v, ok := brew.Numeric(u.Value); ok {
+			a.value = &v
+			if a.def.Type == config.AlarmRate {
+				a.history = append(a.history, sample{t: now, v: v})
+			}
+		}
+		events = append(events, m.evaluate(a, now)...)
+	}
+	m.mu.Unlock()
+
+	m.notify(events)
+}
+
+// Run sjekker forsinkelser, stale-verdier og utløpt shelving til ctx kanselleres.
+func (m *Manager) Run(ctx context.Context) {
+	m.log.Info().Int("alarms", len(m.alarms)).Msg("🚨 Alarm manager started")
+
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.check(now)
+		}
+	}
+}
+
+// check er én runde i Run.
+func (m *Manager) check(now time.Time) {
+	m.mu.Lock()
+	var events []pendingEvent
+	for _, name := range m.order {
+		a := m.alarms[name]
+		if a.state.ShelvedUntil != nil && !now.Before(*a.state.ShelvedUntil) {
+			a.state.ShelvedUntil = nil
+			events = append(events, m.transition(a, TransitionUnshelved, "", now))
+		}
+		events = append(events, m.evaluate(a, now)...)
+	}
+	m.mu.Unlock()
+	m.notify(events)
+}
+
+// evaluate må kalles med m.mu låst.
+func (m *Manager) evaluate(a *alarm, now time.Time) []pendingEvent {
+	inAlarm, known := m.condition(a, now)
+	if !known {
+		return nil
+	}
+
+	if !inAlarm {
+		a.pending = nil
+		if a.state.Active {
+			a.state.Active = false
+			a.state.ClearedAt = &now
+			return []pendingEvent{m.transition(a, TransitionCleared, "", now)}
+		}
+		return nil
+	}
+
+	if a.state.Active {
+		return nil
+	}
+	if a.pending == nil {
+		a.pending = &now
+	}
+	if now.Sub(*a.pending) < a.delay {
+		return nil
+	}
+
+	a.pending = nil
+	a.state.Active = true
+	a.state.Acked = false
+	a.state.ActivatedAt = &now
+	a.state.ClearedAt = nil
+	a.state.AckedAt = nil
+	a.state.AckedBy = ""
+	return []pendingEvent{m.transition(a, TransitionActivated, "", now)}
+}
+
+// condition avgjør om alarmtilstanden er oppfylt. Deadband gjelder når
+// alarmen allerede er aktiv, slik at den ikke flagrer rundt grensen.
+func (m *Manager) condition(a *alarm, now time.Time) (inAlarm, known bool) {
+	d := a.def
+	db := 0.0
+	if a.state.Active {
+		db = d.Deadband
+	}
+
+	if d.Type == config.AlarmStale {
+		return now.Sub(a.lastUpdate) > a.staleAfter, true
+	}
+	if a.value == nil {
+		return false, false
+	}
+	v := *a.value
+
+	switch d.Type {
+	case config.AlarmHigh, config.AlarmHighHigh:
+		return v > d.Limit-db, true
+	case config.AlarmLow, config.AlarmLowLow:
+		return v < d.Limit+db, true
+	case config.AlarmBool:
+		return (v != 0) == a.alarmOn, true
+	case config.AlarmRate:
+		rate, ok := a.rate(now)
+		if !ok {
+			return a.state.Active, true
+		}
+		return math.Abs(rate) > d.Limit-db, true
+	}
+	return false, false
+}
+
+// rate beregner endring per minutt over rateWindow.
+func (a *alarm) rate(now time.Time) (float64, bool) {
+	cutoff := now.Add(-a.rateWindow)
+	i := 0
+	for i < len(a.history)-1 && a.history[i+1].t.Before(cutoff) {
+		i++
+	}
+	a.history = a.history[i:]
+	if len(a.history) < 2 {
+		return 0, false
+	}
+
+	first, last := a.history[0], a.history[len(a.history)-1]
+	span := last.t.Sub(first.t)
+	if span <= 0 {
+		return 0, false
+	}
+	return (last.v - first.v) / span.Minutes(), true
+}
+
+// Ack kvitterer en aktiv eller ukvittert alarm.
+func (m *Manager) Ack(name, user string) (*Alarm, error) {
+	m.mu.Lock()
+	a, ok := m.alarms[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlarm, name)
+	}
+	if a.state.Acked {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %q is %s", ErrNothingToAck, name, a.state.State)
+	}
+
+	now := time.Now()
+	a.state.Acked = true
+	a.state.AckedAt = &now
+	a.state.AckedBy = user
+	ev := m.transition(a, TransitionAcked, user, now)
+	snapshot := a.state
+	m.mu.Unlock()
+
+	m.notify([]pendingEvent{ev})
+	return &snapshot, nil
+}
+
+// Shelve undertrykker varsling for alarmen i d. d = 0 fjerner shelving.
+func (m *Manager) Shelve(name string, d time.Duration, user string) (*Alarm, error) {
+	if d < 0 || d > 7*24*time.Hour {
+		return nil, fmt.Errorf("%w: %s (max 168h)", ErrInvalidShelve, d)
+	}
+
+	m.mu.Lock()
+	a, ok := m.alarms[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlarm, name)
+	}
+
+	now := time.Now()
+	transition := TransitionShelved
+	if d == 0 {
+		a.state.ShelvedUntil = nil
+		transition = TransitionUnshelved
+	} else {
+		until := now.Add(d)
+		a.state.ShelvedUntil = &until
+	}
+	ev := m.transition(a, transition, user, now)
+	snapshot := a.state
+	m.mu.Unlock()
+
+	m.notify([]pendingEvent{ev})
+	return &snapshot, nil
+}
+
+// List returnerer alle alarmer i config-rekkefølge.
+func (m *Manager) List() []Alarm {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Alarm, 0, len(m.order))
+	for _, name := range m.order {
+		out = append(out, m.alarms[name].state)
+	}
+	return out
+}
+
+// Get returnerer én alarm.
+func (m *Manager) Get(name string) (*Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.alarms[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlarm, name)
+	}
+	snapshot := a.state
+	return &snapshot, nil
+}
+
+// Events returnerer alarmhistorikk, nyeste først.
+func (m *Manager) Events(name string, since time.Time, limit int) ([]Event, error) {
+	return m.store.ListEvents(name, since, limit)
+}
+
+// pendingEvent samler en overgang til lytterne kalles etter at låsen er sluppet.
+type pendingEvent struct {
+	event Event
+	alarm Alarm
+}
+
+// transition oppdaterer tilstanden, lagrer og lager en hendelse.
+// Må kalles med m.mu låst.
+func (m *Manager) transition(a *alarm, transition, user string, now time.Time) pendingEvent {
+	a.state.State = state(a.state.Active, a.state.Acked)
+	a.state.Value = a.value
+	a.state.UpdatedAt = now
+
+	ev := Event{
+		Time:       now,
+		Name:       a.state.Name,
+		Transition: transition,
+		State:      a.state.State,
+		Severity:   a.state.Severity,
+		Value:      a.value,
+		Message:    a.state.Message,
+		User:       user,
+		Shelved:    a.state.Shelved(now),
+	}
+
+	if err := m.store.SaveState(a.state); err != nil {
+		m.log.Error().Err(err).Str("alarm", a.state.Name).Msg("❌ Failed to persist alarm state")
+	}
+	id, err := m.store.AddEvent(ev)
+	if err != nil {
+		m.log.Error().Err(err).Str("alarm", a.state.Name).Msg("❌ Failed to log alarm event")
+	}
+	ev.ID = id
+
+	logEv := m.log.Info()
+	if transition == TransitionActivated && !ev.Shelved {
+		logEv = m.log.Warn()
+	}
+	logEv.
+		Str("alarm", ev.Name).
+		Str("transition", transition).
+		Str("state", ev.State).
+		Str("severity", ev.Severity).
+		Msg("🚨 Alarm " + transition)
+
+	return pendingEvent{event: ev, alarm: a.state}
+}
+
+func (m *Manager) notify(events []pendingEvent) {
+	if len(events) == 0 {
+		return
+	}
+	m.mu.Lock()
+	listeners := m.listeners
+	m.mu.Unlock()
+
+	for _, pe := range events {
+		for _, fn := range listeners {
+			fn(pe.event, pe.alarm)
+		}
+	}
+}
+
+// Active returnerer alarmer som ikke er i normal tilstand, mest alvorlige først.
+func (m *Manager) Active() []Alarm {
+	all := m.List()
+	out := all[:0]
+	for _, a := range all {
+		if a.State != StateCleared {
+			out = append(out, a)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return config.SeverityRank(out[i].Severity) > config.SeverityRank(out[j].Severity)
+	})
+	return out
+}
+
+func defaultMessage(def config.AlarmDefinition, tag *opcua.Tag) string {
+	switch def.Type {
+	case config.AlarmHigh, config.AlarmHighHigh:
+		return fmt.Sprintf("%s over %g%s", tag.Name, def.Limit, tag.Unit)
+	case config.AlarmLow, config.AlarmLowLow:
+		return fmt.Sprintf("%s under %g%s", tag.Name, def.Limit, tag.Unit)
+	case config.AlarmRate:
+		return fmt.Sprintf("%s endrer seg mer enn %g%s/min", tag.Name, def.Limit, tag.Unit)
+	case config.AlarmStale:
+		return fmt.Sprintf("%s har ikke oppdatert seg på %s", tag.Name, def.StaleAfter)
+	default:
+		return fmt.Sprintf("%s i alarmtilstand", tag.Name)
+	}
+}
@@ -0,0 +1,373 @@
+package alarm
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+)
+
+const (
+	glycolNode = "ns=4;s=glycolTemp"
+	pumpNode   = "ns=4;s=glycolPump"
+)
+
+// newTestManager lager en manager med alarmtilstanden lagret i path.
+func newTestManager(t *testing.T, path string, defs ...config.AlarmDefinition) *Manager {
+	t.Helper()
+	tags, err := opcua.NewTagMap([]config.TagConfig{
+		{Name: "glycolTemp", NodeID: glycolNode, DataType: "real", Unit: "°C", SamplingInterval: "1s"},
+		{Name: "glycolPump", NodeID: pumpNode, DataType: "bool", SamplingInterval: "1s"},
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	for i := range defs {
+		if defs[i].Severity == "" {
+			defs[i].Severity = config.SeverityWarning
+		}
+	}
+	m, err := NewManager(zerolog.Nop(), store, tags, config.AlarmsConfig{CheckInterval: "1s", Definitions: defs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func tempManager(t *testing.T, defs ...config.AlarmDefinition) *Manager {
+	t.Helper()
+	return newTestManager(t, filepath.Join(t.TempDir(), "alarms.db"), defs...)
+}
+
+// transitions samler overgangene manageren sender til lyttere.
+func transitions(m *Manager) *[]Event {
+	var out []Event
+	m.OnEvent(func(ev Event, _ Alarm) { out = append(out, ev) })
+	return &out
+}
+
+func get(t *testing.T, m *Manager, name string) Alarm {
+	t.Helper()
+	a, err := m.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *a
+}
+
+func TestCondition(t *testing.T) {
+	type step struct {
+		v      float64
+		active bool
+	}
+	off := false
+	tests := []struct {
+		name  string
+		def   config.AlarmDefinition
+		node  string
+		steps []step
+	}{
+		{
+			name: "high with deadband",
+			def:  config.AlarmDefinition{Tag: "glycolTemp", Type: config.AlarmHigh, Limit: 80, Deadband: 2},
+			node: glycolNode,
+			steps: []step{
+				{79, false}, {80, false}, {81, true},
+				{79, true}, // innenfor deadband
+				{78.5, true},
+				{77.9, false},
+				{79.5, false}, // deadband gjelder bare når alarmen er aktiv
+				{80.5, true},
+			},
+		},
+		{
+			name: "low with deadband",
+			def:  config.AlarmDefinition{Tag: "glycolTemp", Type: config.AlarmLowLow, Limit: -5, Deadband: 1},
+			node: glycolNode,
+			steps: []step{
+				{-4, false}, {-5.5, true}, {-4.5, true}, {-3.9, false}, {-4.5, false},
+			},
+		},
+		{
+			name:  "high without deadband",
+			def:   config.AlarmDefinition{Tag: "glycolTemp", Type: config.AlarmHighHigh, Limit: 10},
+			node:  glycolNode,
+			steps: []step{{10.1, true}, {9.9, false}, {10.1, true}},
+		},
+		{
+			name:  "bool",
+			def:   config.AlarmDefinition{Tag: "glycolPump", Type: config.AlarmBool},
+			node:  pumpNode,
+			steps: []step{{0, false}, {1, true}, {0, false}},
+		},
+		{
+			name:  "bool alarm on false",
+			def:   config.AlarmDefinition{Tag: "glycolPump", Type: config.AlarmBool, AlarmOn: &off},
+			node:  pumpNode,
+			steps: []step{{1, false}, {0, true}, {1, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.def.Name = "a"
+			m := tempManager(t, tt.def)
+			now := time.Now()
+			for i, s := range tt.steps {
+				now = now.Add(time.Second)
+				m.record(opcua.TagUpdate{Name: tt.node, Value: s.v}, now)
+				if got := get(t, m, "a").Active; got != s.active {
+					t.Fatalf("step %d: value %g active = %v, want %v", i, s.v, got, s.active)
+				}
+			}
+		})
+	}
+}
+
+func TestBoolValues(t *testing.T) {
+	m := tempManager(t, config.AlarmDefinition{Name: "pump", Tag: "glycolPump", Type: config.AlarmBool})
+	m.record(opcua.TagUpdate{Name: pumpNode, Value: true}, time.Now())
+	if !get(t, m, "pump").Active {
+		t.Error("bool true should activate the alarm")
+	}
+	// Verdier som ikke er tall endrer ikke tilstanden
+	m.record(opcua.TagUpdate{Name: pumpNode, Value: "off"}, time.Now())
+	if !get(t, m, "pump").Active {
+		t.Error("a non-numeric value must not clear the alarm")
+	}
+}
+
+func TestDelay(t *testing.T) {
+	m := tempManager(t, config.AlarmDefinition{Name: "a", Tag: "glycolTemp", Type: config.AlarmHigh, Limit: 80, Delay: "30s"})
+	t0 := time.Now()
+	record := func(v float64, after time.Duration) {
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: v}, t0.Add(after))
+	}
+
+	for _, tt := range []struct {
+		name   string
+		do     func()
+		active bool
+	}{
+		{"over limit", func() { record(81, 0) }, false},
+		{"still waiting", func() { record(82, 10*time.Second) }, false},
+		{"back to normal resets delay", func() { record(79, 20*time.Second) }, false},
+		{"over limit again", func() { record(81, 25*time.Second) }, false},
+		{"delay not yet passed", func() { m.check(t0.Add(54 * time.Second)) }, false},
+		{"delay passed", func() { m.check(t0.Add(55 * time.Second)) }, true},
+	} {
+		tt.do()
+		if got := get(t, m, "a").Active; got != tt.active {
+			t.Fatalf("%s: active = %v, want %v", tt.name, got, tt.active)
+		}
+	}
+}
+
+func TestRateWindow(t *testing.T) {
+	m := tempManager(t, config.AlarmDefinition{Name: "a", Tag: "glycolTemp", Type: config.AlarmRate, Limit: 1, RateWindow: "2m"})
+	t0 := time.Now()
+	a := m.alarms["a"]
+
+	for _, tt := range []struct {
+		after   time.Duration
+		v       float64
+		active  bool
+		history int
+	}{
+		{0, 10, false, 1},               // for få verdier
+		{time.Minute, 11, false, 2},     // 1 °C/min er ikke over grensen
+		{2 * time.Minute, 13, true, 3},  // (13-10)/2 min
+		{4 * time.Minute, 13, false, 3}, // t0 faller ut: (13-11)/3 min
+		{7 * time.Minute, 13, false, 2}, // bare siste verdi før vinduet beholdes
+	} {
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: tt.v}, t0.Add(tt.after))
+		if got := get(t, m, "a").Active; got != tt.active {
+			t.Fatalf("after %s: active = %v, want %v", tt.after, got, tt.active)
+		}
+		if len(a.history) != tt.history {
+			t.Fatalf("after %s: %d samples kept, want %d", tt.after, len(a.history), tt.history)
+		}
+	}
+}
+
+func TestStale(t *testing.T) {
+	m := tempManager(t, config.AlarmDefinition{Name: "a", Tag: "glycolTemp", Type: config.AlarmStale, StaleAfter: "5m"})
+	t0 := time.Now()
+
+	m.check(t0.Add(4 * time.Minute))
+	if get(t, m, "a").Active {
+		t.Fatal("alarm active before stale_after")
+	}
+	m.check(t0.Add(6 * time.Minute))
+	if !get(t, m, "a").Active {
+		t.Fatal("alarm not active after stale_after without updates")
+	}
+	m.record(opcua.TagUpdate{Name: glycolNode, Value: 4.0}, t0.Add(7*time.Minute))
+	if get(t, m, "a").Active {
+		t.Error("a new value should clear the stale alarm")
+	}
+	m.check(t0.Add(11 * time.Minute))
+	if get(t, m, "a").Active {
+		t.Error("stale_after counts from the last update")
+	}
+}
+
+func TestAckAndClear(t *testing.T) {
+	def := config.AlarmDefinition{Name: "a", Tag: "glycolTemp", Type: config.AlarmHigh, Limit: 80}
+
+	t.Run("ack then clear", func(t *testing.T) {
+		m := tempManager(t, def)
+		events := transitions(m)
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: 81.0}, time.Now())
+		if a := get(t, m, "a"); a.State != StateActive || a.Acked {
+			t.Fatalf("after activation: %s acked=%v, want active and unacked", a.State, a.Acked)
+		}
+		a, err := m.Ack("a", "alice")
+		if err != nil || a.State != StateAcked || a.AckedBy != "alice" {
+			t.Fatalf("Ack = %+v, %v; want acked by alice", a, err)
+		}
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: 79.0}, time.Now())
+		if a := get(t, m, "a"); a.State != StateCleared {
+			t.Errorf("acked alarm back to normal = %s, want cleared", a.State)
+		}
+		wantTransitions(t, *events, TransitionActivated, TransitionAcked, TransitionCleared)
+	})
+
+	t.Run("clear then ack", func(t *testing.T) {
+		m := tempManager(t, def)
+		events := transitions(m)
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: 81.0}, time.Now())
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: 79.0}, time.Now())
+		if a := get(t, m, "a"); a.State != StateUnacked || a.Active {
+			t.Fatalf("unacked alarm back to normal = %s active=%v, want unacked", a.State, a.Active)
+		}
+		if a, err := m.Ack("a", "bob"); err != nil || a.State != StateCleared {
+			t.Fatalf("Ack = %+v, %v; want cleared", a, err)
+		}
+		if _, err := m.Ack("a", "bob"); !errors.Is(err, ErrNothingToAck) {
+			t.Errorf("second Ack = %v, want ErrNothingToAck", err)
+		}
+		wantTransitions(t, *events, TransitionActivated, TransitionCleared, TransitionAcked)
+	})
+
+	t.Run("reactivation needs a new ack", func(t *testing.T) {
+		m := tempManager(t, def)
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: 81.0}, time.Now())
+		if _, err := m.Ack("a", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: 79.0}, time.Now())
+		m.record(opcua.TagUpdate{Name: glycolNode, Value: 82.0}, time.Now())
+		if a := get(t, m, "a"); a.State != StateActive || a.AckedBy != "" || a.AckedAt != nil {
+			t.Errorf("reactivated alarm = %+v, want active without the old ack", a)
+		}
+	})
+
+	m := tempManager(t, def)
+	if _, err := m.Ack("missing", "alice"); !errors.Is(err, ErrUnknownAlarm) {
+		t.Errorf("Ack of unknown alarm = %v, want ErrUnknownAlarm", err)
+	}
+}
+
+func wantTransitions(t *testing.T, events []Event, want ...string) {
+	t.Helper()
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v, want transitions %v", events, want)
+	}
+	for i := range want {
+		if events[i].Transition != want[i] {
+			t.Fatalf("event %d = %s, want %s (all: %+v)", i, events[i].Transition, want[i], events)
+		}
+	}
+}
+
+func TestShelveExpiry(t *testing.T) {
+	m := tempManager(t, config.AlarmDefinition{Name: "a", Tag: "glycolTemp", Type: config.AlarmHigh, Limit: 80})
+	events := transitions(m)
+
+	for _, d := range []time.Duration{-time.Minute, 8 * 24 * time.Hour} {
+		if _, err := m.Shelve("a", d, "alice"); !errors.Is(err, ErrInvalidShelve) {
+			t.Errorf("Shelve(%s) = %v, want ErrInvalidShelve", d, err)
+		}
+	}
+
+	a, err := m.Shelve("a", time.Hour, "alice")
+	if err != nil || a.ShelvedUntil == nil {
+		t.Fatalf("Shelve = %+v, %v", a, err)
+	}
+	until := *a.ShelvedUntil
+
+	m.record(opcua.TagUpdate{Name: glycolNode, Value: 81.0}, until.Add(-30*time.Minute))
+	if last := (*events)[len(*events)-1]; last.Transition != TransitionActivated || !last.Shelved {
+		t.Fatalf("activation while shelved = %+v, want a shelved activation", last)
+	}
+
+	m.check(until.Add(-time.Second))
+	if get(t, m, "a").ShelvedUntil == nil {
+		t.Fatal("shelving expired early")
+	}
+	m.check(until)
+	if get(t, m, "a").ShelvedUntil != nil {
+		t.Fatal("shelving did not expire")
+	}
+	wantTransitions(t, *events, TransitionShelved, TransitionActivated, TransitionUnshelved)
+	if last := (*events)[2]; last.User != "" || last.Shelved {
+		t.Errorf("unshelve event = %+v, want a system event that is not shelved", last)
+	}
+
+	// Shelve 0 fjerner shelving med en gang
+	if _, err := m.Shelve("a", time.Hour, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := m.Shelve("a", 0, "alice"); err != nil || a.ShelvedUntil != nil {
+		t.Errorf("Shelve(0) = %+v, %v; want unshelved", a, err)
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alarms.db")
+	high := config.AlarmDefinition{Name: "high", Tag: "glycolTemp", Type: config.AlarmHigh, Limit: 80}
+	pump := config.AlarmDefinition{Name: "pump", Tag: "glycolPump", Type: config.AlarmBool}
+
+	m := newTestManager(t, path, high, pump)
+	m.record(opcua.TagUpdate{Name: glycolNode, Value: 81.0}, time.Now())
+	if _, err := m.Shelve("high", time.Hour, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	m.record(opcua.TagUpdate{Name: pumpNode, Value: true}, time.Now())
+	if _, err := m.Ack("pump", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ny prosess: "pump" er fjernet fra config, "high" hentes fra databasen
+	m = newTestManager(t, path, high)
+	a := get(t, m, "high")
+	if !a.Active || a.Acked || a.State != StateActive || a.ShelvedUntil == nil || a.ActivatedAt == nil {
+		t.Fatalf("restored alarm = %+v, want active, unacked and shelved", a)
+	}
+	if a.Value == nil || *a.Value != 81 {
+		t.Errorf("restored value = %v, want 81", a.Value)
+	}
+	if len(m.List()) != 1 {
+		t.Errorf("List = %+v, want only configured alarms", m.List())
+	}
+
+	// Den gjenopprettede alarmen går tilbake som vanlig
+	m.record(opcua.TagUpdate{Name: glycolNode, Value: 70.0}, time.Now())
+	if a := get(t, m, "high"); a.State != StateUnacked {
+		t.Errorf("restored alarm back to normal = %s, want unacked", a.State)
+	}
+	evs, err := m.Events("high", time.Time{}, 10)
+	if err != nil || len(evs) != 3 || evs[0].Transition != TransitionCleared {
+		t.Errorf("events = %+v, %v; want activated, shelved and cleared, newest first", evs, err)
+	}
+}
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS alarm_states (
+    name TEXT PRIMARY KEY,
+    state TEXT NOT NULL,
+    active INTEGER NOT NULL,
+    acked INTEGER NOT NULL,
+    value REAL,
+    activated_at DATETIME,
+    cleared_at DATETIME,
+    acked_at DATETIME,
+    acked_by TEXT NOT NULL DEFAULT '',
+    shelved_until DATETIME,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS alarm_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ts DATETIME NOT NULL,
+    name TEXT NOT NULL,
+    transition TEXT NOT NULL,
+    state TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    value REAL,
+    message TEXT NOT NULL DEFAULT '',
+    user TEXT NOT NULL DEFAULT '',
+    shelved INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_alarm_events_ts ON alarm_events(ts);
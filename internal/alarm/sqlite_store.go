@@ -0,0 +1,106 @@
+package alarm
+
+import (
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/migrate"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteStore struct {
+	DB *sqlx.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	s := &SQLiteStore{DB: db}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close releases the database connection.
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations er skjemaendringene for alarms.db, i rekkefølge.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations")
+
+func (s *SQLiteStore) migrate() error {
+	_, err := migrate.Up(s.DB, Migrations)
+	return err
+}
+
+// SaveState lagrer (upsert) tilstanden til én alarm.
+func (s *SQLiteStore) SaveState(a Alarm) error {
+	_, err := s.DB.NamedExec(`
+INSERT INTO alarm_states
+(name, state, active, acked, value, activated_at, cleared_at, acked_at, acked_by, shelved_until, updated_at)
+VALUES (:name, :state, :active, :acked, :value, :activated_at, :cleared_at, :acked_at, :acked_by, :shelved_until, :updated_at)
+ON CONFLICT(name) DO UPDATE SET
+    state = excluded.state,
+    active = excluded.active,
+    acked = excluded.acked,
+    value = excluded.value,
+    activated_at = excluded.activated_at,
+    cleared_at = excluded.cleared_at,
+    acked_at = excluded.acked_at,
+    acked_by = excluded.acked_by,
+    shelved_until = excluded.shelved_until,
+    updated_at = excluded.updated_at`, a)
+	if err != nil {
+		return fmt.Errorf("save alarm state: %w", err)
+	}
+	return nil
+}
+
+// ListStates henter alle lagrede alarmtilstander.
+func (s *SQLiteStore) ListStates() ([]Alarm, error) {
+	rows := []Alarm{}
+	err := s.DB.Select(&rows, `
+SELECT name, state, active, acked, value, activated_at, cleared_at, acked_at, acked_by, shelved_until, updated_at
+FROM alarm_states`)
+	if err != nil {
+		return nil, fmt.Errorf("list alarm states: %w", err)
+	}
+	return rows, nil
+}
+
+// AddEvent logger én overgang.
+func (s *SQLiteStore) AddEvent(ev Event) (int64, error) {
+	res, err := s.DB.NamedExec(`
+INSERT INTO alarm_events (ts, name, transition, state, severity, value, message, user, shelved)
+VALUES (:ts, :name, :transition, :state, :severity, :value, :message, :user, :shelved)`, ev)
+	if err != nil {
+		return 0, fmt.Errorf("insert alarm event: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// ListEvents henter de nyeste overgangene, eventuelt for én alarm og etter since.
+func (s *SQLiteStore) ListEvents(name string, since time.Time, limit int) ([]Event, error) {
+	rows := []Event{}
+	err := s.DB.Select(&rows, `
+SELECT id, ts, name, transition, state, severity, value, message, user, shelved
+FROM alarm_events
+WHERE (? = '' OR name = ?) AND ts >= ?
+ORDER BY id DESC
+LIMIT ?`, name, name, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list alarm events: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,85 @@
+package alarm
+
+import (
+	"errors"
+	"time"
+)
+
+// Alarmtilstander.
+const (
+	StateCleared = "cleared" // normal og kvittert
+	StateActive  = "active"  // aktiv, ikke kvittert
+	StateAcked   = "acked"   // aktiv, kvittert
+	StateUnacked = "unacked" // gått tilbake til normal, ikke kvittert
+)
+
+// Overganger som logges og sendes til lyttere.
+const (
+	TransitionActivated = "activated"
+	TransitionCleared   = "cleared"
+	TransitionAcked     = "acked"
+	TransitionShelved   = "shelved"
+	TransitionUnshelved = "unshelved"
+)
+
+// Feil fra Ack/Shelve.
+var (
+	ErrUnknownAlarm  = errors.New("unknown alarm")
+	ErrNothingToAck  = errors.New("alarm has nothing to acknowledge")
+	ErrInvalidShelve = errors.New("invalid shelve duration")
+)
+
+// Alarm er tilstanden til én alarmdefinisjon.
+type Alarm struct {
+	Name     string  `db:"name" json:"name"`
+	Tag      string  `db:"-" json:"tag"`
+	Type     string  `db:"-" json:"type"`
+	Severity string  `db:"-" json:"severity"`
+	Message  string  `db:"-" json:"message"`
+	Limit    float64 `db:"-" json:"limit"`
+
+	State  string   `db:"state" json:"state"`
+	Active bool     `db:"active" json:"active"`
+	Acked  bool     `db:"acked" json:"acked"`
+	Value  *float64 `db:"value" json:"value"`
+
+	ActivatedAt  *time.Time `db:"activated_at" json:"activated_at"`
+	ClearedAt    *time.Time `db:"cleared_at" json:"cleared_at"`
+	AckedAt      *time.Time `db:"acked_at" json:"acked_at"`
+	AckedBy      string     `db:"acked_by" json:"acked_by,omitempty"`
+	ShelvedUntil *time.Time `db:"shelved_until" json:"shelved_until"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// Shelved reports whether the alarm is shelved at t.
+func (a Alarm) Shelved(t time.Time) bool {
+	return a.ShelvedUntil != nil && t.Before(*a.ShelvedUntil)
+}
+
+// Event er én overgang for en alarm.
+type Event struct {
+	ID         int64     `db:"id" json:"id"`
+	Time       time.Time `db:"ts" json:"time"`
+	Name       string    `db:"name" json:"name"`
+	Transition string    `db:"transition" json:"transition"`
+	State      string    `db:"state" json:"state"`
+	Severity   string    `db:"severity" json:"severity"`
+	Value      *float64  `db:"value" json:"value"`
+	Message    string    `db:"message" json:"message"`
+	User       string    `db:"user" json:"user,omitempty"`
+	Shelved    bool      `db:"shelved" json:"shelved"`
+}
+
+// state utleder tilstanden fra active/acked.
+func state(active, acked bool) string {
+	switch {
+	case active && !acked:
+		return StateActive
+	case active:
+		return StateAcked
+	case !acked:
+		return StateUnacked
+	default:
+		return StateCleared
+	}
+}
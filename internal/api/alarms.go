@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/alarm"
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// WSAlarmMessage is pushed on the stream for every alarm transition.
+type WSAlarmMessage struct {
+	Type      string       `json:"type"` // always "alarm"
+	Event     *alarm.Event `json:"event,omitempty"`
+	Alarm     alarm.Alarm  `json:"alarm"`
+	Timestamp int64        `json:"ts_ms"`
+}
+
+// AlarmActionRequest is the optional body for ack/shelve/unshelve.
+// User is ignored when authentication is enabled.
+type AlarmActionRequest struct {
+	User     string `json:"user"`
+	Duration string `json:"duration"` // kun shelve, f.eks. "1h"
+}
+
+// WithAlarms enables /api/alarms and pushes alarm transitions on the WS stream.
+func WithAlarms(m *alarm.Manager) Option {
+	return func(s *Server) {
+		s.alarms = m
+	}
+}
+
+func (s *Server) alarmRoutes(r chi.Router) {
+	r.Get("/", s.handleAlarms)
+	r.Get("/events", s.handleAlarmEvents)
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.require(auth.RoleOperator))
+		r.Post("/{name}/ack", s.handleAlarmAck)
+		r.Post("/{name}/shelve", s.handleAlarmShelve)
+		r.Post("/{name}/unshelve", s.handleAlarmUnshelve)
+	})
+}
+
+// handleAlarms serves GET /api/alarms[?state=active|acked|unacked|cleared|alarm].
+// state=alarm returnerer alt som ikke er normalt.
+func (s *Server) handleAlarms(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("state")
+	if filter == "alarm" {
+		writeJSON(w, http.StatusOK, s.alarms.Active())
+		return
+	}
+
+	out := []alarm.Alarm{}
+	for _, a := range s.alarms.List() {
+		if filter == "" || a.State == filter {
+			out = append(out, a)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAlarmEvents serves GET /api/alarms/events?name=&since=&limit=.
+func (s *Server) handleAlarmEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since (RFC3339)", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "invalid limit (1-1000)", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events, err := s.alarms.Events(q.Get("name"), since, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (s *Server) handleAlarmAck(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeAlarmAction(w, r)
+	if !ok {
+		return
+	}
+	name := chi.URLParam(r, "name")
+	before, _ := s.alarms.Get(name)
+	a, err := s.alarms.Ack(name, req.User)
+	s.recordAlarm(r, req, audit.ActionAlarmAck, name, before, a, err)
+	writeAlarmResult(w, a, err)
+}
+
+func (s *Server) handleAlarmShelve(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeAlarmAction(w, r)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil || d <= 0 {
+		http.Error(w, "duration must be a positive Go duration, e.g. \"1h\"", http.StatusBadRequest)
+		return
+	}
+	name := chi.URLParam(r, "name")
+	before, _ := s.alarms.Get(name)
+	a, err := s.alarms.Shelve(name, d, req.User)
+	s.recordAlarm(r, req, audit.ActionAlarmShelve, name, before, a, err)
+	writeAlarmResult(w, a, err)
+}
+
+func (s *Server) handleAlarmUnshelve(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeAlarmAction(w, r)
+	if !ok {
+		return
+	}
+	name := chi.URLParam(r, "name")
+	before, _ := s.alarms.Get(name)
+	a, err := s.alarms.Shelve(name, 0, req.User)
+	s.recordAlarm(r, req, audit.ActionAlarmUnshelve, name, before, a, err)
+	writeAlarmResult(w, a, err)
+}
+
+// decodeAlarmAction leser en valgfri JSON-body.
+func decodeAlarmAction(w http.ResponseWriter, r *http.Request) (AlarmActionRequest, bool) {
+	var req AlarmActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return req, false
+	}
+	req.User = actor(r, req.User)
+	return req, true
+}
+
+// recordAlarm logger handlingen med brukeren fra requesten (også når auth er av).
+func (s *Server) recordAlarm(r *http.Request, req AlarmActionRequest, action, name string, before, after *alarm.Alarm, err error) {
+	if errors.Is(err, alarm.ErrUnknownAlarm) || errors.Is(err, alarm.ErrNothingToAck) || errors.Is(err, alarm.ErrInvalidShelve) {
+		err = audit.Rejected(err)
+	}
+	ctx := audit.WithActor(r.Context(), audit.Actor{User: req.User, Source: audit.SourceAPI})
+	s.audit.Record(ctx, action, name, alarmState(before), alarmState(after), err)
+}
+
+// alarmState er det som endres av ack/shelve.
+func alarmState(a *alarm.Alarm) interface{} {
+	if a == nil {
+		return nil
+	}
+	return struct {
+		State        string     `json:"state"`
+		Acked        bool       `json:"acked"`
+		ShelvedUntil *time.Time `json:"shelved_until,omitempty"`
+	}{a.State, a.Acked, a.ShelvedUntil}
+}
+
+func writeAlarmResult(w http.ResponseWriter, a *alarm.Alarm, err error) {
+	switch {
+	case errors.Is(err, alarm.ErrUnknownAlarm):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, alarm.ErrNothingToAck):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, alarm.ErrInvalidShelve):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, a)
+	}
+}
+
+// PublishAlarm pushes an alarm transition to all WS clients.
+func (s *Server) PublishAlarm(ev alarm.Event, a alarm.Alarm) {
+	s.broadcast(alarmMessage(&ev, a))
+}
+
+func alarmMessage(ev *alarm.Event, a alarm.Alarm) WSAlarmMessage {
+	return WSAlarmMessage{Type: "alarm", Event: ev, Alarm: a, Timestamp: time.Now().UnixMilli()}
+}
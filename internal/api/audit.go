@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+)
+
+// WithAudit records control actions and enables GET /api/audit.
+func WithAudit(l *audit.Log) Option {
+	return func(s *Server) {
+		s.audit = l
+	}
+}
+
+// handleAudit serves GET /api/audit?user=&source=&action=&target=&status=&since=&until=&limit=.
+// action kan slutte på "*" for prefikssøk, f.eks. action=fermentation.*.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		User:   q.Get("user"),
+		Source: q.Get("source"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Status: q.Get("status"),
+		Limit:  100,
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid "+p.name+" (RFC3339)", http.StatusBadRequest)
+			return
+		}
+		*p.dst = t
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "invalid limit (1-1000)", http.StatusBadRequest)
+			return
+		}
+		f.Limit = n
+	}
+
+	entries, err := s.audit.Query(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,372 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+const sessionCookie = "gotov_session"
+
+// LoginRequest is the body of POST /api/auth/login.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResponse returns the session token for clients that don't use cookies.
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      auth.User `json:"user"`
+}
+
+// UserRequest creates or updates a user (admin only).
+type UserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// PasswordRequest changes the caller's own password.
+type PasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// TokenRequest creates an API token. TTL is a Go duration; empty means no expiry.
+type TokenRequest struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	TTL      string `json:"ttl"`
+}
+
+// TokenResponse includes the plaintext token, shown only once.
+type TokenResponse struct {
+	auth.Token
+	Secret string `json:"token"`
+}
+
+// WithAuth requires login for the API. Without it every request is allowed.
+func WithAuth(svc *auth.Service, publicMetrics bool) Option {
+	return func(s *Server) {
+		s.auth = svc
+		s.publicMetrics = publicMetrics
+	}
+}
+
+// WithAllowedOrigins sets which cross-origin browser clients may use the
+// API and the WS stream. Same-host requests are always allowed.
+func WithAllowedOrigins(origins []string) Option {
+	return func(s *Server) {
+		s.allowedOrigins = origins
+	}
+}
+
+// originAllowed brukes både av CORS og WS CheckOrigin.
+func (s *Server) originAllowed(r *http.Request, origin string) bool {
+	if origin == "" {
+		return true // ikke en nettleser
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range s.allowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate setter brukeren i context når requesten har gyldig sesjon/token.
+// Requests uten legitimasjon slipper videre; require avgjør om de får svar.
+// Et ugyldig token (sesjonen slettet etter passordbytte, DB nullstilt) behandles
+// som anonymt, så /api/auth/login fortsatt virker; en utløpt cookie slettes.
+// Brukeren legges også inn som aktør for audit-loggen.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if token := requestToken(r); s.auth != nil && token != "" {
+			u, err := s.auth.Authenticate(token)
+			switch {
+			case err == nil:
+				ctx = auth.WithUser(ctx, u)
+			case !errors.Is(err, auth.ErrUnauthenticated):
+				s.log.Error().Err(err).Msg("❌ Authentication lookup failed")
+			default:
+				if c, cerr := r.Cookie(sessionCookie); cerr == nil && c.Value == token {
+					clearSessionCookie(w)
+				}
+			}
+		}
+
+		r = r.WithContext(ctx)
+		ctx = audit.WithActor(ctx, audit.Actor{User: actor(r, ""), Source: audit.SourceAPI})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// require avviser requests uten minst den gitte rollen.
+func (s *Server) require(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.auth == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			u := auth.UserFromContext(r.Context())
+			if u == nil {
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !auth.Allows(u.Role, role) {
+				http.Error(w, "requires role "+role, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestToken henter token fra Authorization-header, cookie eller – for
+// WebSocket, der nettlesere ikke kan sette headere – ?access_token=.
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return c.Value
+	}
+	if websocketUpgrade(r) {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+func websocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// actor er brukernavnet til den innloggede brukeren, eller fallback.
+func actor(r *http.Request, fallback string) string {
+	if u := auth.UserFromContext(r.Context()); u != nil {
+		return u.Username
+	}
+	return fallback
+}
+
+func (s *Server) authRoutes(r chi.Router) {
+	r.Post("/login", s.handleLogin)
+	r.Post("/logout", s.handleLogout)
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.require(auth.RoleViewer))
+		r.Get("/me", s.handleMe)
+		r.Post("/password", s.handlePassword)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.require(auth.RoleAdmin))
+		r.Get("/users", s.handleUsers)
+		r.Post("/users", s.handleUserCreate)
+		r.Put("/users/{username}", s.handleUserUpdate)
+		r.Delete("/users/{username}", s.handleUserDelete)
+		r.Get("/tokens", s.handleTokens)
+		r.Post("/tokens", s.handleTokenCreate)
+		r.Delete("/tokens/{id}", s.handleTokenRevoke)
+	})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	token, u, expires, err := s.auth.Login(req.Username, req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		s.log.Warn().Str("user", req.Username).Str("remote", r.RemoteAddr).Msg("🔐 Login failed")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	s.log.Info().Str("user", u.Username).Str("role", u.Role).Msg("🔐 User logged in")
+	writeJSON(w, http.StatusOK, LoginResponse{Token: token, ExpiresAt: expires, User: *u})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if token := requestToken(r); token != "" {
+		if err := s.auth.Logout(token); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	clearSessionCookie(w)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "logged out"})
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.UserFromContext(r.Context()))
+}
+
+func (s *Server) handlePassword(w http.ResponseWriter, r *http.Request) {
+	var req PasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	err := s.auth.ChangePassword(actor(r, ""), req.OldPassword, req.NewPassword)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "password changed"})
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, _ *http.Request) {
+	users, err := s.auth.ListUsers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) handleUserCreate(w http.ResponseWriter, r *http.Request) {
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	u, err := s.auth.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	s.log.Info().Str("user", u.Username).Str("role", u.Role).Str("by", actor(r, "")).Msg("👤 User created")
+	writeJSON(w, http.StatusCreated, u)
+}
+
+func (s *Server) handleUserUpdate(w http.ResponseWriter, r *http.Request) {
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	u, err := s.auth.UpdateUser(chi.URLParam(r, "username"), req.Password, req.Role)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	s.log.Info().Str("user", u.Username).Str("role", u.Role).Str("by", actor(r, "")).Msg("👤 User updated")
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) handleUserDelete(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	if username == actor(r, "") {
+		http.Error(w, "cannot delete yourself", http.StatusBadRequest)
+		return
+	}
+	if err := s.auth.DeleteUser(username); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	s.log.Info().Str("user", username).Str("by", actor(r, "")).Msg("👤 User deleted")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (s *Server) handleTokens(w http.ResponseWriter, _ *http.Request) {
+	tokens, err := s.auth.ListTokens()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func (s *Server) handleTokenCreate(w http.ResponseWriter, r *http.Request) {
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if req.Username == "" {
+		req.Username = actor(r, "")
+	}
+
+	secret, t, err := s.auth.CreateToken(req.Name, req.Username, ttl)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	s.log.Info().Str("token", t.Name).Str("user", t.Username).Str("by", actor(r, "")).Msg("🔑 API token created")
+	writeJSON(w, http.StatusCreated, TokenResponse{Token: *t, Secret: secret})
+}
+
+func (s *Server) handleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+	if err := s.auth.RevokeToken(id); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	s.log.Info().Int64("token_id", id).Str("by", actor(r, "")).Msg("🔑 API token revoked")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrUnknownUser), errors.Is(err, auth.ErrUnknownToken):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, auth.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, auth.ErrInvalidRole), errors.Is(err, auth.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
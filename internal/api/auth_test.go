@@ -0,0 +1,241 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/rs/zerolog"
+)
+
+// newAuthServer lager en server med innlogging og én bruker per rolle.
+// Passordet er brukernavnet + "-password".
+func newAuthServer(t *testing.T) (*Server, *auth.Service) {
+	t.Helper()
+	store, err := auth.NewSQLiteStore(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	svc := auth.NewService(store, time.Hour)
+	for _, role := range []string{auth.RoleViewer, auth.RoleOperator, auth.RoleAdmin} {
+		if _, err := svc.CreateUser(role, role+"-password", role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, _ := newTestClient(t)
+	return NewServer(zerolog.Nop(), client, WithAuth(svc, false)), svc
+}
+
+func login(t *testing.T, svc *auth.Service, username string) string {
+	t.Helper()
+	token, _, _, err := svc.Login(username, username+"-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequire(t *testing.T) {
+	s, _ := newAuthServer(t)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		user *auth.User
+		need string
+		want int
+	}{
+		{nil, auth.RoleViewer, http.StatusUnauthorized},
+		{nil, auth.RoleAdmin, http.StatusUnauthorized},
+		{&auth.User{Username: "v", Role: auth.RoleViewer}, auth.RoleViewer, http.StatusOK},
+		{&auth.User{Username: "v", Role: auth.RoleViewer}, auth.RoleOperator, http.StatusForbidden},
+		{&auth.User{Username: "o", Role: auth.RoleOperator}, auth.RoleOperator, http.StatusOK},
+		{&auth.User{Username: "o", Role: auth.RoleOperator}, auth.RoleAdmin, http.StatusForbidden},
+		{&auth.User{Username: "a", Role: auth.RoleAdmin}, auth.RoleOperator, http.StatusOK},
+		{&auth.User{Username: "x", Role: "root"}, auth.RoleViewer, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.user != nil {
+			req = req.WithContext(auth.WithUser(req.Context(), tt.user))
+		}
+		rec := httptest.NewRecorder()
+		s.require(tt.need)(ok).ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("user %+v needing %s = %d, want %d", tt.user, tt.need, rec.Code, tt.want)
+		}
+	}
+
+	// Uten innlogging slipper alt gjennom
+	rec := httptest.NewRecorder()
+	newTestServer(t).require(auth.RoleAdmin)(ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("require without auth = %d, want 200", rec.Code)
+	}
+}
+
+func TestRouterRoles(t *testing.T) {
+	s, svc := newAuthServer(t)
+	router := s.Router()
+	apiToken, _, err := svc.CreateToken("ci", auth.RoleOperator, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := map[string]string{
+		"":                 "",
+		auth.RoleViewer:    login(t, svc, auth.RoleViewer),
+		auth.RoleOperator:  login(t, svc, auth.RoleOperator),
+		auth.RoleAdmin:     login(t, svc, auth.RoleAdmin),
+		"operator via api": apiToken,
+	}
+
+	tests := []struct {
+		method, path, who string
+		want              int
+	}{
+		{http.MethodGet, "/api/version", "", http.StatusOK},
+		{http.MethodGet, "/api/auth/me", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/auth/me", auth.RoleViewer, http.StatusOK},
+		{http.MethodGet, "/api/tags", "", http.StatusUnauthorized},
+		{http.MethodGet, "/metrics", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/write", auth.RoleViewer, http.StatusForbidden},
+		{http.MethodPost, "/api/write", auth.RoleOperator, http.StatusBadRequest}, // sluppet inn, tom body
+		{http.MethodPost, "/api/write", "operator via api", http.StatusBadRequest},
+		{http.MethodGet, "/api/auth/users", auth.RoleOperator, http.StatusForbidden},
+		{http.MethodGet, "/api/auth/users", auth.RoleAdmin, http.StatusOK},
+		{http.MethodGet, "/api/auth/tokens", "operator via api", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if token := tokens[tt.who]; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s as %q = %d %s, want %d", tt.method, tt.path, tt.who, rec.Code, strings.TrimSpace(rec.Body.String()), tt.want)
+		}
+	}
+}
+
+// sessionCleared sier om svaret sletter sesjonscookien.
+func sessionCleared(rec *httptest.ResponseRecorder) bool {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie && c.MaxAge < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Etter passordbytte er sesjonen slettet. Den gamle cookien skal behandles som
+// anonym, slettes, og ikke stoppe en ny innlogging.
+func TestStaleSessionIsAnonymous(t *testing.T) {
+	s, svc := newAuthServer(t)
+	router := s.Router()
+	stale := login(t, svc, auth.RoleOperator)
+	if err := svc.ChangePassword(auth.RoleOperator, "operator-password", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: stale})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !sessionCleared(rec) {
+		t.Errorf("GET /api/auth/me with stale cookie = %d, cleared %v; want 401 and the cookie cleared", rec.Code, sessionCleared(rec))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/login",
+		strings.NewReader(`{"username":"operator","password":"new-password"}`))
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: stale})
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login with stale cookie = %d %s, want 200", rec.Code, rec.Body)
+	}
+	var fresh string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie && c.MaxAge >= 0 {
+			fresh = c.Value
+		}
+	}
+	if fresh == "" || fresh == stale {
+		t.Errorf("login set cookie %q, want a new session", fresh)
+	}
+
+	// Et ugyldig Bearer-token rører ikke en gyldig cookie
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+stale)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: fresh})
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || sessionCleared(rec) {
+		t.Errorf("stale bearer token = %d, cleared %v; want 401 with the cookie kept", rec.Code, sessionCleared(rec))
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		query  string
+		ws     bool
+		want   string
+	}{
+		{"bearer", "Bearer abc", "", "", false, "abc"},
+		{"bearer wins over cookie", "Bearer abc", "def", "", false, "abc"},
+		{"other scheme falls back to cookie", "Basic xyz", "def", "", false, "def"},
+		{"cookie", "", "def", "", false, "def"},
+		{"query only for websocket", "", "", "ghi", false, ""},
+		{"websocket query", "", "", "ghi", true, "ghi"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/stream/tags?access_token="+tt.query, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.cookie})
+		}
+		if tt.ws {
+			req.Header.Set("Upgrade", "websocket")
+		}
+		if got := requestToken(req); got != tt.want {
+			t.Errorf("%s: requestToken = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	s := &Server{allowedOrigins: []string{"https://brew.example.com"}}
+	open := &Server{allowedOrigins: []string{"*"}}
+
+	tests := []struct {
+		s      *Server
+		origin string
+		want   bool
+	}{
+		{s, "", true},                               // ikke en nettleser
+		{s, "http://gotov.local:8080", true},        // samme vert
+		{s, "http://GOTOV.local:8080", true},        // vertsnavn er ikke store/små-sensitive
+		{s, "http://gotov.local:9090", false},       // annen port
+		{s, "https://brew.example.com", true},       // tillatt
+		{s, "https://Brew.Example.com", true},       // tillatt, uansett store/små
+		{s, "https://evil.example.com", false},      // ikke tillatt
+		{s, "https://brew.example.com.evil", false}, // må matche hele origin
+		{open, "https://evil.example.com", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://gotov.local:8080/api/tags", nil)
+		if got := tt.s.originAllowed(req, tt.origin); got != tt.want {
+			t.Errorf("originAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MrBoggi/goTOV/internal/brewfather"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/go-chi/chi/v5"
+)
+
+// BatchResponse is a Brewfather batch with the fermentation plan goTØV would import.
+type BatchResponse struct {
+	*brewfather.BrewfatherBatch
+	Plan      *fermentation.FermentationPlan `json:"plan"`
+	PlanError string                         `json:"plan_error,omitempty"`
+}
+
+// RecipeResponse is a Brewfather recipe with its parsed fermentation plan.
+type RecipeResponse struct {
+	*brewfather.BrewfatherRecipe
+	Plan      *fermentation.FermentationPlan `json:"plan"`
+	PlanError string                         `json:"plan_error,omitempty"`
+}
+
+// brewfatherRoutes proxies Brewfather so credentials never leave the server.
+func (s *Server) brewfatherRoutes(r chi.Router) {
+	r.Get("/batches", s.handleBrewfatherBatches)
+	r.Get("/batch/{id}", s.handleBrewfatherBatch)
+	r.Get("/recipes", s.handleBrewfatherRecipes)
+	r.Get("/recipe/{id}", s.handleBrewfatherRecipe)
+}
+
+func (s *Server) handleBrewfatherBatches(w http.ResponseWriter, _ *http.Request) {
+	batches, err := s.brewfather.FetchBatches()
+	if err != nil {
+		s.brewfatherError(w, err, "batches")
+		return
+	}
+	writeJSON(w, http.StatusOK, batches)
+}
+
+func (s *Server) handleBrewfatherBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := s.brewfather.FetchBatch(chi.URLParam(r, "id"))
+	if err != nil {
+		s.brewfatherError(w, err, "batch")
+		return
+	}
+
+	resp := BatchResponse{BrewfatherBatch: batch}
+	if plan, err := brewfather.ExtractFermentationPlanFromBatch(batch, s.log); err != nil {
+		resp.PlanError = err.Error()
+	} else {
+		resp.Plan = plan
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleBrewfatherRecipes(w http.ResponseWriter, _ *http.Request) {
+	list, err := s.brewfather.ListRecipes()
+	if err != nil {
+		s.brewfatherError(w, err, "recipes")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleBrewfatherRecipe(w http.ResponseWriter, r *http.Request) {
+	recipe, err := s.brewfather.FetchRecipe(chi.URLParam(r, "id"))
+	if err != nil {
+		s.brewfatherError(w, err, "recipe")
+		return
+	}
+
+	resp := RecipeResponse{BrewfatherRecipe: recipe}
+	if plan, err := brewfather.ExtractFermentationPlanFromRecipe(recipe, s.log); err != nil {
+		resp.PlanError = err.Error()
+	} else {
+		resp.Plan = plan
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// brewfatherError logger hele feilen (med Brewfathers svar) og gir klienten
+// bare statusen, så detaljer fra upstream ikke lekker ut.
+func (s *Server) brewfatherError(w http.ResponseWriter, err error, what string) {
+	s.log.Error().Err(err).Str("request", what).Msg("❌ Brewfather request failed")
+
+	msg := "Brewfather request failed"
+	var se *brewfather.StatusError
+	if errors.As(err, &se) {
+		msg = fmt.Sprintf("Brewfather request failed: %d %s", se.StatusCode, http.StatusText(se.StatusCode))
+	}
+	http.Error(w, msg, http.StatusBadGateway)
+}
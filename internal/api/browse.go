@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/MrBoggi/goTOV/internal/opcua"
+)
+
+// handleBrowse serves GET /api/opcua/browse?node=&depth=&filter=&variables=true.
+// Uten node startes det i Objects-mappen.
+func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := opcua.BrowseOptions{
+		Filter:    q.Get("filter"),
+		Variables: q.Get("variables") == "true",
+	}
+	if v := q.Get("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > opcua.MaxBrowseDepth {
+			http.Error(w, "invalid depth (1-"+strconv.Itoa(opcua.MaxBrowseDepth)+")", http.StatusBadRequest)
+			return
+		}
+		opts.Depth = n
+	}
+
+	nodes, err := s.client.Browse(r.Context(), q.Get("node"), opts)
+	switch {
+	case errors.Is(err, opcua.ErrInvalidNodeID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, opcua.ErrNotConnected):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		writeJSON(w, http.StatusOK, nodes)
+	}
+}
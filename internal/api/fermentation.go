@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/go-chi/chi/v5"
+)
+
+// StartRequest starts a fermentation on a tank, either from a stored plan
+// (plan_id) or from inline steps which are saved as a new plan first.
+type StartRequest struct {
+	PlanID    int64                           `json:"plan_id"`
+	BatchID   string                          `json:"batch_id"`
+	Name      string                          `json:"name"`
+	TankNo    int                             `json:"tank_no"`
+	StartStep int                             `json:"start_step"`
+	Steps     []fermentation.FermentationStep `json:"steps"`
+
+	// OriginalGravity er valgfri; uten den blir første måling OG.
+	OriginalGravity *float64 `json:"original_gravity"`
+}
+
+// JumpRequest selects a step by 0-based index.
+type JumpRequest struct {
+	StepIndex int `json:"step_index"`
+}
+
+// GravityRequest records a hydrometer reading. Time defaults to now.
+type GravityRequest struct {
+	Gravity float64    `json:"gravity"`
+	Time    *time.Time `json:"time"`
+}
+
+func (s *Server) fermentationRoutes(r chi.Router) {
+	r.Get("/active", s.handleFermentationActive)
+	r.With(s.require(auth.RoleOperator)).Post("/start", s.handleFermentationStart)
+
+	r.Route("/{tank}", func(r chi.Router) {
+		r.Get("/gravity", s.handleFermentationGravity)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.require(auth.RoleOperator))
+			r.Post("/pause", s.handleFermentationPause)
+			r.Post("/resume", s.handleFermentationResume)
+			r.Post("/skip", s.handleFermentationSkip)
+			r.Post("/step", s.handleFermentationJump)
+			r.Post("/abort", s.handleFermentationAbort)
+			r.Post("/gravity", s.handleFermentationGravityRecord)
+		})
+	})
+}
+
+func (s *Server) handleFermentationActive(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.engine.Active())
+}
+
+func (s *Server) handleFermentationStart(w http.ResponseWriter, r *http.Request) {
+	var req StartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.TankNo <= 0 {
+		http.Error(w, "tank_no is required", http.StatusBadRequest)
+		return
+	}
+	if req.OriginalGravity != nil {
+		if err := fermentation.ValidateGravity(*req.OriginalGravity); err != nil {
+			writeEngineError(w, err)
+			return
+		}
+	}
+
+	planID := req.PlanID
+	var inline *fermentation.FermentationPlan
+	if planID == 0 {
+		if len(req.Steps) == 0 {
+			http.Error(w, "plan_id or steps is required", http.StatusBadRequest)
+			return
+		}
+		if req.StartStep < 0 || req.StartStep >= len(req.Steps) {
+			writeEngineError(w, fmt.Errorf("%w: %d", fermentation.ErrInvalidStep, req.StartStep))
+			return
+		}
+
+		name := req.Name
+		if name == "" {
+			name = req.BatchID
+		}
+		plan := fermentation.FermentationPlan{
+			Name:     name,
+			RecipeID: req.BatchID,
+			Steps:    req.Steps,
+		}
+		plan.Renumber()
+		err := fermentation.ValidatePlan(plan)
+		if err == nil {
+			plan.ID, err = s.store.SavePlan(plan)
+		}
+		s.audit.Record(r.Context(), audit.ActionPlanCreate, planTarget(plan.ID), nil, plan, engineAuditError(err))
+		if err != nil {
+			writeEngineError(w, err)
+			return
+		}
+		planID = plan.ID
+		inline = &plan
+	}
+
+	s.log.Info().
+		Int64("plan_id", planID).
+		Int("tank", req.TankNo).
+		Str("batch_id", req.BatchID).
+		Msg("🍺 Fermentation start requested")
+
+	status, err := s.engine.Start(planID, req.TankNo, req.BatchID, req.StartStep, req.OriginalGravity)
+	var started interface{} = req
+	if status != nil {
+		started = status
+	}
+	s.audit.Record(r.Context(), audit.ActionFermentationStart, tankTarget(req.TankNo), nil, started, engineAuditError(err))
+	if err != nil {
+		// Planen ble laget bare for denne starten; ikke la den ligge igjen
+		if inline != nil {
+			derr := s.store.DeletePlan(inline.ID)
+			s.audit.Record(r.Context(), audit.ActionPlanDelete, planTarget(inline.ID), inline, nil, derr)
+			if derr != nil {
+				s.log.Error().Err(derr).Int64("plan_id", inline.ID).Msg("❌ Could not remove plan for failed start")
+			}
+		}
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (s *Server) handleFermentationPause(w http.ResponseWriter, r *http.Request) {
+	s.withTank(w, r, audit.ActionFermentationPause, func(tank int) (*fermentation.RunStatus, error) {
+		return s.engine.Pause(tank)
+	})
+}
+
+func (s *Server) handleFermentationResume(w http.ResponseWriter, r *http.Request) {
+	s.withTank(w, r, audit.ActionFermentationResume, func(tank int) (*fermentation.RunStatus, error) {
+		return s.engine.Resume(tank)
+	})
+}
+
+func (s *Server) handleFermentationSkip(w http.ResponseWriter, r *http.Request) {
+	s.withTank(w, r, audit.ActionFermentationSkip, func(tank int) (*fermentation.RunStatus, error) {
+		ctx, cancel := engineContext(r)
+		defer cancel()
+		return s.engine.Skip(ctx, tank)
+	})
+}
+
+func (s *Server) handleFermentationJump(w http.ResponseWriter, r *http.Request) {
+	var req JumpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	s.withTank(w, r, audit.ActionFermentationStep, func(tank int) (*fermentation.RunStatus, error) {
+		ctx, cancel := engineContext(r)
+		defer cancel()
+		return s.engine.JumpTo(ctx, tank, req.StepIndex)
+	})
+}
+
+func (s *Server) handleFermentationAbort(w http.ResponseWriter, r *http.Request) {
+	tank, err := tankParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	before := s.runStatus(tank)
+	ctx, cancel := engineContext(r)
+	err = s.engine.Abort(ctx, tank)
+	cancel()
+	s.audit.Record(r.Context(), audit.ActionFermentationAbort, tankTarget(tank), before, nil, engineAuditError(err))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "aborted"})
+}
+
+func (s *Server) handleFermentationGravity(w http.ResponseWriter, r *http.Request) {
+	tank, err := tankParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	readings, err := s.engine.Gravity(tank)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, readings)
+}
+
+func (s *Server) handleFermentationGravityRecord(w http.ResponseWriter, r *http.Request) {
+	var req GravityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	at := time.Now()
+	if req.Time != nil {
+		at = *req.Time
+	}
+	s.withTank(w, r, audit.ActionFermentationGravity, func(tank int) (*fermentation.RunStatus, error) {
+		return s.engine.RecordGravity(tank, req.Gravity, at, fermentation.GravitySourceAPI)
+	})
+}
+
+// engineContext is the context for the engine's PLC writes. It is not
+// cancelled when the client disconnects, so a command is never left half
+// written, but it keeps the actor from the request for the audit log.
+func engineContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(r.Context()), fermentation.PLCTimeout)
+}
+
+// withTank parses {tank}, runs fn, records the action in the audit log and
+// writes the resulting run status.
+func (s *Server) withTank(w http.ResponseWriter, r *http.Request, action string, fn func(tank int) (*fermentation.RunStatus, error)) {
+	tank, err := tankParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	before := s.runStatus(tank)
+	status, err := fn(tank)
+	var after interface{}
+	if status != nil {
+		after = status
+	}
+	s.audit.Record(r.Context(), action, tankTarget(tank), before, after, engineAuditError(err))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// runStatus returnerer status for gjæringen på tanken, eller nil.
+func (s *Server) runStatus(tank int) interface{} {
+	for _, st := range s.engine.Active() {
+		if st.TankNo == tank {
+			return st
+		}
+	}
+	return nil
+}
+
+func tankTarget(tank int) string {
+	return "tank " + strconv.Itoa(tank)
+}
+
+func planTarget(id int64) string {
+	return "plan " + strconv.FormatInt(id, 10)
+}
+
+func tankParam(r *http.Request) (int, error) {
+	tank, err := strconv.Atoi(chi.URLParam(r, "tank"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid tank number %q", chi.URLParam(r, "tank"))
+	}
+	return tank, nil
+}
+
+// writeEngineError maps engine errors to HTTP status codes.
+func writeEngineError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), engineErrorStatus(err))
+}
+
+func engineErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, fermentation.ErrNotActive),
+		errors.Is(err, fermentation.ErrPlanNotFound),
+		errors.Is(err, fermentation.ErrUnknownTank):
+		return http.StatusNotFound
+	case errors.Is(err, fermentation.ErrTankBusy),
+		errors.Is(err, fermentation.ErrInvalidState),
+		errors.Is(err, fermentation.ErrPlanInUse),
+		errors.Is(err, fermentation.ErrPlanChanged):
+		return http.StatusConflict
+	case errors.Is(err, fermentation.ErrInvalidStep),
+		errors.Is(err, fermentation.ErrInvalidPlan),
+		errors.Is(err, fermentation.ErrInvalidGravity):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// engineAuditError markerer 4xx-feil som avvist i audit-loggen.
+func engineAuditError(err error) error {
+	if err != nil && engineErrorStatus(err) < http.StatusInternalServerError {
+		return audit.Rejected(err)
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+)
+
+// ctxPLC husker konteksten motoren skrev med.
+type ctxPLC struct {
+	mu       sync.Mutex
+	writes   int
+	err      error
+	deadline bool
+	actor    audit.Actor
+}
+
+func (p *ctxPLC) ReadNodeValue(context.Context, string) (interface{}, error) {
+	return 25.0, nil
+}
+
+func (p *ctxPLC) WriteNodeValues(ctx context.Context, writes []opcua.NodeWrite) ([]error, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writes++
+	p.err = ctx.Err()
+	_, p.deadline = ctx.Deadline()
+	p.actor = audit.ActorFromContext(ctx)
+	return make([]error, len(writes)), nil
+}
+
+// En klient som kobler fra midt i et kall skal ikke avbryte motorens skriving.
+func TestEngineCommandsOutliveRequest(t *testing.T) {
+	plc := &ctxPLC{}
+	s, store := newFermentationServer(t, plc)
+	plan := fermentation.FermentationPlan{Name: "Ale", Steps: []fermentation.FermentationStep{
+		{Temperature: 30, DurationHours: 24},
+		{Temperature: 18, DurationHours: 24},
+	}}
+	plan.Renumber()
+	id, err := store.SavePlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.engine.Start(id, 1, "b1", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	router := s.Router()
+
+	// Tanken holder 25 °C: hvert kall bytter mellom kjøling og varme
+	for _, tt := range []struct{ path, body string }{
+		{"/api/fermentation/1/skip", ""},
+		{"/api/fermentation/1/step", `{"step_index":0}`},
+		{"/api/fermentation/1/abort", ""},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		before := plc.writes
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", tt.path, rec.Code, rec.Body)
+		}
+		plc.mu.Lock()
+		if plc.writes == before {
+			t.Errorf("POST %s did not write the outputs", tt.path)
+		}
+		if plc.err != nil || !plc.deadline {
+			t.Errorf("POST %s wrote with ctx err %v, deadline %v; want a live context with timeout", tt.path, plc.err, plc.deadline)
+		}
+		if plc.actor.Source != audit.SourceAPI {
+			t.Errorf("POST %s wrote as %+v, want the API actor", tt.path, plc.actor)
+		}
+		plc.mu.Unlock()
+	}
+}
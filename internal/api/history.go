@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/historian"
+)
+
+const (
+	// Standardvindu og antall punkter når from/to/step ikke er oppgitt.
+	defaultHistoryWindow  = 24 * time.Hour
+	defaultHistoryBuckets = 300
+	maxHistoryBuckets     = 10000
+)
+
+// HistoryResponse is returned by GET /api/history.
+type HistoryResponse struct {
+	Tag     string             `json:"tag"`
+	From    time.Time          `json:"from"`
+	To      time.Time          `json:"to"`
+	Step    string             `json:"step"`
+	Buckets []historian.Bucket `json:"buckets"`
+}
+
+// handleHistory serves GET /api/history?tag=&from=&to=&step=.
+// from/to are RFC3339 (default the last 24h), step is a Go duration.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tag := q.Get("tag")
+	if tag == "" {
+		http.Error(w, "tag is required", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid to %q (RFC3339)", v), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultHistoryWindow)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid from %q (RFC3339)", v), http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	step := to.Sub(from) / defaultHistoryBuckets
+	if v := q.Get("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid step %q", v), http.StatusBadRequest)
+			return
+		}
+		step = d
+	}
+	step = max(step.Truncate(time.Second), time.Second)
+	if to.Sub(from)/step > maxHistoryBuckets {
+		http.Error(w, fmt.Sprintf("too many buckets (max %d), use a larger step", maxHistoryBuckets), http.StatusBadRequest)
+		return
+	}
+
+	name, buckets, err := s.historian.Query(tag, from, to, step)
+	if err != nil {
+		if errors.Is(err, historian.ErrUnknownTag) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HistoryResponse{
+		Tag:     name,
+		From:    from,
+		To:      to,
+		Step:    step.String(),
+		Buckets: buckets,
+	})
+}
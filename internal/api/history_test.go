@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/historian"
+	"github.com/rs/zerolog"
+)
+
+func TestHistoryParameters(t *testing.T) {
+	client, tags := newTestClient(t)
+	store, err := historian.NewSQLiteStore(filepath.Join(t.TempDir(), "historian.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	h, err := historian.New(zerolog.Nop(), store, tags, config.HistorianConfig{FlushInterval: "1s", Heartbeat: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Insert([]historian.Sample{{Tag: "hltTemp", Time: to.Add(-30 * time.Minute), Value: 65}}); err != nil {
+		t.Fatal(err)
+	}
+	router := NewServer(zerolog.Nop(), client, WithHistorian(h)).Router()
+
+	window := "&from=2026-05-01T11:00:00Z&to=2026-05-01T12:00:00Z"
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		step  string
+	}{
+		{"missing tag", "", http.StatusBadRequest, ""},
+		{"invalid to", "tag=hltTemp&to=yesterday", http.StatusBadRequest, ""},
+		{"invalid from", "tag=hltTemp&from=2026-05-01", http.StatusBadRequest, ""},
+		{"from after to", "tag=hltTemp&from=2026-05-01T13:00:00Z&to=2026-05-01T12:00:00Z", http.StatusBadRequest, ""},
+		{"from equals to", "tag=hltTemp&from=2026-05-01T12:00:00Z&to=2026-05-01T12:00:00Z", http.StatusBadRequest, ""},
+		{"invalid step", "tag=hltTemp&step=often" + window, http.StatusBadRequest, ""},
+		{"negative step", "tag=hltTemp&step=-1m" + window, http.StatusBadRequest, ""},
+		{"too many buckets", "tag=hltTemp&from=2026-04-01T12:00:00Z&to=2026-05-01T12:00:00Z&step=1m", http.StatusBadRequest, ""},
+		{"unknown tag", "tag=nope" + window, http.StatusNotFound, ""},
+		{"default step", "tag=hltTemp" + window, http.StatusOK, "12s"},
+		{"step rounded to seconds", "tag=hltTemp&step=1500ms" + window, http.StatusOK, "1s"},
+		{"step at least one second", "tag=hltTemp&step=10ms" + window, http.StatusOK, "1s"},
+		{"explicit step", "tag=ns%3D4%3Bs%3DMAIN.fbUA.hltTemp&step=1h" + window, http.StatusOK, "1h0m0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+tt.query, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("GET ?%s = %d %s, want %d", tt.query, rec.Code, rec.Body, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp HistoryResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Tag != "hltTemp" || resp.Step != tt.step || len(resp.Buckets) != 1 || resp.Buckets[0].Avg != 65 {
+				t.Errorf("response = %+v, want hltTemp with step %s and one bucket", resp, tt.step)
+			}
+		})
+	}
+}
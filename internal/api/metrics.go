@@ -0,0 +1,36 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/metrics"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+)
+
+// observeTag updates the tag gauge; non-numeric values are skipped.
+func observeTag(ev opcua.TagUpdate) {
+	v, ok := brew.ToFloat(ev.Value)
+	if b, isBool := ev.Value.(bool); isBool {
+		v, ok = metrics.Bool(b), true
+	}
+	if !ok {
+		return
+	}
+	metrics.TagValue.WithLabelValues(ev.DisplayName, ev.Unit, ev.Role).Set(v)
+}
+
+// observeTank updates the per-tank gauges.
+func observeTank(t brew.Tank) {
+	no := strconv.Itoa(t.No)
+	if t.Temperature != nil {
+		metrics.TankTemperature.WithLabelValues(no, t.Name).Set(*t.Temperature)
+	}
+	if t.Setpoint != nil {
+		metrics.TankSetpoint.WithLabelValues(no, t.Name).Set(*t.Setpoint)
+	} else {
+		metrics.TankSetpoint.DeleteLabelValues(no, t.Name)
+	}
+	metrics.TankOutput.WithLabelValues(no, t.Name, "cooling").Set(metrics.Bool(t.CoolingOn))
+	metrics.TankOutput.WithLabelValues(no, t.Name, "heating").Set(metrics.Bool(t.HeaterOn))
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/go-chi/chi/v5"
+)
+
+// PlanRequest creates a plan, or updates one with PUT. Fields left out of a
+// PUT keep their stored value; steps replace all steps when given. With
+// version set, the PUT is rejected with 409 if the plan has changed since.
+type PlanRequest struct {
+	Name     *string                         `json:"name"`
+	RecipeID *string                         `json:"recipe_id"`
+	Steps    []fermentation.FermentationStep `json:"steps"`
+	Version  *int                            `json:"version"`
+}
+
+// StepRequest inserts a step (POST, at 1-based position, default last) or
+// edits one (PUT, fields left out are kept).
+type StepRequest struct {
+	Position      int      `json:"position"`
+	Temperature   *float64 `json:"temperature"`
+	DurationHours *float64 `json:"duration_hours"`
+	RampHours     *float64 `json:"ramp_hours"`
+	Description   *string  `json:"description"`
+	Type          *string  `json:"type"`
+
+	GravityBelow       *float64 `json:"gravity_below"`
+	AttenuationAbove   *float64 `json:"attenuation_above"`
+	GravityStable      *float64 `json:"gravity_stable"`
+	GravityStableHours *float64 `json:"gravity_stable_hours"`
+}
+
+// MoveStepRequest moves a step to a new 1-based position.
+type MoveStepRequest struct {
+	To int `json:"to"`
+}
+
+// DuplicateRequest names the copy; default is "<name> (kopi)".
+type DuplicateRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) planRoutes(r chi.Router) {
+	r.Get("/", s.handlePlans)
+	r.With(s.require(auth.RoleOperator)).Post("/", s.handlePlanCreate)
+
+	r.Route("/{id}", func(r chi.Router) {
+		r.Get("/", s.handlePlan)
+		r.Get("/steps", s.handlePlanSteps)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.require(auth.RoleOperator))
+			r.Put("/", s.handlePlanUpdate)
+			r.Delete("/", s.handlePlanDelete)
+			r.Post("/duplicate", s.handlePlanDuplicate)
+			r.Post("/steps", s.handleStepInsert)
+			r.Put("/steps/{n}", s.handleStepUpdate)
+			r.Delete("/steps/{n}", s.handleStepDelete)
+			r.Post("/steps/{n}/move", s.handleStepMove)
+		})
+	})
+}
+
+func (s *Server) handlePlans(w http.ResponseWriter, _ *http.Request) {
+	plans, err := s.store.ListPlans()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, plans)
+}
+
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+func (s *Server) handlePlanSteps(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, plan.Steps)
+}
+
+func (s *Server) handlePlanCreate(w http.ResponseWriter, r *http.Request) {
+	var req PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	plan := fermentation.FermentationPlan{Steps: req.Steps}
+	if req.Name != nil {
+		plan.Name = *req.Name
+	}
+	if req.RecipeID != nil {
+		plan.RecipeID = *req.RecipeID
+	}
+	s.createPlan(w, r, plan)
+}
+
+func (s *Server) handlePlanDuplicate(w http.ResponseWriter, r *http.Request) {
+	var req DuplicateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	plan, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+
+	cp := plan.Copy()
+	cp.ID = 0
+	cp.RecipeID, cp.Source = "", "" // kopien hører ikke lenger til Brewfather-oppskriften
+	cp.Name = req.Name
+	if cp.Name == "" {
+		cp.Name = plan.Name + " (kopi)"
+	}
+	s.createPlan(w, r, cp)
+}
+
+// createPlan validerer, lagrer og returnerer en ny plan.
+func (s *Server) createPlan(w http.ResponseWriter, r *http.Request, plan fermentation.FermentationPlan) {
+	plan.Renumber()
+	err := fermentation.ValidatePlan(plan)
+	if err == nil {
+		plan.ID, err = s.store.SavePlan(plan)
+		plan.Version = 1
+	}
+	s.audit.Record(r.Context(), audit.ActionPlanCreate, planTarget(plan.ID), nil, plan, engineAuditError(err))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, plan)
+}
+
+func (s *Server) handlePlanUpdate(w http.ResponseWriter, r *http.Request) {
+	var req PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	s.editPlan(w, r, func(p *fermentation.FermentationPlan) error {
+		if req.Name != nil {
+			p.Name = *req.Name
+		}
+		if req.RecipeID != nil {
+			p.RecipeID = *req.RecipeID
+		}
+		if req.Steps != nil {
+			p.Steps = req.Steps
+			p.Renumber()
+		}
+		if req.Version != nil {
+			p.Version = *req.Version
+		}
+		return nil
+	})
+}
+
+func (s *Server) handlePlanDelete(w http.ResponseWriter, r *http.Request) {
+	plan, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+	err := s.store.DeletePlan(plan.ID)
+	s.audit.Record(r.Context(), audit.ActionPlanDelete, planTarget(plan.ID), plan, nil, engineAuditError(err))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (s *Server) handleStepInsert(w http.ResponseWriter, r *http.Request) {
+	var req StepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Temperature == nil || req.DurationHours == nil {
+		http.Error(w, "temperature and duration_hours are required", http.StatusBadRequest)
+		return
+	}
+	s.editPlan(w, r, func(p *fermentation.FermentationPlan) error {
+		return p.InsertStep(req.Position, req.apply(fermentation.FermentationStep{}))
+	})
+}
+
+func (s *Server) handleStepUpdate(w http.ResponseWriter, r *http.Request) {
+	n, err := stepParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req StepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	s.editPlan(w, r, func(p *fermentation.FermentationPlan) error {
+		if n < 1 || n > len(p.Steps) {
+			return fmt.Errorf("%w: %d (plan has %d steps)", fermentation.ErrInvalidStep, n, len(p.Steps))
+		}
+		if err := p.ReplaceStep(n, req.apply(p.Steps[n-1])); err != nil {
+			return err
+		}
+		if req.Position != 0 && req.Position != n {
+			return p.MoveStep(n, req.Position)
+		}
+		return nil
+	})
+}
+
+func (s *Server) handleStepDelete(w http.ResponseWriter, r *http.Request) {
+	n, err := stepParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.editPlan(w, r, func(p *fermentation.FermentationPlan) error {
+		return p.DeleteStep(n)
+	})
+}
+
+func (s *Server) handleStepMove(w http.ResponseWriter, r *http.Request) {
+	n, err := stepParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req MoveStepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	s.editPlan(w, r, func(p *fermentation.FermentationPlan) error {
+		return p.MoveStep(n, req.To)
+	})
+}
+
+// editPlan laster planen i {id}, kjører fn på en kopi, validerer og lagrer.
+// Endringen logges i audit-loggen med planen før og etter, og aktive
+// gjæringer på planen får den nye versjonen med en gang.
+func (s *Server) editPlan(w http.ResponseWriter, r *http.Request, fn func(*fermentation.FermentationPlan) error) {
+	before, ok := s.loadPlan(w, r)
+	if !ok {
+		return
+	}
+	after := before.Copy()
+
+	err := fn(&after)
+	if err == nil {
+		err = fermentation.ValidatePlan(after)
+	}
+	if err == nil {
+		var version int
+		if version, err = s.store.UpdatePlan(after); err == nil {
+			after.Version = version
+		}
+	}
+	s.audit.Record(r.Context(), audit.ActionPlanUpdate, planTarget(before.ID), before, after, engineAuditError(err))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	if s.engine != nil {
+		s.engine.ReloadPlan(after.ID)
+	}
+	writeJSON(w, http.StatusOK, after)
+}
+
+// loadPlan henter planen i {id} og skriver feilen selv hvis det ikke går.
+func (s *Server) loadPlan(w http.ResponseWriter, r *http.Request) (*fermentation.FermentationPlan, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid plan id %q", chi.URLParam(r, "id")), http.StatusBadRequest)
+		return nil, false
+	}
+	plan, err := s.store.GetPlan(id)
+	if err != nil {
+		writeEngineError(w, err)
+		return nil, false
+	}
+	return plan, true
+}
+
+// apply fyller inn feltene som er satt i forespørselen.
+func (req StepRequest) apply(step fermentation.FermentationStep) fermentation.FermentationStep {
+	if req.Temperature != nil {
+		step.Temperature = *req.Temperature
+	}
+	if req.DurationHours != nil {
+		step.DurationHours = *req.DurationHours
+	}
+	if req.RampHours != nil {
+		step.RampHours = *req.RampHours
+	}
+	if req.Description != nil {
+		step.Description = *req.Description
+	}
+	if req.Type != nil {
+		step.Type = *req.Type
+	}
+	if req.GravityBelow != nil {
+		step.GravityBelow = *req.GravityBelow
+	}
+	if req.AttenuationAbove != nil {
+		step.AttenuationAbove = *req.AttenuationAbove
+	}
+	if req.GravityStable != nil {
+		step.GravityStable = *req.GravityStable
+	}
+	if req.GravityStableHours != nil {
+		step.GravityStableHours = *req.GravityStableHours
+	}
+	return step
+}
+
+func stepParam(r *http.Request) (int, error) {
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid step number %q", chi.URLParam(r, "n"))
+	}
+	return n, nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/MrBoggi/goTOV/internal/opcua"
+)
+
+// ReadRequest reads several tags (name, symbol or node ID) in one OPC UA request.
+type ReadRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// handleRead serves POST /api/read. Each result has its own status, so one
+// bad node does not fail the whole request.
+func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
+	var req ReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Tags) == 0 {
+		http.Error(w, "tags is required", http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.client.ReadTags(r.Context(), req.Tags)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, opcua.ErrNotConnected) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
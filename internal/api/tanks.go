@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/go-chi/chi/v5"
+)
+
+// TankResponse is a tank with its active fermentation, if any.
+type TankResponse struct {
+	brew.Tank
+	Fermentation *fermentation.RunStatus `json:"fermentation"`
+}
+
+func (s *Server) handleTanks(w http.ResponseWriter, _ *http.Request) {
+	tanks := s.tanks.List()
+	out := make([]TankResponse, 0, len(tanks))
+	for _, t := range tanks {
+		out = append(out, s.tankResponse(t))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleTank(w http.ResponseWriter, r *http.Request) {
+	no, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid tank id", http.StatusBadRequest)
+		return
+	}
+	t, ok := s.tanks.Get(no)
+	if !ok {
+		http.Error(w, "tank not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.tankResponse(t))
+}
+
+func (s *Server) tankResponse(t brew.Tank) TankResponse {
+	resp := TankResponse{Tank: t}
+	if s.engine == nil {
+		return resp
+	}
+	for _, run := range s.engine.Active() {
+		if run.TankNo == t.No {
+			resp.Fermentation = &run
+			break
+		}
+	}
+	return resp
+}
@@ -2,39 +2,103 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
-	"strings"
+
+	"github.com/MrBoggi/goTOV/internal/opcua"
 )
 
+// WriteRequest writes one tag, or with Writes several tags in one request.
 type WriteRequest struct {
 	Tag   string      `json:"tag"`
 	Value interface{} `json:"value"`
+
+	Writes []opcua.TagWrite `json:"writes"`
+}
+
+// WriteResponse is returned on success, with the value as it was written
+// (converted to the node's data type and possibly clamped).
+type WriteResponse struct {
+	Status string `json:"status"`
+	*opcua.WriteResult
+}
+
+// BatchWriteResponse is returned for {"writes": [...]}. Status is "ok" when
+// every value was written; if one is rejected, nothing is written.
+type BatchWriteResponse struct {
+	Status  string                   `json:"status"`
+	Results []opcua.BatchWriteResult `json:"results"`
 }
 
 func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
 	var req WriteRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
 		http.Error(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
-	// ✅ Legg til namespace automatisk om mangler
-	if !strings.HasPrefix(req.Tag, "ns=") {
-		req.Tag = fmt.Sprintf("ns=4;s=%s", req.Tag)
+	if len(req.Writes) > 0 {
+		s.handleBatchWrite(w, r, req.Writes)
+		return
+	}
+	if req.Tag == "" || req.Value == nil {
+		http.Error(w, "tag and value are required", http.StatusBadRequest)
+		return
 	}
-
 	s.log.Info().
 		Str("tag", req.Tag).
 		Interface("value", req.Value).
+		Str("user", actor(r, "")).
 		Msg("📝 Write request received")
 
-	if err := s.client.WriteNodeValue(r.Context(), req.Tag, req.Value); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// ✅ Tag-navn/symbol slås opp i tag-konfigurasjonen
+	res, err := s.client.WriteTag(r.Context(), req.Tag, req.Value)
+	if err != nil {
+		http.Error(w, err.Error(), writeErrorStatus(err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(`{"status":"ok"}`)); err != nil {
-		s.log.Error().Err(err).Msg("failed to write response")
+	writeJSON(w, http.StatusOK, WriteResponse{Status: "ok", WriteResult: res})
+}
+
+func (s *Server) handleBatchWrite(w http.ResponseWriter, r *http.Request, writes []opcua.TagWrite) {
+	for _, wr := range writes {
+		if wr.Tag == "" || wr.Value == nil {
+			http.Error(w, "tag and value are required for every write", http.StatusBadRequest)
+			return
+		}
+	}
+	s.log.Info().
+		Int("count", len(writes)).
+		Str("user", actor(r, "")).
+		Msg("📝 Batch write request received")
+
+	results, err := s.client.WriteTags(r.Context(), writes)
+	resp := BatchWriteResponse{Status: "ok", Results: results}
+	status := http.StatusOK
+	if err != nil {
+		status = writeErrorStatus(err)
+		resp.Status = "error"
+		if status < http.StatusInternalServerError {
+			resp.Status = "rejected"
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// writeErrorStatus maps WriteTag errors to HTTP status codes.
+func writeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, opcua.ErrUnknownTag):
+		return http.StatusNotFound
+	case errors.Is(err, opcua.ErrNotWritable):
+		return http.StatusForbidden
+	case errors.Is(err, opcua.ErrInvalidValue), errors.Is(err, opcua.ErrOutOfRange):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, opcua.ErrNotConnected):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
 	}
 }
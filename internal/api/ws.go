@@ -6,6 +6,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/MrBoggi/goTOV/internal/alarm"
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/brewfather"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/historian"
+	"github.com/MrBoggi/goTOV/internal/metrics"
 	"github.com/MrBoggi/goTOV/internal/opcua"
 	"github.com/MrBoggi/goTOV/internal/version"
 	"github.com/go-chi/chi/v5"
@@ -18,10 +26,37 @@ type Server struct {
 	log    zerolog.Logger
 	client *opcua.Client
 
+	// Optional fermentation engine and plan store (nil when disabled)
+	engine *fermentation.Engine
+	store  *fermentation.SQLiteStore
+
+	// Optional Brewfather client (nil when no credentials are configured)
+	brewfather *brewfather.Client
+
+	// Live tank state
+	tanks *brew.Tanks
+
+	// Optional tag history (nil when the historian is disabled)
+	historian *historian.Historian
+
+	// Optional alarm manager (nil when alarms are disabled)
+	alarms *alarm.Manager
+
+	// Optional audit log (nil = not recorded)
+	audit *audit.Log
+
+	// Optional authentication (nil = everyone may do everything)
+	auth           *auth.Service
+	publicMetrics  bool
+	allowedOrigins []string
+
 	// Connected websocket clients
 	mu          sync.RWMutex
 	subscribers map[*websocket.Conn]bool
 
+	// Serializes WS writes; updates are published from several goroutines
+	writeMu sync.Mutex
+
 	// Latest known values for REST snapshot
 	latestMu sync.RWMutex
 	latest   map[string]WSMessage
@@ -37,8 +72,54 @@ type WSMessage struct {
 	Timestamp   int64       `json:"ts_ms"`
 }
 
-// NewServer initializes the WS/HTTP server and listens for OPC UA updates
-func NewServer(log zerolog.Logger, client *opcua.Client) *Server {
+// WSConnectionMessage is pushed whenever the OPC UA connection state changes.
+type WSConnectionMessage struct {
+	Type      string                `json:"type"` // always "connection"
+	State     opcua.ConnectionState `json:"state"`
+	Timestamp int64                 `json:"ts_ms"`
+}
+
+// WSTankMessage is pushed on the stream whenever a tank's state changes.
+type WSTankMessage struct {
+	Type      string    `json:"type"` // always "tank"
+	Tank      brew.Tank `json:"tank"`
+	Timestamp int64     `json:"ts_ms"`
+}
+
+// Option configures optional parts of the Server.
+type Option func(*Server)
+
+// WithFermentation enables the /api/fermentation endpoints.
+func WithFermentation(engine *fermentation.Engine, store *fermentation.SQLiteStore) Option {
+	return func(s *Server) {
+		s.engine = engine
+		s.store = store
+	}
+}
+
+// WithBrewfather enables the /api/brewfather proxy endpoints.
+func WithBrewfather(client *brewfather.Client) Option {
+	return func(s *Server) {
+		s.brewfather = client
+	}
+}
+
+// WithTanks enables /api/tanks and pushes tank changes on the WS stream.
+func WithTanks(tanks *brew.Tanks) Option {
+	return func(s *Server) {
+		s.tanks = tanks
+	}
+}
+
+// WithHistorian enables GET /api/history.
+func WithHistorian(h *historian.Historian) Option {
+	return func(s *Server) {
+		s.historian = h
+	}
+}
+
+// NewServer initializes the WS/HTTP server. Tag updates are fed in via Publish.
+func NewServer(log zerolog.Logger, client *opcua.Client, opts ...Option) *Server {
 	s := &Server{
 		log:         log,
 		client:      client,
@@ -47,11 +128,27 @@ func NewServer(log zerolog.Logger, client *opcua.Client) *Server {
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
-			CheckOrigin:     func(r *http.Request) bool { return true },
 		},
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.upgrader.CheckOrigin = func(r *http.Request) bool {
+		return s.originAllowed(r, r.Header.Get("Origin"))
+	}
 
-	go s.consumeUpdates()
+	if s.tanks != nil {
+		s.tanks.OnChange(s.PublishTank)
+		for _, t := range s.tanks.List() {
+			observeTank(t)
+		}
+	}
+	if s.alarms != nil {
+		s.alarms.OnEvent(s.PublishAlarm)
+	}
+	client.OnStateChange(func(state opcua.ConnectionState) {
+		s.broadcast(connectionMessage(state))
+	})
 	return s
 }
 
@@ -60,17 +157,20 @@ func (s *Server) Router() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowOriginFunc:  s.originAllowed,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		AllowCredentials: false,
+		AllowCredentials: true,
 		MaxAge:           300,
 	}))
+	r.Use(s.authenticate)
 
-	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	r.Get("/healthz", s.handleHealth)
+	if s.publicMetrics {
+		r.Handle("/metrics", metrics.Handler())
+	} else {
+		r.With(s.require(auth.RoleViewer)).Handle("/metrics", metrics.Handler())
+	}
 
 	// NEW: Version endpoint ✨
 	r.Get("/api/version", func(w http.ResponseWriter, _ *http.Request) {
@@ -80,9 +180,43 @@ func (s *Server) Router() http.Handler {
 		})
 	})
 
-	r.Get("/api/stream/tags", s.handleWS)
-	r.Get("/api/tags", s.handleSnapshot)
-	r.Post("/api/write", s.handleWrite)
+	if s.auth != nil {
+		r.Route("/api/auth", s.authRoutes)
+	}
+
+	// Alt under krever innlogging; skriving krever operator
+	r.Group(func(r chi.Router) {
+		r.Use(s.require(auth.RoleViewer))
+
+		r.Get("/api/stream/tags", s.handleWS)
+		r.Get("/api/tags", s.handleSnapshot)
+		r.Post("/api/read", s.handleRead)
+		r.Get("/api/opcua/browse", s.handleBrowse)
+		r.With(s.require(auth.RoleOperator)).Post("/api/write", s.handleWrite)
+
+		if s.engine != nil {
+			r.Route("/api/fermentation", s.fermentationRoutes)
+		}
+		if s.store != nil {
+			r.Route("/api/plans", s.planRoutes)
+		}
+		if s.brewfather != nil {
+			r.Route("/api/brewfather", s.brewfatherRoutes)
+		}
+		if s.tanks != nil {
+			r.Get("/api/tanks", s.handleTanks)
+			r.Get("/api/tanks/{id}", s.handleTank)
+		}
+		if s.historian != nil {
+			r.Get("/api/history", s.handleHistory)
+		}
+		if s.alarms != nil {
+			r.Route("/api/alarms", s.alarmRoutes)
+		}
+		if s.audit != nil {
+			r.With(s.require(auth.RoleOperator)).Get("/api/audit", s.handleAudit)
+		}
+	})
 
 	return r
 }
@@ -102,17 +236,31 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Send initial snapshot before the client starts receiving broadcasts
+	s.writeMu.Lock()
 	s.mu.Lock()
 	s.subscribers[conn] = true
+	metrics.WSClients.Set(float64(len(s.subscribers)))
 	s.mu.Unlock()
 	s.log.Info().Msg("💬 WS client connected")
 
-	// Send initial snapshot
 	s.latestMu.RLock()
 	for _, msg := range s.latest {
 		_ = conn.WriteJSON(msg)
 	}
 	s.latestMu.RUnlock()
+	_ = conn.WriteJSON(connectionMessage(s.client.State()))
+	if s.tanks != nil {
+		for _, t := range s.tanks.List() {
+			_ = conn.WriteJSON(tankMessage(t))
+		}
+	}
+	if s.alarms != nil {
+		for _, a := range s.alarms.Active() {
+			_ = conn.WriteJSON(alarmMessage(nil, a))
+		}
+	}
+	s.writeMu.Unlock()
 
 	// Setup ping handler
 	conn.SetReadLimit(1024)
@@ -134,6 +282,7 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 	// Remove client
 	s.mu.Lock()
 	delete(s.subscribers, conn)
+	metrics.WSClients.Set(float64(len(s.subscribers)))
 	s.mu.Unlock()
 	_ = conn.Close()
 	s.log.Info().Msg("🧹 WS client disconnected")
@@ -149,6 +298,19 @@ func (s *Server) keepAlive(conn *websocket.Conn) {
 	}
 }
 
+// handleHealth reports 503 while the OPC UA session is down.
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	state := s.client.State()
+	status, code := "ok", http.StatusOK
+	if state != opcua.StateConnected {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{
+		"status": status,
+		"opcua":  string(state),
+	})
+}
+
 func (s *Server) handleSnapshot(w http.ResponseWriter, _ *http.Request) {
 	s.latestMu.RLock()
 	defer s.latestMu.RUnlock()
@@ -158,26 +320,44 @@ func (s *Server) handleSnapshot(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-func (s *Server) consumeUpdates() {
-	for ev := range s.client.Updates {
-		msg := WSMessage{
-			Tag:         ev.Name,
-			Value:       ev.Value,
-			ValueType:   ev.Type,
-			DisplayName: ev.DisplayName, // 👈 legg til dette
-			Timestamp:   time.Now().UnixMilli(),
-		}
+// Publish caches a tag update and pushes it to all WS clients.
+func (s *Server) Publish(ev opcua.TagUpdate) {
+	msg := WSMessage{
+		Tag:         ev.Name,
+		Value:       ev.Value,
+		ValueType:   ev.Type,
+		DisplayName: ev.DisplayName, // 👈 legg til dette
+		Timestamp:   time.Now().UnixMilli(),
+	}
 
-		// oppdater cache
-		s.latestMu.Lock()
-		s.latest[ev.Name] = msg
-		s.latestMu.Unlock()
+	// oppdater cache
+	s.latestMu.Lock()
+	s.latest[ev.Name] = msg
+	s.latestMu.Unlock()
 
-		s.broadcast(msg)
-	}
+	observeTag(ev)
+
+	s.broadcast(msg)
+}
+
+// PublishTank pushes a tank state change to all WS clients.
+func (s *Server) PublishTank(t brew.Tank) {
+	observeTank(t)
+	s.broadcast(tankMessage(t))
+}
+
+func connectionMessage(state opcua.ConnectionState) WSConnectionMessage {
+	return WSConnectionMessage{Type: "connection", State: state, Timestamp: time.Now().UnixMilli()}
+}
+
+func tankMessage(t brew.Tank) WSTankMessage {
+	return WSTankMessage{Type: "tank", Tank: t, Timestamp: time.Now().UnixMilli()}
 }
 
-func (s *Server) broadcast(msg WSMessage) {
+func (s *Server) broadcast(msg interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -187,6 +367,7 @@ func (s *Server) broadcast(msg WSMessage) {
 			s.mu.RUnlock()
 			s.mu.Lock()
 			delete(s.subscribers, conn)
+			metrics.WSClients.Set(float64(len(s.subscribers)))
 			s.mu.Unlock()
 			s.mu.RLock()
 			_ = conn.Close()
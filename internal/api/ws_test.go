@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+)
+
+// newTestServer lager en server med gjæring og tanker, men uten PLS-forbindelse.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s, _ := newFermentationServer(t, nil)
+	return s
+}
+
+// newTestClient lager en OPC UA-klient med standardtaggene som aldri kobler til.
+func newTestClient(t *testing.T) (*opcua.Client, *opcua.TagMap) {
+	t.Helper()
+	tags, err := opcua.NewTagMap(config.DefaultTags(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg config.OPCUAConfig
+	cfg.Endpoint = "opc.tcp://127.0.0.1:4840"
+	cfg.Security.Policy, cfg.Security.Mode = "None", "None"
+	cfg.Auth = "anonymous"
+	cfg.Reconnect.MinBackoff, cfg.Reconnect.MaxBackoff = "1s", "1s"
+	client, err := opcua.NewClient(cfg, tags, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, tags
+}
+
+// newFermentationServer lager en testserver der motoren skriver til plc, eller
+// til OPC UA-klienten hvis plc er nil.
+func newFermentationServer(t *testing.T, plc fermentation.Controller) (*Server, *fermentation.SQLiteStore) {
+	t.Helper()
+	client, tags := newTestClient(t)
+
+	store, err := fermentation.NewSQLiteStore(filepath.Join(t.TempDir(), "fermentation.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	tanks := brew.NewTanks(config.DefaultTanks(), tags.Resolve)
+
+	var fcfg config.FermentationConfig
+	fcfg.StepCheckInterval, fcfg.StabilizationTime, fcfg.StatePersistInterval = "1s", "0s", "1m"
+	if plc == nil {
+		plc = client
+	}
+	engine, err := fermentation.NewEngine(zerolog.Nop(), plc, store, tanks, fcfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewServer(zerolog.Nop(), client, WithFermentation(engine, store), WithTanks(tanks)), store
+}
+
+// Flere servere i samme prosess (tester, eller app som startes på nytt) må
+// ikke registrere de samme Prometheus-målingene to ganger.
+func TestSecondServer(t *testing.T) {
+	for i := range 2 {
+		router := newTestServer(t).Router()
+		for _, path := range []string{"/metrics", "/api/fermentation/active", "/api/tanks"} {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("server %d: GET %s = %d %s", i+1, path, rec.Code, rec.Body)
+			}
+		}
+
+		// Uten PLS-forbindelse er tjenesten degradert, men svarer
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("server %d: GET /healthz = %d, want 503", i+1, rec.Code)
+		}
+	}
+}
@@ -2,13 +2,24 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/MrBoggi/goTOV/internal/alarm"
 	"github.com/MrBoggi/goTOV/internal/api"
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/brewfather"
 	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/historian"
+	"github.com/MrBoggi/goTOV/internal/metrics"
+	"github.com/MrBoggi/goTOV/internal/mqtt"
+	"github.com/MrBoggi/goTOV/internal/notify"
 	"github.com/MrBoggi/goTOV/internal/opcua"
 	"github.com/rs/zerolog"
 )
@@ -27,10 +38,20 @@ func RunServer(log zerolog.Logger) error {
 	log.Info().
 		Str("endpoint", cfg.OPCUA.Endpoint).
 		Str("user", cfg.OPCUA.Username).
+		Str("security", cfg.OPCUA.Security.Policy+"/"+cfg.OPCUA.Security.Mode).
+		Str("auth", cfg.OPCUA.Auth).
 		Msg("✅ Config loaded")
 
+	// --- Tag map ---
+	tags, err := opcua.NewTagMap(cfg.Tags, cfg.OPCUA.DefaultNamespace)
+	if err != nil {
+		log.Error().Err(err).Msg("❌ Invalid tag configuration")
+		return err
+	}
+	log.Info().Msgf("🏷 Loaded %d tags from config", len(tags.All()))
+
 	// --- OPC UA client ---
-	client, err := opcua.NewClient(cfg.OPCUA.Endpoint, cfg.OPCUA.Username, cfg.OPCUA.Password, log)
+	client, err := opcua.NewClient(cfg.OPCUA, tags, log)
 	if err != nil {
 		log.Error().Err(err).Msg("❌ Failed to create OPC UA client")
 		return err
@@ -40,26 +61,206 @@ func RunServer(log zerolog.Logger) error {
 		log.Info().Msg("🔌 OPC UA client closed")
 	}()
 
-	if err := client.Connect(); err != nil {
-		log.Error().Err(err).Msg("❌ Failed to connect to OPC UA server")
-		return err
+	// --- Audit log ---
+	var auditLog *audit.Log
+	if cfg.Audit.IsEnabled() {
+		auditStore, err := audit.NewSQLiteStore(cfg.Audit.DatabasePath)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Failed to open audit database")
+			return err
+		}
+		defer auditStore.Close()
+
+		auditLog = audit.New(log, auditStore)
+		client.SetAudit(auditLog)
+		log.Info().Str("path", cfg.Audit.DatabasePath).Msg("📜 Audit log enabled")
 	}
-	log.Info().Msg("✅ Connected to Beckhoff PLC via OPC UA")
 
 	// --- Context for subs ---
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// --- List symbols / nodes ---
-	nodes, err := client.ListSymbols(ctx)
-	if err != nil {
-		log.Error().Err(err).Msg("❌ Failed to list PLC symbols")
-		return err
+	// --- Tanks ---
+	tanks := brew.NewTanks(cfg.Tanks, tags.Resolve)
+	for _, t := range tanks.List() {
+		for _, node := range []string{t.Tags.Temperature, t.Tags.Cooling, t.Tags.Heater, t.Tags.Gravity} {
+			if _, ok := tags.Lookup(node); node != "" && !ok {
+				log.Warn().Int("tank", t.No).Str("node", node).Msg("⚠️ Tank refers to a tag that is not in the tag map (no live updates)")
+			}
+		}
+		log.Info().
+			Int("tank", t.No).
+			Str("name", t.Name).
+			Str("temperature", t.Tags.Temperature).
+			Msg("🛢 Tank configured")
+	}
+	apiOpts := []api.Option{api.WithTanks(tanks)}
+	if auditLog != nil {
+		apiOpts = append(apiOpts, api.WithAudit(auditLog))
+	}
+
+	// --- Historian ---
+	sinks := []func(opcua.TagUpdate){
+		func(u opcua.TagUpdate) { tanks.Update(u.Name, u.Value, u.Time) },
+	}
+	var hist *historian.Historian
+	if cfg.Historian.Enabled {
+		histStore, err := historian.Open(cfg.Historian)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Failed to open historian database")
+			return err
+		}
+		defer histStore.Close()
+
+		hist, err = historian.New(log, histStore, tags, cfg.Historian)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Invalid historian configuration")
+			return err
+		}
+		apiOpts = append(apiOpts, api.WithHistorian(hist))
+		sinks = append(sinks, hist.Record)
+
+		// Vent på siste flush før databasen lukkes
+		histDone := make(chan struct{})
+		defer func() {
+			cancel()
+			<-histDone
+		}()
+		go func() {
+			hist.Run(ctx)
+			close(histDone)
+		}()
+		log.Info().Str("backend", cfg.Historian.Backend).Msg("📈 Historian enabled")
+	}
+
+	// --- MQTT bridge ---
+	if cfg.MQTT.Enabled {
+		bridge := mqtt.New(log, cfg.MQTT, tags, client)
+		bridge.Start()
+		defer bridge.Close()
+		sinks = append(sinks, bridge.Publish)
+	}
+
+	// --- Notifications ---
+	var notifier *notify.Notifier
+	if len(cfg.Notifications.Channels) > 0 {
+		notifier, err = notify.New(log, cfg.Notifications)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Invalid notification configuration")
+			return err
+		}
+		go notifier.Run(ctx)
+	}
+
+	// --- Alarms ---
+	if cfg.Alarms.Enabled {
+		alarmStore, err := alarm.NewSQLiteStore(cfg.Alarms.DatabasePath)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Failed to open alarm database")
+			return err
+		}
+		defer alarmStore.Close()
+
+		alarms, err := alarm.NewManager(log, alarmStore, tags, cfg.Alarms)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Invalid alarm configuration")
+			return err
+		}
+		if notifier != nil {
+			alarms.OnEvent(notifier.AlarmEvent)
+		}
+		apiOpts = append(apiOpts, api.WithAlarms(alarms))
+		sinks = append(sinks, alarms.Record)
+		go alarms.Run(ctx)
+	}
+
+	// --- Fermentation engine ---
+	if cfg.Fermentation.Enabled {
+		store, err := fermentation.NewSQLiteStore(cfg.Fermentation.DatabasePath)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Failed to open fermentation database")
+			return err
+		}
+		defer store.Close()
+
+		engine, err := fermentation.NewEngine(log, client, store, tanks, cfg.Fermentation)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Failed to create fermentation engine")
+			return err
+		}
+		if hist != nil {
+			engine.OnEvent(hist.RecordEvent)
+		}
+		if notifier != nil {
+			engine.OnEvent(notifier.FermentationEvent)
+		}
+		// Utganger motoren skriver selv logges med kilde "engine"
+		engineCtx := audit.WithActor(ctx, audit.Actor{User: "engine", Source: audit.SourceEngine})
+		// PLS-en er ikke tilkoblet ennå: gjæringer som ble ferdige under nedetid
+		// slår av utgangene i kontrollsløyfen når skrivingen lykkes
+		if err := engine.Restore(engineCtx); err != nil {
+			log.Error().Err(err).Msg("❌ Failed to resume active fermentations")
+			return err
+		}
+
+		apiOpts = append(apiOpts, api.WithFermentation(engine, store))
+		// Registreres her og ikke i api.NewServer, så flere servere i samme prosess går
+		metrics.RegisterFermentation(fermentationRuns(engine))
+		client.OnStateChange(func(state opcua.ConnectionState) {
+			if state == opcua.StateConnected {
+				engine.ResyncOutputs()
+			}
+		})
+
+		go func() {
+			if err := engine.Run(engineCtx); err != nil {
+				log.Error().Err(err).Msg("❌ Fermentation engine failed")
+				cancel()
+			}
+		}()
+	}
+
+	// --- Brewfather proxy ---
+	if cfg.Brewfather.UserID != "" && cfg.Brewfather.APIKey != "" {
+		apiOpts = append(apiOpts, api.WithBrewfather(brewfather.NewClient(cfg.Brewfather.UserID, cfg.Brewfather.APIKey)))
+	} else {
+		log.Warn().Msg("⚠️ Brewfather credentials missing, /api/brewfather disabled")
+	}
+
+	// --- Authentication ---
+	apiOpts = append(apiOpts, api.WithAllowedOrigins(cfg.Auth.AllowedOrigins))
+	if cfg.Auth.IsEnabled() {
+		sessionTTL, err := time.ParseDuration(cfg.Auth.SessionTTL)
+		if err != nil || sessionTTL <= 0 {
+			log.Error().Str("session_ttl", cfg.Auth.SessionTTL).Msg("❌ Invalid auth.session_ttl")
+			return fmt.Errorf("invalid auth.session_ttl %q", cfg.Auth.SessionTTL)
+		}
+		authStore, err := auth.NewSQLiteStore(cfg.Auth.DatabasePath)
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Failed to open auth database")
+			return err
+		}
+		defer authStore.Close()
+
+		authSvc := auth.NewService(authStore, sessionTTL)
+		password, err := authSvc.Bootstrap()
+		if err != nil {
+			log.Error().Err(err).Msg("❌ Failed to create initial admin user")
+			return err
+		}
+		if password != "" {
+			log.Warn().
+				Str("user", "admin").
+				Str("password", password).
+				Msg("🔐 No users found — created admin user. Change the password (gotov user passwd admin)")
+		}
+		apiOpts = append(apiOpts, api.WithAuth(authSvc, cfg.Auth.PublicMetrics))
+	} else {
+		log.Warn().Msg("⚠️ Authentication disabled (auth.enabled: false) — anyone on the network can write tags")
 	}
-	log.Info().Msgf("🧭 Found %d symbols manually", len(nodes))
 
 	// --- Start HTTP/WS API server ---
-	apiServer := api.NewServer(log, client)
+	apiServer := api.NewServer(log, client, apiOpts...)
 	go func() {
 		if err := apiServer.Start(":8080"); err != nil {
 			log.Error().Err(err).Msg("🌐 HTTP/WS server stopped")
@@ -67,10 +268,13 @@ func RunServer(log zerolog.Logger) error {
 		}
 	}()
 
-	// --- Start subscription ---
+	// --- Fan out tag updates ---
+	go dispatchUpdates(ctx, client.Updates, append(sinks, apiServer.Publish)...)
+
+	// --- Supervised OPC UA session + subscription ---
 	go func() {
-		if err := client.SubscribeAll(ctx, nodes); err != nil {
-			log.Error().Err(err).Msg("❌ Subscription failed")
+		if err := client.Run(ctx); err != nil {
+			log.Error().Err(err).Msg("❌ OPC UA supervisor failed")
 			cancel()
 		}
 	}()
@@ -87,3 +291,36 @@ func RunServer(log zerolog.Logger) error {
 
 	return nil
 }
+
+// dispatchUpdates sender hver tag-oppdatering videre til alle mottakere.
+func dispatchUpdates(ctx context.Context, updates <-chan opcua.TagUpdate, sinks ...func(opcua.TagUpdate)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			for _, sink := range sinks {
+				sink(u)
+			}
+		}
+	}
+}
+
+// fermentationRuns tilpasser motoren til metrics-collectoren.
+func fermentationRuns(engine *fermentation.Engine) func() []metrics.Run {
+	return func() []metrics.Run {
+		active := engine.Active()
+		out := make([]metrics.Run, 0, len(active))
+		for _, st := range active {
+			out = append(out, metrics.Run{
+				TankNo:     st.TankNo,
+				BatchID:    st.BatchID,
+				StepIndex:  st.StepIndex,
+				TargetTemp: st.TargetTemp,
+				ActualTemp: st.ActualTemp,
+				Paused:     st.Status == fermentation.StatusPaused,
+			})
+		}
+		return out
+	}
+}
@@ -0,0 +1,177 @@
+// Package audit er en append-only logg over skrivinger og styringshandlinger:
+// hvem gjorde hva, fra hvor, og med hvilket resultat.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Kilder.
+const (
+	SourceAPI    = "api"
+	SourceCLI    = "cli"
+	SourceMQTT   = "mqtt"
+	SourceEngine = "engine"
+	SourceSystem = "system" // ingen aktør i context
+)
+
+// Handlinger.
+const (
+	ActionTagWrite            = "tag.write"
+	ActionFermentationStart   = "fermentation.start"
+	ActionFermentationPause   = "fermentation.pause"
+	ActionFermentationResume  = "fermentation.resume"
+	ActionFermentationSkip    = "fermentation.skip"
+	ActionFermentationStep    = "fermentation.step"
+	ActionFermentationAbort   = "fermentation.abort"
+	ActionFermentationGravity = "fermentation.gravity"
+	ActionPlanCreate          = "plan.create"
+	ActionPlanUpdate          = "plan.update"
+	ActionPlanDelete          = "plan.delete"
+	ActionPlanImport          = "plan.import"
+	ActionAlarmAck            = "alarm.ack"
+	ActionAlarmShelve         = "alarm.shelve"
+	ActionAlarmUnshelve       = "alarm.unshelve"
+)
+
+// Resultat.
+const (
+	StatusOK       = "ok"
+	StatusRejected = "rejected" // avvist av validering eller tilgangskontroll
+	StatusError    = "error"    // feilet mot PLS/database
+)
+
+// Entry er én rad i loggen. Old/New er JSON.
+type Entry struct {
+	ID       int64           `json:"id"`
+	Time     time.Time       `json:"time"`
+	User     string          `json:"user"`
+	Source   string          `json:"source"`
+	Action   string          `json:"action"`
+	Target   string          `json:"target"`
+	OldValue json.RawMessage `json:"old_value,omitempty"`
+	NewValue json.RawMessage `json:"new_value,omitempty"`
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Filter begrenser Query. Tomme felt ignoreres.
+type Filter struct {
+	User   string
+	Source string
+	Action string // eksakt, eller prefiks med "*", f.eks. "fermentation.*"
+	Target string
+	Status string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Actor er hvem som utfører en handling.
+type Actor struct {
+	User   string
+	Source string
+}
+
+type ctxKey struct{}
+
+// WithActor legger aktøren i context, så skrivinger lenger ned kan logges.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, ctxKey{}, a)
+}
+
+// ActorFromContext returnerer aktøren, eller SourceSystem uten bruker.
+func ActorFromContext(ctx context.Context) Actor {
+	if a, ok := ctx.Value(ctxKey{}).(Actor); ok {
+		return a
+	}
+	return Actor{Source: SourceSystem}
+}
+
+// Log skriver til en Store. En nil *Log er gyldig og logger ingenting,
+// så kallere trenger ikke sjekke om audit er slått på.
+type Log struct {
+	log   zerolog.Logger
+	store *SQLiteStore
+}
+
+// New lager en Log.
+func New(log zerolog.Logger, store *SQLiteStore) *Log {
+	return &Log{log: log, store: store}
+}
+
+// Record logger en handling utført av aktøren i ctx. Verdiene marshales til
+// JSON; err avgjør status (pakk inn med Rejected for avviste handlinger).
+func (l *Log) Record(ctx context.Context, action, target string, oldValue, newValue interface{}, err error) {
+	if l == nil {
+		return
+	}
+	actor := ActorFromContext(ctx)
+	e := Entry{
+		Time:     time.Now(),
+		User:     actor.User,
+		Source:   actor.Source,
+		Action:   action,
+		Target:   target,
+		OldValue: marshal(oldValue),
+		NewValue: marshal(newValue),
+		Status:   Status(err),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if _, err := l.store.Insert(e); err != nil {
+		l.log.Error().Err(err).Str("action", action).Str("target", target).Msg("❌ Failed to write audit log")
+	}
+}
+
+// Query henter rader, nyeste først.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	return l.store.Query(f)
+}
+
+// rejected markerer at handlingen ble avvist, ikke at den feilet.
+type rejected struct{ error }
+
+func (r rejected) Unwrap() error { return r.error }
+
+// Rejected wraps err so it is logged with StatusRejected.
+func Rejected(err error) error {
+	if err == nil {
+		return nil
+	}
+	return rejected{err}
+}
+
+// Status utleder status fra en feil.
+func Status(err error) string {
+	var r rejected
+	switch {
+	case err == nil:
+		return StatusOK
+	case errors.As(err, &r):
+		return StatusRejected
+	default:
+		return StatusError
+	}
+}
+
+func marshal(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
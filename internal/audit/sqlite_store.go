@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/migrate"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteStore struct {
+	DB *sqlx.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	s := &SQLiteStore{DB: db}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close releases the database connection.
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations er skjemaendringene for audit.db, i rekkefølge.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations")
+
+func (s *SQLiteStore) migrate() error {
+	_, err := migrate.Up(s.DB, Migrations)
+	return err
+}
+
+type entryRow struct {
+	ID       int64          `db:"id"`
+	TS       int64          `db:"ts"`
+	User     string         `db:"user"`
+	Source   string         `db:"source"`
+	Action   string         `db:"action"`
+	Target   string         `db:"target"`
+	OldValue sql.NullString `db:"old_value"`
+	NewValue sql.NullString `db:"new_value"`
+	Status   string         `db:"status"`
+	Error    string         `db:"error"`
+}
+
+// Insert legger til én rad.
+func (s *SQLiteStore) Insert(e Entry) (int64, error) {
+	res, err := s.DB.Exec(`
+INSERT INTO audit_log (ts, user, source, action, target, old_value, new_value, status, error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UnixMilli(), e.User, e.Source, e.Action, e.Target,
+		nullJSON(e.OldValue), nullJSON(e.NewValue), e.Status, e.Error)
+	if err != nil {
+		return 0, fmt.Errorf("insert audit entry: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// Query henter rader som matcher filteret, nyeste først.
+func (s *SQLiteStore) Query(f Filter) ([]Entry, error) {
+	var where []string
+	var args []interface{}
+	eq := func(col, val string) {
+		if val != "" {
+			where = append(where, col+" = ?")
+			args = append(args, val)
+		}
+	}
+	eq("user", f.User)
+	eq("source", f.Source)
+	eq("target", f.Target)
+	eq("status", f.Status)
+	if prefix, ok := strings.CutSuffix(f.Action, "*"); ok {
+		where = append(where, "action LIKE ?")
+		args = append(args, prefix+"%")
+	} else {
+		eq("action", f.Action)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "ts >= ?")
+		args = append(args, f.Since.UnixMilli())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "ts < ?")
+		args = append(args, f.Until.UnixMilli())
+	}
+
+	q := `SELECT id, ts, user, source, action, target, old_value, new_value, status, error FROM audit_log`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	q += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows := []entryRow{}
+	if err := s.DB.Select(&rows, q, args...); err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+
+	out := make([]Entry, 0, len(rows))
+	for _, r := range rows {
+		e := Entry{
+			ID:     r.ID,
+			Time:   time.UnixMilli(r.TS),
+			User:   r.User,
+			Source: r.Source,
+			Action: r.Action,
+			Target: r.Target,
+			Status: r.Status,
+			Error:  r.Error,
+		}
+		if r.OldValue.Valid {
+			e.OldValue = []byte(r.OldValue.String)
+		}
+		if r.NewValue.Valid {
+			e.NewValue = []byte(r.NewValue.String)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func nullJSON(b []byte) sql.NullString {
+	if len(b) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
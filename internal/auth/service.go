@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Prefiks på API-tokens, så de er lette å kjenne igjen (og å søke etter i lekkasjer).
+const tokenPrefix = "gtv_"
+
+// dummyHash brukes når brukeren ikke finnes, så login tar like lang tid.
+var dummyHash = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte("gotov-dummy-password"), bcrypt.DefaultCost)
+	return h
+})
+
+// Service håndterer innlogging, sesjoner og tokens.
+type Service struct {
+	store      *SQLiteStore
+	sessionTTL time.Duration
+}
+
+// NewService lager en Service. sessionTTL er levetiden til en innlogging.
+func NewService(store *SQLiteStore, sessionTTL time.Duration) *Service {
+	return &Service{store: store, sessionTTL: sessionTTL}
+}
+
+// Bootstrap oppretter brukeren "admin" med et tilfeldig passord når det ikke
+// finnes noen brukere. Passordet returneres (tom streng når ingenting ble gjort).
+func (s *Service) Bootstrap() (string, error) {
+	n, err := s.store.CountUsers()
+	if err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "", nil
+	}
+
+	password := randomString(12)
+	if _, err := s.CreateUser("admin", password, RoleAdmin); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// Login sjekker brukernavn/passord og oppretter en sesjon.
+func (s *Service) Login(username, password string) (token string, u *User, expires time.Time, err error) {
+	u, err = s.store.GetUser(username)
+	if err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return "", nil, time.Time{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return "", nil, time.Time{}, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	expires = now.Add(s.sessionTTL)
+	token = randomString(32)
+	if err := s.store.CreateSession(hashToken(token), u.ID, now, expires); err != nil {
+		return "", nil, time.Time{}, err
+	}
+	return token, u, expires, nil
+}
+
+// Logout sletter sesjonen. Ukjente tokens ignoreres.
+func (s *Service) Logout(token string) error {
+	return s.store.DeleteSession(hashToken(token))
+}
+
+// Authenticate slår opp en sesjon eller et API-token.
+func (s *Service) Authenticate(token string) (*User, error) {
+	now := time.Now()
+	if strings.HasPrefix(token, tokenPrefix) {
+		return s.store.TokenUser(hashToken(token), now)
+	}
+	return s.store.SessionUser(hashToken(token), now)
+}
+
+// CreateUser oppretter en bruker med bcrypt-hashet passord.
+func (s *Service) CreateUser(username, password, role string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if !ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u := User{Username: username, PasswordHash: hash, Role: role, CreatedAt: time.Now()}
+	id, err := s.store.CreateUser(u)
+	if err != nil {
+		return nil, err
+	}
+	u.ID = id
+	return &u, nil
+}
+
+// UpdateUser endrer rolle og/eller passord. Tomme verdier beholdes.
+// Et nytt passord logger brukeren ut av alle sesjoner.
+func (s *Service) UpdateUser(username, password, role string) (*User, error) {
+	u, err := s.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if role != "" {
+		if !ValidRole(role) {
+			return nil, ErrInvalidRole
+		}
+		u.Role = role
+	}
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		u.PasswordHash = hash
+	}
+
+	if err := s.store.UpdateUser(*u); err != nil {
+		return nil, err
+	}
+	if password != "" {
+		if err := s.store.DeleteSessions(u.ID); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// ChangePassword lar en bruker bytte sitt eget passord.
+func (s *Service) ChangePassword(username, oldPassword, newPassword string) error {
+	u, err := s.store.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(oldPassword)) != nil {
+		return ErrInvalidCredentials
+	}
+	_, err = s.UpdateUser(username, newPassword, "")
+	return err
+}
+
+// DeleteUser sletter brukeren med sesjoner og tokens.
+func (s *Service) DeleteUser(username string) error {
+	u, err := s.store.GetUser(username)
+	if err != nil {
+		return err
+	}
+	return s.store.DeleteUser(u.ID)
+}
+
+// ListUsers returnerer alle brukere.
+func (s *Service) ListUsers() ([]User, error) {
+	return s.store.ListUsers()
+}
+
+// CreateToken lager et API-token for brukeren. ttl = 0 betyr uten utløp.
+// Tokenet returneres i klartekst bare her.
+func (s *Service) CreateToken(name, username string, ttl time.Duration) (string, *Token, error) {
+	if name == "" {
+		return "", nil, fmt.Errorf("token name is required")
+	}
+	u, err := s.store.GetUser(username)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	var expires *time.Time
+	if ttl > 0 {
+		exp := now.Add(ttl).Truncate(time.Second)
+		expires = &exp
+	}
+
+	plain := tokenPrefix + randomString(32)
+	id, err := s.store.CreateToken(name, hashToken(plain), u.ID, now, expires)
+	if err != nil {
+		return "", nil, err
+	}
+	return plain, &Token{ID: id, Name: name, Username: u.Username, Role: u.Role, CreatedAt: now, ExpiresAt: expires}, nil
+}
+
+// ListTokens returnerer alle API-tokens (uten selve tokenet).
+func (s *Service) ListTokens() ([]Token, error) {
+	return s.store.ListTokens()
+}
+
+// RevokeToken sletter et API-token.
+func (s *Service) RevokeToken(id int64) error {
+	return s.store.DeleteToken(id)
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < 8 {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// hashToken: tokens er tilfeldige nok til at SHA-256 holder (bcrypt er for passord).
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		have, need string
+		want       bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleViewer, RoleAdmin, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleOperator, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleViewer, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleViewer, false},
+		{"root", RoleViewer, false},
+		{"root", "", false}, // ukjent rolle får aldri noe
+	}
+	for _, tt := range tests {
+		if got := Allows(tt.have, tt.need); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.have, tt.need, got, tt.want)
+		}
+	}
+}
+
+func newTestService(t *testing.T, sessionTTL time.Duration) (*Service, *SQLiteStore) {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return NewService(store, sessionTTL), store
+}
+
+func mustCreateUser(t *testing.T, s *Service, username, role string) *User {
+	t.Helper()
+	u, err := s.CreateUser(username, username+"-password", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	s, _ := newTestService(t, time.Hour)
+	mustCreateUser(t, s, "ola", RoleOperator)
+
+	if _, _, _, err := s.Login("ola", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login with wrong password = %v, want ErrInvalidCredentials", err)
+	}
+	if _, _, _, err := s.Login("kari", "ola-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login of unknown user = %v, want ErrInvalidCredentials", err)
+	}
+
+	token, u, expires, err := s.Login("ola", "ola-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "ola" || time.Until(expires) < 59*time.Minute {
+		t.Errorf("Login = %+v expiring %s, want ola for an hour", u, expires)
+	}
+	got, err := s.Authenticate(token)
+	if err != nil || got.Username != "ola" || got.Role != RoleOperator {
+		t.Fatalf("Authenticate = %+v, %v; want ola as operator", got, err)
+	}
+
+	if err := s.Logout(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(token); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate after logout = %v, want ErrUnauthenticated", err)
+	}
+	if err := s.Logout("unknown"); err != nil {
+		t.Errorf("Logout of unknown token = %v, want nil", err)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	s, store := newTestService(t, time.Hour)
+	u := mustCreateUser(t, s, "ola", RoleViewer)
+
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.CreateSession(hashToken("abc"), u.ID, t0, t0.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SessionUser(hashToken("abc"), t0.Add(59*time.Minute)); err != nil {
+		t.Errorf("session before expiry: %v", err)
+	}
+	if _, err := store.SessionUser(hashToken("abc"), t0.Add(61*time.Minute)); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("session after expiry = %v, want ErrUnauthenticated", err)
+	}
+
+	// En ny sesjon rydder bort de utløpte
+	if err := store.CreateSession(hashToken("def"), u.ID, t0.Add(2*time.Hour), t0.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := store.DB.Get(&n, `SELECT COUNT(*) FROM sessions`); err != nil || n != 1 {
+		t.Errorf("%d sessions left (%v), want the expired one pruned", n, err)
+	}
+
+	// Gjennom Service: en innlogging som allerede er utløpt virker ikke
+	expired, _ := newTestService(t, -time.Minute)
+	mustCreateUser(t, expired, "kari", RoleViewer)
+	token, _, _, err := expired.Login("kari", "kari-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expired.Authenticate(token); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Authenticate of expired session = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestAuthenticateDispatchesOnTokenPrefix(t *testing.T) {
+	s, store := newTestService(t, time.Hour)
+	u := mustCreateUser(t, s, "ola", RoleOperator)
+
+	plain, tok, err := s.CreateToken("grafana", "ola", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.ExpiresAt != nil || len(plain) <= len(tokenPrefix) || plain[:len(tokenPrefix)] != tokenPrefix {
+		t.Fatalf("CreateToken = %q %+v, want a %s token without expiry", plain, tok, tokenPrefix)
+	}
+	got, err := s.Authenticate(plain)
+	if err != nil || got.Username != "ola" || got.Role != RoleOperator {
+		t.Errorf("Authenticate(API token) = %+v, %v; want ola", got, err)
+	}
+
+	// Tokens med prefiks slås bare opp blant API-tokens, og omvendt
+	now := time.Now()
+	if err := store.CreateSession(hashToken(tokenPrefix+"session"), u.ID, now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(tokenPrefix + "session"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("prefixed session token = %v, want ErrUnauthenticated", err)
+	}
+	if _, err := store.CreateToken("raw", hashToken("raw-token"), u.ID, now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate("raw-token"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("API token without prefix = %v, want ErrUnauthenticated", err)
+	}
+
+	tokens, err := s.ListTokens()
+	if err != nil || len(tokens) != 2 || tokens[0].LastUsedAt == nil {
+		t.Errorf("ListTokens = %+v, %v; want last_used_at set on the used token", tokens, err)
+	}
+	if err := s.RevokeToken(tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(plain); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("revoked token = %v, want ErrUnauthenticated", err)
+	}
+	if err := s.RevokeToken(tok.ID); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("second revoke = %v, want ErrUnknownToken", err)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	s, store := newTestService(t, time.Hour)
+	mustCreateUser(t, s, "ola", RoleViewer)
+
+	plain, tok, err := s.CreateToken("ci", "ola", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.ExpiresAt == nil {
+		t.Fatal("token with ttl has no expiry")
+	}
+	if _, err := store.TokenUser(hashToken(plain), tok.ExpiresAt.Add(-time.Second)); err != nil {
+		t.Errorf("token before expiry: %v", err)
+	}
+	if _, err := store.TokenUser(hashToken(plain), tok.ExpiresAt.Add(time.Second)); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("token after expiry = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestPasswordChangeEndsSessions(t *testing.T) {
+	s, _ := newTestService(t, time.Hour)
+	mustCreateUser(t, s, "ola", RoleOperator)
+	first, _, _, err := s.Login("ola", "ola-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, _, err := s.Login("ola", "ola-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiToken, _, err := s.CreateToken("grafana", "ola", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bare rollebytte: sesjonene beholdes
+	if _, err := s.UpdateUser("ola", "", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := s.Authenticate(first); err != nil || u.Role != RoleViewer {
+		t.Fatalf("after role change: %+v, %v; want the session kept with the new role", u, err)
+	}
+
+	if err := s.ChangePassword("ola", "wrong-password", "new-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ChangePassword with wrong old password = %v, want ErrInvalidCredentials", err)
+	}
+	if err := s.ChangePassword("ola", "ola-password", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("ChangePassword to short password = %v, want ErrWeakPassword", err)
+	}
+	if _, err := s.Authenticate(first); err != nil {
+		t.Fatalf("failed password changes ended the session: %v", err)
+	}
+
+	if err := s.ChangePassword("ola", "ola-password", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{first, second} {
+		if _, err := s.Authenticate(token); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("session after password change = %v, want ErrUnauthenticated", err)
+		}
+	}
+	if _, err := s.Authenticate(apiToken); err != nil {
+		t.Errorf("API token after password change: %v, want it kept", err)
+	}
+	if _, _, _, err := s.Login("ola", "new-password"); err != nil {
+		t.Errorf("Login with new password: %v", err)
+	}
+}
+
+func TestUserManagement(t *testing.T) {
+	s, _ := newTestService(t, time.Hour)
+
+	password, err := s.Bootstrap()
+	if err != nil || len(password) < 8 {
+		t.Fatalf("Bootstrap = %q, %v; want a generated password", password, err)
+	}
+	if _, _, _, err := s.Login("admin", password); err != nil {
+		t.Errorf("Login as bootstrapped admin: %v", err)
+	}
+	if again, err := s.Bootstrap(); err != nil || again != "" {
+		t.Errorf("second Bootstrap = %q, %v; want nothing done", again, err)
+	}
+
+	if _, err := s.CreateUser("admin", "long-enough", RoleViewer); !errors.Is(err, ErrUserExists) {
+		t.Errorf("duplicate user = %v, want ErrUserExists", err)
+	}
+	if _, err := s.CreateUser("ola", "long-enough", "root"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("invalid role = %v, want ErrInvalidRole", err)
+	}
+	if _, err := s.CreateUser("ola", "short", RoleViewer); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("short password = %v, want ErrWeakPassword", err)
+	}
+	if _, err := s.CreateUser("  ", "long-enough", RoleViewer); err == nil {
+		t.Error("blank username should fail")
+	}
+	if _, err := s.UpdateUser("nobody", "", RoleAdmin); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("update of unknown user = %v, want ErrUnknownUser", err)
+	}
+
+	mustCreateUser(t, s, "ola", RoleViewer)
+	token, _, _, err := s.Login("ola", "ola-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiToken, _, err := s.CreateToken("ci", "ola", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteUser("ola"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range []string{token, apiToken} {
+		if _, err := s.Authenticate(tok); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("credential of deleted user = %v, want ErrUnauthenticated", err)
+		}
+	}
+	users, err := s.ListUsers()
+	if err != nil || len(users) != 1 || users[0].Username != "admin" {
+		t.Errorf("ListUsers = %+v, %v; want only admin", users, err)
+	}
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/migrate"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteStore struct {
+	DB *sqlx.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	s := &SQLiteStore{DB: db}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close releases the database connection.
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations er skjemaendringene for auth.db, i rekkefølge.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations")
+
+func (s *SQLiteStore) migrate() error {
+	_, err := migrate.Up(s.DB, Migrations)
+	return err
+}
+
+// CountUsers returnerer antall brukere.
+func (s *SQLiteStore) CountUsers() (int, error) {
+	var n int
+	err := s.DB.Get(&n, `SELECT COUNT(*) FROM users`)
+	return n, err
+}
+
+// CreateUser lagrer en ny bruker.
+func (s *SQLiteStore) CreateUser(u User) (int64, error) {
+	res, err := s.DB.Exec(`INSERT INTO users (username, password_hash, role, created_at) VALUES (?, ?, ?, ?)`,
+		u.Username, u.PasswordHash, u.Role, u.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return 0, fmt.Errorf("%w: %q", ErrUserExists, u.Username)
+		}
+		return 0, fmt.Errorf("insert user: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetUser henter en bruker på brukernavn.
+func (s *SQLiteStore) GetUser(username string) (*User, error) {
+	var u User
+	err := s.DB.Get(&u, `SELECT id, username, password_hash, role, created_at FROM users WHERE username = ?`, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownUser, username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	return &u, nil
+}
+
+// ListUsers henter alle brukere sortert på navn.
+func (s *SQLiteStore) ListUsers() ([]User, error) {
+	users := []User{}
+	err := s.DB.Select(&users, `SELECT id, username, password_hash, role, created_at FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return users, nil
+}
+
+// UpdateUser lagrer rolle og passord-hash.
+func (s *SQLiteStore) UpdateUser(u User) error {
+	_, err := s.DB.Exec(`UPDATE users SET role = ?, password_hash = ? WHERE id = ?`, u.Role, u.PasswordHash, u.ID)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser sletter brukeren med sesjoner og tokens.
+func (s *SQLiteStore) DeleteUser(id int64) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, q := range []string{
+		`DELETE FROM sessions WHERE user_id = ?`,
+		`DELETE FROM api_tokens WHERE user_id = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(q, id); err != nil {
+			return fmt.Errorf("delete user: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteSessions logger brukeren ut overalt (brukes ved passordbytte).
+func (s *SQLiteStore) DeleteSessions(userID int64) error {
+	_, err := s.DB.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// CreateSession lagrer en sesjon. Utløpte sesjoner ryddes samtidig.
+func (s *SQLiteStore) CreateSession(hash string, userID int64, created, expires time.Time) error {
+	if _, err := s.DB.Exec(`DELETE FROM sessions WHERE expires_at < ?`, created.Unix()); err != nil {
+		return fmt.Errorf("prune sessions: %w", err)
+	}
+	_, err := s.DB.Exec(`INSERT INTO sessions (token_hash, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		hash, userID, created, expires.Unix())
+	if err != nil {
+		return fmt.Errorf("insert session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession sletter én sesjon (logout).
+func (s *SQLiteStore) DeleteSession(hash string) error {
+	_, err := s.DB.Exec(`DELETE FROM sessions WHERE token_hash = ?`, hash)
+	return err
+}
+
+// SessionUser henter brukeren for en gyldig sesjon.
+func (s *SQLiteStore) SessionUser(hash string, now time.Time) (*User, error) {
+	var u User
+	err := s.DB.Get(&u, `
+SELECT u.id, u.username, u.password_hash, u.role, u.created_at
+FROM sessions s JOIN users u ON u.id = s.user_id
+WHERE s.token_hash = ? AND s.expires_at >= ?`, hash, now.Unix())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	return &u, nil
+}
+
+type tokenRow struct {
+	ID         int64         `db:"id"`
+	Name       string        `db:"name"`
+	UserID     int64         `db:"user_id"`
+	Username   string        `db:"username"`
+	Role       string        `db:"role"`
+	CreatedAt  time.Time     `db:"created_at"`
+	ExpiresAt  sql.NullInt64 `db:"expires_at"`
+	LastUsedAt *time.Time    `db:"last_used_at"`
+}
+
+func (r tokenRow) token() Token {
+	t := Token{
+		ID:         r.ID,
+		Name:       r.Name,
+		Username:   r.Username,
+		Role:       r.Role,
+		CreatedAt:  r.CreatedAt,
+		LastUsedAt: r.LastUsedAt,
+	}
+	if r.ExpiresAt.Valid {
+		exp := time.Unix(r.ExpiresAt.Int64, 0)
+		t.ExpiresAt = &exp
+	}
+	return t
+}
+
+const tokenSelect = `
+SELECT t.id, t.name, t.user_id, u.username, u.role, t.created_at, t.expires_at, t.last_used_at
+FROM api_tokens t JOIN users u ON u.id = t.user_id`
+
+// CreateToken lagrer et API-token.
+func (s *SQLiteStore) CreateToken(name, hash string, userID int64, created time.Time, expires *time.Time) (int64, error) {
+	var exp sql.NullInt64
+	if expires != nil {
+		exp = sql.NullInt64{Int64: expires.Unix(), Valid: true}
+	}
+	res, err := s.DB.Exec(`INSERT INTO api_tokens (name, token_hash, user_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		name, hash, userID, created, exp)
+	if err != nil {
+		return 0, fmt.Errorf("insert token: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// ListTokens henter alle API-tokens.
+func (s *SQLiteStore) ListTokens() ([]Token, error) {
+	rows := []tokenRow{}
+	if err := s.DB.Select(&rows, tokenSelect+` ORDER BY t.id`); err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	out := make([]Token, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.token())
+	}
+	return out, nil
+}
+
+// DeleteToken trekker tilbake et API-token.
+func (s *SQLiteStore) DeleteToken(id int64) error {
+	res, err := s.DB.Exec(`DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownToken, id)
+	}
+	return nil
+}
+
+// TokenUser henter brukeren for et gyldig API-token og oppdaterer last_used_at
+// (maks én gang i minuttet).
+func (s *SQLiteStore) TokenUser(hash string, now time.Time) (*User, error) {
+	var r tokenRow
+	err := s.DB.Get(&r, tokenSelect+` WHERE t.token_hash = ? AND (t.expires_at IS NULL OR t.expires_at >= ?)`, hash, now.Unix())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get token: %w", err)
+	}
+
+	if r.LastUsedAt == nil || now.Sub(*r.LastUsedAt) > time.Minute {
+		_, _ = s.DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now, r.ID)
+	}
+	return &User{ID: r.UserID, Username: r.Username, Role: r.Role}, nil
+}
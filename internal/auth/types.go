@@ -0,0 +1,81 @@
+// Package auth holder brukere, sesjoner og API-tokens for HTTP-API-et.
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Roller, i stigende rekkefølge.
+const (
+	RoleViewer   = "viewer"   // lese tags, tanker, historikk og alarmer
+	RoleOperator = "operator" // + skrive tags, styre gjæringer, kvittere alarmer
+	RoleAdmin    = "admin"    // + administrere brukere og tokens
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUnauthenticated    = errors.New("invalid or expired token")
+	ErrUnknownUser        = errors.New("unknown user")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidRole        = errors.New("invalid role (viewer, operator or admin)")
+	ErrUnknownToken       = errors.New("unknown token")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+)
+
+// User er en innloggingskonto.
+type User struct {
+	ID           int64     `db:"id" json:"id"`
+	Username     string    `db:"username" json:"username"`
+	PasswordHash string    `db:"password_hash" json:"-"`
+	Role         string    `db:"role" json:"role"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// Token er et API-token. Selve tokenet vises bare én gang, ved opprettelse.
+type Token struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	Role       string     `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	return roleRank(role) > 0
+}
+
+// Allows reports whether a user with role have may do what need requires.
+func Allows(have, need string) bool {
+	return roleRank(have) >= roleRank(need) && roleRank(have) > 0
+}
+
+func roleRank(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+type ctxKey struct{}
+
+// WithUser returnerer en context med den innloggede brukeren.
+func WithUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, ctxKey{}, u)
+}
+
+// UserFromContext returnerer brukeren satt av WithUser, eller nil.
+func UserFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(ctxKey{}).(*User)
+	return u
+}
@@ -1,8 +1,225 @@
-package models
+package brew
 
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+)
+
+// TankTags er node-ID-ene som hører til én tank.
+type TankTags struct {
+	Temperature string `json:"temperature"`
+	Cooling     string `json:"cooling"`
+	Heater      string `json:"heater"`
+	Gravity     string `json:"gravity,omitempty"`
+}
+
+// Tank er live-tilstanden til én gjæringstank.
 type Tank struct {
-	Name        string
-	Temperature float64
-	Setpoint    float64
-	HeaterOn    bool
+	No          int       `json:"no"`
+	Name        string    `json:"name"`
+	Temperature *float64  `json:"temperature"`
+	Setpoint    *float64  `json:"setpoint"`
+	CoolingOn   bool      `json:"cooling_on"`
+	HeaterOn    bool      `json:"heater_on"`
+	Gravity     *float64  `json:"gravity,omitempty"`
+	GravityAt   time.Time `json:"gravity_at,omitempty"` // når gravity-taggen sist ble målt
+	UpdatedAt   time.Time `json:"updated_at"`
+	Tags        TankTags  `json:"tags"`
+}
+
+// Tanks holder alle konfigurerte tanker og oppdaterer dem fra tag-verdier.
+type Tanks struct {
+	mu        sync.RWMutex
+	tanks     map[int]*Tank
+	byNode    map[string][]*Tank
+	listeners []func(Tank)
+}
+
+// NewTanks bygger tankene fra config. resolve gjør tag-referanser om til node-ID.
+func NewTanks(cfgs []config.TankConfig, resolve func(string) string) *Tanks {
+	ts := &Tanks{
+		tanks:  make(map[int]*Tank),
+		byNode: make(map[string][]*Tank),
+	}
+
+	for _, c := range cfgs {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("Tank %d", c.No)
+		}
+
+		t := &Tank{
+			No:   c.No,
+			Name: name,
+			Tags: TankTags{
+				Temperature: resolve(c.TemperatureTag),
+				Cooling:     resolve(c.CoolingTag),
+				Heater:      resolve(c.HeaterTag),
+			},
+		}
+		if c.GravityTag != "" {
+			t.Tags.Gravity = resolve(c.GravityTag)
+		}
+
+		ts.tanks[t.No] = t
+		for _, node := range []string{t.Tags.Temperature, t.Tags.Cooling, t.Tags.Heater, t.Tags.Gravity} {
+			if node != "" {
+				ts.byNode[node] = append(ts.byNode[node], t)
+			}
+		}
+	}
+
+	return ts
+}
+
+// OnChange registrerer en funksjon som kalles hver gang en tank endres.
+func (ts *Tanks) OnChange(fn func(Tank)) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.listeners = append(ts.listeners, fn)
+}
+
+// Get returnerer en kopi av tanken.
+func (ts *Tanks) Get(no int) (Tank, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	t, ok := ts.tanks[no]
+	if !ok {
+		return Tank{}, false
+	}
+	return *t, true
+}
+
+// List returnerer alle tanker sortert på nummer.
+func (ts *Tanks) List() []Tank {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	out := make([]Tank, 0, len(ts.tanks))
+	for _, t := range ts.tanks {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].No < out[j].No })
+	return out
+}
+
+// Update legger en tag-verdi inn i tankene som bruker noden. at er når
+// verdien ble målt (kildens tidsstempel).
+func (ts *Tanks) Update(nodeID string, value interface{}, at time.Time) {
+	ts.mu.Lock()
+	var changed []Tank
+	for _, t := range ts.byNode[nodeID] {
+		switch nodeID {
+		case t.Tags.Temperature:
+			if f, ok := ToFloat(value); ok {
+				t.Temperature = &f
+			}
+		case t.Tags.Gravity:
+			if f, ok := ToFloat(value); ok {
+				t.Gravity = &f
+				t.GravityAt = at
+			}
+		case t.Tags.Cooling:
+			t.CoolingOn = toBool(value)
+		case t.Tags.Heater:
+			t.HeaterOn = toBool(value)
+		}
+		t.UpdatedAt = time.Now()
+		changed = append(changed, *t)
+	}
+	ts.mu.Unlock()
+
+	ts.notify(changed...)
+}
+
+// SetSetpoint settes av gjæringsmotoren; nil betyr ingen aktiv regulering.
+func (ts *Tanks) SetSetpoint(no int, setpoint *float64) {
+	ts.mu.Lock()
+	t, ok := ts.tanks[no]
+	if !ok || sameFloat(t.Setpoint, setpoint) {
+		ts.mu.Unlock()
+		return
+	}
+	t.Setpoint = setpoint
+	t.UpdatedAt = time.Now()
+	snapshot := *t
+	ts.mu.Unlock()
+
+	ts.notify(snapshot)
+}
+
+func (ts *Tanks) notify(tanks ...Tank) {
+	if len(tanks) == 0 {
+		return
+	}
+	ts.mu.RLock()
+	listeners := ts.listeners
+	ts.mu.RUnlock()
+
+	for _, t := range tanks {
+		for _, fn := range listeners {
+			fn(t)
+		}
+	}
+}
+
+func sameFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ToFloat konverterer numeriske OPC UA-verdier til float64.
+func ToFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int8:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	default:
+		return 0, false
+	}
+}
+
+// Numeric er ToFloat som også godtar bool (0/1).
+func Numeric(v interface{}) (float64, bool) {
+	if b, ok := v.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	return ToFloat(v)
+}
+
+func toBool(v interface{}) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	f, ok := ToFloat(v)
+	return ok && f != 0
 }
@@ -31,7 +31,7 @@ func (c *Client) FetchBatch(batchID string) (*BrewfatherBatch, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("brewfather returned %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var batch BrewfatherBatch
@@ -68,7 +68,7 @@ func (c *Client) FetchBatches() ([]BrewfatherBatch, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("brewfather returned %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var batches []BrewfatherBatch
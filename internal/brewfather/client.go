@@ -1,6 +1,11 @@
 package brewfather
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/MrBoggi/goTOV/internal/metrics"
+)
 
 // baseURL is the root for all Brewfather v2 API calls.
 const baseURL = "https://api.brewfather.app/v2"
@@ -12,11 +17,23 @@ type Client struct {
 	HTTP   *http.Client
 }
 
-// NewClient constructs a new Brewfather client with a default http.Client.
+// NewClient constructs a new Brewfather client. Request latency is recorded
+// in the gotov_brewfather_request_duration_seconds metric.
 func NewClient(userID, apiKey string) *Client {
 	return &Client{
 		UserID: userID,
 		APIKey: apiKey,
-		HTTP:   &http.Client{},
+		HTTP:   &http.Client{Transport: metrics.InstrumentBrewfather(nil)},
 	}
 }
+
+// StatusError is returned when Brewfather answers with a non-200 status.
+// Body is the raw response and may contain details that should only be logged.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("brewfather returned %d: %s", e.StatusCode, e.Body)
+}
@@ -38,7 +38,7 @@ func (c *Client) ListRecipes() ([]RecipeListItem, error) {
 
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("brewfather returned %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var list []RecipeListItem
@@ -4,6 +4,14 @@ import (
 	"fmt"
 
 	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/rs/zerolog"
+)
+
+// Kilder for fermentation.SQLiteStore.ImportPlan. Planens RecipeID er
+// batch- eller oppskrifts-ID-en i Brewfather.
+const (
+	PlanSourceBatch  = "brewfather:batch"
+	PlanSourceRecipe = "brewfather:recipe"
 )
 
 //
@@ -12,19 +20,19 @@ import (
 
 // ExtractFermentationPlan – legacy wrapper
 func ExtractFermentationPlan(recipe *BrewfatherRecipe) (*fermentation.FermentationPlan, error) {
-	return ExtractFermentationPlanFromRecipe(recipe)
+	return ExtractFermentationPlanFromRecipe(recipe, zerolog.Nop())
 }
 
 //
 // 2) RECIPE → FERMENTATION PLAN
 //
 
-func ExtractFermentationPlanFromRecipe(recipe *BrewfatherRecipe) (*fermentation.FermentationPlan, error) {
+func ExtractFermentationPlanFromRecipe(recipe *BrewfatherRecipe, log zerolog.Logger) (*fermentation.FermentationPlan, error) {
 	if recipe == nil {
 		return nil, fmt.Errorf("nil recipe")
 	}
 
-	steps := convertSteps(recipe.Fermentation.Steps)
+	steps := convertSteps(recipe.Fermentation.Steps, log.With().Str("recipe_id", recipe.ID).Logger())
 
 	plan := &fermentation.FermentationPlan{
 		Name:       recipe.Name,
@@ -40,7 +48,7 @@ func ExtractFermentationPlanFromRecipe(recipe *BrewfatherRecipe) (*fermentation.
 // 3) BATCH → FERMENTATION PLAN
 //
 
-func ExtractFermentationPlanFromBatch(batch *BrewfatherBatch) (*fermentation.FermentationPlan, error) {
+func ExtractFermentationPlanFromBatch(batch *BrewfatherBatch, log zerolog.Logger) (*fermentation.FermentationPlan, error) {
 	if batch == nil {
 		return nil, fmt.Errorf("nil batch")
 	}
@@ -57,37 +65,9 @@ func ExtractFermentationPlanFromBatch(batch *BrewfatherBatch) (*fermentation.Fer
 		RecipeID: batch.ID,
 	}
 
-	out := make([]fermentation.FermentationStep, 0, len(steps))
-
-	for i, s := range steps {
-		// Brewfather bruker "stepTemp" og "stepTime" på batch recipe
-		var hours float64
-		switch s.TimeUnit {
-		case "day", "days":
-			hours = s.Time * 24
-		case "hour", "hours":
-			hours = s.Time
-		default:
-			// fallback (batch recipe har stepTime)
-			if s.Time > 0 {
-				hours = s.Time
-			} else if s.StepTime > 0 {
-				hours = float64(s.StepTime)
-			}
-		}
-
-		temp := s.Temperature
-		if temp == 0 && s.StepTemp > 0 {
-			temp = s.StepTemp
-		}
-
-		out = append(out, fermentation.FermentationStep{
-			StepNumber:    i + 1,
-			Temperature:   temp,
-			DurationHours: hours,
-			Type:          s.Type,
-			Description:   s.Description,
-		})
+	out := convertSteps(steps, log.With().Str("batch_id", batch.ID).Logger())
+	for i := range out {
+		out[i].StepNumber = i + 1
 	}
 
 	fp.Steps = out
@@ -99,25 +79,43 @@ func ExtractFermentationPlanFromBatch(batch *BrewfatherBatch) (*fermentation.Fer
 // 4) STEP CONVERTERS
 //
 
-// Konverter fra BrewfatherRecipe.Fermentation.Steps til backend-format
-func convertSteps(in []FermentationStep) []fermentation.FermentationStep {
+// Konverter Brewfather-steg (oppskrift eller batch-snapshot) til backend-format.
+// Tid og rampe tolkes i samme enhet: timeUnit hvis den er satt, ellers timer
+// (som før rampene kom).
+func convertSteps(in []FermentationStep, log zerolog.Logger) []fermentation.FermentationStep {
 	out := make([]fermentation.FermentationStep, 0, len(in))
 
-	for _, s := range in {
-		var hours float64
-		switch s.TimeUnit {
-		case "day", "days":
-			hours = s.Time * 24
-		case "hour", "hours":
-			hours = s.Time
-		default:
-			hours = s.Time
+	for i, s := range in {
+		perUnit := 1.0
+		if s.TimeUnit == "day" || s.TimeUnit == "days" {
+			perUnit = 24
+		}
+
+		// Brewfather bruker "stepTemp" og "stepTime" på batch recipe
+		hours := s.Time * perUnit
+		if hours == 0 && s.StepTime > 0 {
+			hours = s.StepTime * perUnit
+		}
+		temp := s.Temperature
+		if temp == 0 && s.StepTemp > 0 {
+			temp = s.StepTemp
+		}
+
+		ramp := rampHours(s, perUnit)
+		if ramp > hours {
+			log.Warn().
+				Int("step", i+1).
+				Float64("ramp_hours", ramp).
+				Float64("duration_hours", hours).
+				Msg("⚠️ Brewfather ramp is longer than the step, shortening it to the step duration")
+			ramp = hours
 		}
 
 		out = append(out, fermentation.FermentationStep{
 			StepNumber:    s.Step,
-			Temperature:   s.Temperature,
+			Temperature:   temp,
 			DurationHours: hours,
+			RampHours:     ramp,
 			Description:   s.Description,
 			Type:          s.Type,
 		})
@@ -125,3 +123,11 @@ func convertSteps(in []FermentationStep) []fermentation.FermentationStep {
 
 	return out
 }
+
+// rampHours gir rampen i timer; perUnit er timer per enhet rampen er oppgitt i.
+func rampHours(s FermentationStep, perUnit float64) float64 {
+	if s.Ramp == nil || *s.Ramp <= 0 {
+		return 0
+	}
+	return *s.Ramp * perUnit
+}
@@ -0,0 +1,99 @@
+package brewfather
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func TestConvertSteps(t *testing.T) {
+	tests := []struct {
+		name        string
+		step        FermentationStep
+		temp, hours float64
+		ramp        float64
+	}{
+		{"days", FermentationStep{Temperature: 18, Time: 3, TimeUnit: "days", Ramp: ptr(1)}, 18, 72, 24},
+		{"day", FermentationStep{Temperature: 18, Time: 2, TimeUnit: "day", Ramp: ptr(0.5)}, 18, 48, 12},
+		{"hours", FermentationStep{Temperature: 4, Time: 36, TimeUnit: "hours", Ramp: ptr(12)}, 4, 36, 12},
+		{"no unit is hours", FermentationStep{Temperature: 20, Time: 48, Ramp: ptr(6)}, 20, 48, 6},
+		{"snapshot fields", FermentationStep{StepTemp: 19, StepTime: 2, TimeUnit: "days"}, 19, 48, 0},
+		{"snapshot without unit", FermentationStep{StepTemp: 19, StepTime: 10}, 19, 10, 0},
+		{"zero ramp", FermentationStep{Temperature: 18, Time: 1, TimeUnit: "days", Ramp: ptr(0)}, 18, 24, 0},
+		{"negative ramp", FermentationStep{Temperature: 18, Time: 1, TimeUnit: "days", Ramp: ptr(-1)}, 18, 24, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := convertSteps([]FermentationStep{tt.step}, zerolog.Nop())
+			if len(out) != 1 {
+				t.Fatalf("got %d steps, want 1", len(out))
+			}
+			got := out[0]
+			if got.Temperature != tt.temp || got.DurationHours != tt.hours || got.RampHours != tt.ramp {
+				t.Errorf("step = %g °C %g h ramp %g h, want %g °C %g h ramp %g h",
+					got.Temperature, got.DurationHours, got.RampHours, tt.temp, tt.hours, tt.ramp)
+			}
+		})
+	}
+}
+
+func TestConvertStepsClampsRamp(t *testing.T) {
+	var buf bytes.Buffer
+	log := zerolog.New(&buf)
+
+	out := convertSteps([]FermentationStep{
+		{Temperature: 18, Time: 2, TimeUnit: "days", Ramp: ptr(1)},
+		{Temperature: 2, Time: 1, TimeUnit: "days", Ramp: ptr(3)},
+	}, log)
+
+	if out[0].RampHours != 24 {
+		t.Errorf("first ramp = %g h, want 24", out[0].RampHours)
+	}
+	if out[1].RampHours != 24 || out[1].DurationHours != 24 {
+		t.Errorf("second step = %g h ramp %g h, want ramp clamped to 24 h", out[1].DurationHours, out[1].RampHours)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("log = %q, want one warning", buf.String())
+	}
+	for _, want := range []string{`"level":"warn"`, `"step":2`, `"ramp_hours":72`, `"duration_hours":24`} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("warning %s does not contain %s", lines[0], want)
+		}
+	}
+}
+
+func TestExtractFermentationPlanFromBatch(t *testing.T) {
+	batch := &BrewfatherBatch{ID: "b1", Name: "Batch 12"}
+	if _, err := ExtractFermentationPlanFromBatch(batch, zerolog.Nop()); err == nil {
+		t.Error("batch without steps should fail")
+	}
+	if _, err := ExtractFermentationPlanFromBatch(nil, zerolog.Nop()); err == nil {
+		t.Error("nil batch should fail")
+	}
+
+	batch.Recipe.Fermentation.Steps = []FermentationStep{
+		{Step: 7, StepTemp: 18, StepTime: 10, TimeUnit: "days"},
+		{Step: 3, StepTemp: 2, StepTime: 3, TimeUnit: "days", Ramp: ptr(1)},
+	}
+	plan, err := ExtractFermentationPlanFromBatch(batch, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.RecipeID != "b1" || plan.TotalSteps != 2 {
+		t.Fatalf("plan = %+v, want batch b1 with 2 steps", plan)
+	}
+	for i, s := range plan.Steps {
+		if s.StepNumber != i+1 {
+			t.Errorf("step %d numbered %d, want %d", i, s.StepNumber, i+1)
+		}
+	}
+	if s := plan.Steps[1]; s.DurationHours != 72 || s.RampHours != 24 || s.Temperature != 2 {
+		t.Errorf("cold crash step = %+v, want 72 h with 24 h ramp to 2 °C", s)
+	}
+}
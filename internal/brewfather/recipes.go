@@ -27,7 +27,7 @@ func (c *Client) FetchRecipe(recipeID string) (*BrewfatherRecipe, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("brewfather returned %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var recipe BrewfatherRecipe
@@ -9,12 +9,16 @@ type FermentationStep struct {
 	Type        string  `json:"type"`
 	Temperature float64 `json:"temperature"` // optional
 	Time        float64 `json:"time"`        // optional
-	TimeUnit    string  `json:"timeUnit"`    // "day"/"hour", optional
+	TimeUnit    string  `json:"timeUnit"`    // "day"/"hour", optional; uten enhet regnes timer
 	Description string  `json:"description"`
 
 	// Recipe/batch snapshot-form (som i Postman-jsonen din)
 	StepTemp float64 `json:"stepTemp"` // °C
 	StepTime float64 `json:"stepTime"` // typisk i dager
+
+	// Rampe til stegets temperatur, i samme enhet som tiden (timer uten timeUnit).
+	// null eller 0 = ingen rampe.
+	Ramp *float64 `json:"ramp"`
 }
 
 // BrewfatherFermentation is the container for all steps.
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MrBoggi/goTOV/internal/alarm"
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/historian"
+	"github.com/MrBoggi/goTOV/internal/migrate"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/cobra"
+)
+
+// database er én SQLite-fil med sine migreringer.
+type database struct {
+	name       string
+	path       string
+	migrations []migrate.Migration
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Skjemaversjon og migrering av de lokale SQLite-databasene",
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status [database...]",
+	Short: "Vis skjemaversjon og ventende migreringer (endrer ingenting)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbs, err := selectDatabases(args)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fmt.Fprintln(w, "DATABASE\tVERSION\tNAME\tAPPLIED")
+		for _, d := range dbs {
+			if _, err := os.Stat(d.path); os.IsNotExist(err) {
+				fmt.Fprintf(w, "%s\t-\t(%s finnes ikke ennå)\t-\n", d.name, d.path)
+				continue
+			}
+			db, err := sqlx.Open("sqlite", d.path)
+			if err != nil {
+				return fmt.Errorf("open %s: %w", d.path, err)
+			}
+			states, err := migrate.Status(db, d.migrations)
+			db.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", d.name, err)
+			}
+			for _, s := range states {
+				applied := "pending"
+				if s.AppliedAt != nil {
+					applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", d.name, s.Version, s.Name, applied)
+			}
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate [database...]",
+	Short: "Kjør ventende migreringer (gjøres også automatisk ved oppstart)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbs, err := selectDatabases(args)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range dbs {
+			db, err := sqlx.Open("sqlite", d.path)
+			if err != nil {
+				return fmt.Errorf("open %s: %w", d.path, err)
+			}
+			applied, err := migrate.Up(db, d.migrations)
+			db.Close()
+			for _, m := range applied {
+				fmt.Printf("✔ %s: %d %s\n", d.name, m.Version, m.Name)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", d.name, err)
+			}
+			if len(applied) == 0 {
+				fmt.Printf("✔ %s: up to date (version %d)\n", d.name, migrate.Latest(d.migrations))
+			}
+		}
+		return nil
+	},
+}
+
+// selectDatabases gir databasene fra config, eller bare de som er navngitt.
+// Historikken er med bare når den ligger i SQLite.
+func selectDatabases(names []string) ([]database, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	all := []database{
+		{"fermentation", cfg.Fermentation.DatabasePath, fermentation.Migrations},
+		{"alarms", cfg.Alarms.DatabasePath, alarm.Migrations},
+		{"auth", cfg.Auth.DatabasePath, auth.Migrations},
+		{"audit", cfg.Audit.DatabasePath, audit.Migrations},
+	}
+	if cfg.Historian.Backend == "sqlite" {
+		all = append(all, database{"historian", cfg.Historian.DatabasePath, historian.Migrations})
+	}
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	var out []database
+	for _, name := range names {
+		found := false
+		for _, d := range all {
+			if d.name == name {
+				out = append(out, d)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown database %q (fermentation, historian, alarms, auth, audit)", name)
+		}
+	}
+	return out, nil
+}
+
+func init() {
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	rootCmd.AddCommand(dbCmd)
+}
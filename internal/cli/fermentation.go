@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 
+	"github.com/MrBoggi/goTOV/internal/audit"
 	"github.com/MrBoggi/goTOV/internal/brewfather"
 	"github.com/MrBoggi/goTOV/internal/config"
 	"github.com/MrBoggi/goTOV/internal/fermentation"
@@ -10,13 +11,18 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var fermentationImportRecipe bool
+
 var fermentationImportCmd = &cobra.Command{
 	Use:   "fermentation-import <brewfather-batch-id>",
 	Short: "Importer gjæringsprofil fra Brewfather-batch til lokal fermentasjonsdatabase",
-	Args:  cobra.ExactArgs(1),
+	Long: `Importerer gjæringsprofilen fra en Brewfather-batch (eller oppskrift med --recipe).
+Ny import av samme batch oppdaterer planen i stedet for å lage en ny, og gjør
+ingenting hvis profilen er uendret siden forrige import.`,
+	Args: cobra.ExactArgs(1),
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		batchID := args[0]
+		sourceID := args[0]
 		log := logger.New()
 
 		// 1) Last config
@@ -31,40 +37,67 @@ var fermentationImportCmd = &cobra.Command{
 		// 2) Init klient
 		bfClient := brewfather.NewClient(cfg.Brewfather.UserID, cfg.Brewfather.APIKey)
 
-		// 3) Hent batch
-		batch, err := bfClient.FetchBatch(batchID)
-		if err != nil {
-			return fmt.Errorf("fetch Brewfather batch %s: %w", batchID, err)
+		// 3) Hent batch (eller oppskrift) og konverter til fermentasjonsplan
+		var plan *fermentation.FermentationPlan
+		source := brewfather.PlanSourceBatch
+		if fermentationImportRecipe {
+			source = brewfather.PlanSourceRecipe
+			recipe, err := bfClient.FetchRecipe(sourceID)
+			if err != nil {
+				return fmt.Errorf("fetch Brewfather recipe %s: %w", sourceID, err)
+			}
+			plan, err = brewfather.ExtractFermentationPlanFromRecipe(recipe, log)
+			if err != nil {
+				return fmt.Errorf("extract fermentation plan: %w", err)
+			}
+		} else {
+			batch, err := bfClient.FetchBatch(sourceID)
+			if err != nil {
+				return fmt.Errorf("fetch Brewfather batch %s: %w", sourceID, err)
+			}
+			plan, err = brewfather.ExtractFermentationPlanFromBatch(batch, log)
+			if err != nil {
+				return fmt.Errorf("extract fermentation plan: %w", err)
+			}
 		}
 
-		// 4) Konverter til fermentasjonsplan
-		plan, err := brewfather.ExtractFermentationPlanFromBatch(batch)
+		// 4) Lagre i lokal SQLite – oppretter, oppdaterer eller lar være
+		store, err := fermentation.NewSQLiteStore(cfg.Fermentation.DatabasePath)
 		if err != nil {
-			return fmt.Errorf("extract fermentation plan: %w", err)
+			return fmt.Errorf("open fermentation db %s: %w", cfg.Fermentation.DatabasePath, err)
 		}
+		defer store.Close()
 
-		// 5) Lagre i lokal SQLite
-		const dbPath = "data/fermentation.db"
-		store, err := fermentation.NewSQLiteStore(dbPath)
+		ctx, auditLog, closeAudit, err := openAudit()
 		if err != nil {
-			return fmt.Errorf("open fermentation db %s: %w", dbPath, err)
+			return err
 		}
-		defer store.Close()
+		defer closeAudit()
 
-		if _, err := store.SavePlan(*plan); err != nil {
+		res, err := store.ImportPlan(source, *plan)
+		switch {
+		case err != nil:
+			auditLog.Record(ctx, audit.ActionPlanImport, sourceID, nil, plan, auditError(err))
 			return fmt.Errorf("save fermentation plan: %w", err)
+		case res.Status == fermentation.ImportCreated:
+			auditLog.Record(ctx, audit.ActionPlanImport, planTarget(res.Plan.ID), nil, res.Plan, nil)
+		case res.Status == fermentation.ImportUpdated:
+			auditLog.Record(ctx, audit.ActionPlanImport, planTarget(res.Plan.ID), res.Previous, res.Plan, nil)
 		}
 
 		log.Info().
-			Str("batch_id", batchID).
-			Str("name", plan.Name).
-			Int("steps", plan.TotalSteps).
-			Msg("✅ Fermentation plan imported successfully")
+			Str("source_id", sourceID).
+			Int64("plan_id", res.Plan.ID).
+			Str("name", res.Plan.Name).
+			Int("steps", res.Plan.TotalSteps).
+			Str("result", res.Status).
+			Msg("✅ Fermentation plan imported")
 
 		return nil
 	},
 }
 
 func init() {
+	fermentationImportCmd.Flags().BoolVar(&fermentationImportRecipe, "recipe", false, "ID-en er en Brewfather-oppskrift, ikke en batch")
 	rootCmd.AddCommand(fermentationImportCmd)
 }
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"text/tabwriter"
 
+	"github.com/MrBoggi/goTOV/internal/audit"
 	"github.com/MrBoggi/goTOV/internal/fermentation"
 	"github.com/spf13/cobra"
 )
@@ -89,7 +90,15 @@ var fermentationDBClearCmd = &cobra.Command{
 		}
 		defer store.Close()
 
-		if err := store.Clear(); err != nil {
+		ctx, auditLog, closeAudit, err := openAudit()
+		if err != nil {
+			return err
+		}
+		defer closeAudit()
+
+		err = store.Clear()
+		auditLog.Record(ctx, audit.ActionPlanDelete, "all plans", nil, nil, err)
+		if err != nil {
 			return fmt.Errorf("clear db: %w", err)
 		}
 
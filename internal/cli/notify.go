@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/logger"
+	"github.com/MrBoggi/goTOV/internal/notify"
+	"github.com/spf13/cobra"
+)
+
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Varslingskanaler",
+}
+
+var notifyTestCmd = &cobra.Command{
+	Use:   "test [channel]",
+	Short: "Send en testmelding til én eller alle varslingskanaler",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logger.New()
+
+		cfg, err := config.Load("")
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		if len(cfg.Notifications.Channels) == 0 {
+			return fmt.Errorf("no notification channels in config.yaml")
+		}
+
+		n, err := notify.New(log, cfg.Notifications)
+		if err != nil {
+			return err
+		}
+
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if err := n.SendTest(context.Background(), name); err != nil {
+			return fmt.Errorf("send test notification: %w", err)
+		}
+
+		log.Info().Str("channel", name).Msg("🔔 Test notification sent")
+		return nil
+	},
+}
+
+func init() {
+	notifyCmd.AddCommand(notifyTestCmd)
+	rootCmd.AddCommand(notifyCmd)
+}
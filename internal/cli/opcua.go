@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/logger"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	browseOpts opcua.BrowseOptions
+	browseYAML bool
+)
+
+var opcuaCmd = &cobra.Command{
+	Use:   "opcua",
+	Short: "Verktøy mot OPC UA-serveren",
+}
+
+var opcuaBrowseCmd = &cobra.Command{
+	Use:   "browse [node-id]",
+	Short: "Bla gjennom adresserommet (standard: Objects), f.eks. browse \"ns=4;s=MAIN\"",
+	Long: `Lister objekter og variabler under en node med datatype og tilgang.
+Med --yaml skrives variablene som tags: for config.yaml.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Logg til stderr så --yaml kan pipes rett inn i en fil
+		log := logger.New().Output(zerolog.ConsoleWriter{Out: os.Stderr}).Level(zerolog.WarnLevel)
+
+		cfg, err := config.Load("")
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		tags, err := opcua.NewTagMap(cfg.Tags, cfg.OPCUA.DefaultNamespace)
+		if err != nil {
+			return err
+		}
+		client, err := opcua.NewClient(cfg.OPCUA, tags, log)
+		if err != nil {
+			return err
+		}
+		if err := client.Connect(); err != nil {
+			return fmt.Errorf("connect: %w", err)
+		}
+		defer client.Close()
+
+		start := ""
+		if len(args) == 1 {
+			start = args[0]
+		}
+		opts := browseOpts
+		if browseYAML {
+			opts.Variables = true
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		nodes, err := client.Browse(ctx, start, opts)
+		if err != nil {
+			return err
+		}
+
+		if browseYAML {
+			return writeTagYAML(nodes)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tCLASS\tTYPE\tACCESS\tNODE ID")
+		for _, n := range nodes {
+			fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\n",
+				strings.Repeat("  ", n.Depth-1), n.BrowseName, n.NodeClass, dash(n.DataType), dash(n.AccessLevel), n.NodeID)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// tagYAML er de feltene i config.TagConfig browse kan fylle ut.
+type tagYAML struct {
+	Name     string `yaml:"name"`
+	NodeID   string `yaml:"node_id"`
+	DataType string `yaml:"data_type,omitempty"`
+	Writable bool   `yaml:"writable,omitempty"`
+}
+
+// writeTagYAML skriver variablene som tags:. Navnet er browse-navnet, eller
+// hele stien (med _) når flere noder har samme navn.
+func writeTagYAML(nodes []opcua.BrowseNode) error {
+	count := make(map[string]int)
+	for _, n := range nodes {
+		count[n.BrowseName]++
+	}
+
+	out := struct {
+		Tags []tagYAML `yaml:"tags"`
+	}{}
+	for _, n := range nodes {
+		name := n.BrowseName
+		if count[name] > 1 {
+			name = strings.ReplaceAll(n.Path, ".", "_")
+		}
+		out.Tags = append(out.Tags, tagYAML{
+			Name:     name,
+			NodeID:   n.NodeID,
+			DataType: n.ConfigDataType(),
+			Writable: n.Writable(),
+		})
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(out)
+}
+
+func init() {
+	f := opcuaBrowseCmd.Flags()
+	f.IntVar(&browseOpts.Depth, "depth", opcua.DefaultBrowseDepth, fmt.Sprintf("antall nivåer (maks %d)", opcua.MaxBrowseDepth))
+	f.StringVar(&browseOpts.Filter, "filter", "", "glob mot stien, f.eks. \"MAIN.fbUA.*Temp\"")
+	f.BoolVar(&browseOpts.Variables, "variables", false, "bare variabler")
+	f.BoolVar(&browseYAML, "yaml", false, "skriv variablene som tags: for config.yaml")
+	opcuaCmd.AddCommand(opcuaBrowseCmd)
+	rootCmd.AddCommand(opcuaCmd)
+}
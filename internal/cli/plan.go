@@ -0,0 +1,493 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planSteps    []string
+	planName     string
+	planRecipeID string
+
+	stepPosition int
+	stepTemp     float64
+	stepHours    float64
+	stepRamp     float64
+	stepDesc     string
+	stepType     string
+
+	stepGravityBelow     float64
+	stepAttenuationAbove float64
+	stepGravityStable    float64
+	stepStableHours      float64
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Opprett og rediger fermenteringsplaner lokalt",
+	Long: `Endringer i en plan som kjører på en tank tas i bruk av serveren innen
+fermentation.state_persist_interval. Steg som allerede er gjennomført kan ikke endres.`,
+}
+
+var planListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List alle fermenteringsplaner",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openPlanStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		plans, err := store.ListPlans()
+		if err != nil {
+			return fmt.Errorf("list plans: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tRECIPE\tSOURCE\tSTEPS")
+		for _, p := range plans {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", p.ID, p.Name, dash(p.RecipeID), dash(p.Source), p.TotalSteps)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var planShowCmd = &cobra.Command{
+	Use:   "show <plan_id>",
+	Short: "Vis en plan med alle steg",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parsePlanID(args[0])
+		if err != nil {
+			return err
+		}
+		store, err := openPlanStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		plan, err := store.GetPlan(id)
+		if err != nil {
+			return err
+		}
+		printPlan(plan)
+		return nil
+	},
+}
+
+var planCreateCmd = &cobra.Command{
+	Use:     "create <name> --step <temp:timer[:beskrivelse]>...",
+	Short:   "Opprett en ny plan",
+	Example: `  gotov plan create "Pils" --step 10:240:Primær --step 14:48:Diacetylrast --step 1:72:Cold crash`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan := fermentation.FermentationPlan{Name: args[0], RecipeID: planRecipeID}
+		for _, arg := range planSteps {
+			step, err := parseStep(arg)
+			if err != nil {
+				return err
+			}
+			plan.Steps = append(plan.Steps, step)
+		}
+		plan.Renumber()
+		if err := fermentation.ValidatePlan(plan); err != nil {
+			return err
+		}
+
+		store, err := openPlanStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		ctx, auditLog, closeAudit, err := openAudit()
+		if err != nil {
+			return err
+		}
+		defer closeAudit()
+
+		plan.ID, err = store.SavePlan(plan)
+		auditLog.Record(ctx, audit.ActionPlanCreate, planTarget(plan.ID), nil, plan, err)
+		if err != nil {
+			return fmt.Errorf("save plan: %w", err)
+		}
+		fmt.Printf("✔ Plan %d created (%d steps)\n", plan.ID, len(plan.Steps))
+		return nil
+	},
+}
+
+var planUpdateCmd = &cobra.Command{
+	Use:   "update <plan_id> [--name <navn>] [--recipe-id <id>]",
+	Short: "Endre navn eller recipe-ID på en plan",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editPlan(args[0], func(p *fermentation.FermentationPlan) error {
+			if cmd.Flags().Changed("name") {
+				p.Name = planName
+			}
+			if cmd.Flags().Changed("recipe-id") {
+				p.RecipeID = planRecipeID
+			}
+			return nil
+		})
+	},
+}
+
+var planDeleteCmd = &cobra.Command{
+	Use:   "delete <plan_id>",
+	Short: "Slett en plan (ikke mulig mens den kjører)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parsePlanID(args[0])
+		if err != nil {
+			return err
+		}
+		store, err := openPlanStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		ctx, auditLog, closeAudit, err := openAudit()
+		if err != nil {
+			return err
+		}
+		defer closeAudit()
+
+		plan, err := store.GetPlan(id)
+		if err != nil {
+			return err
+		}
+		err = store.DeletePlan(id)
+		auditLog.Record(ctx, audit.ActionPlanDelete, planTarget(id), plan, nil, auditError(err))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✔ Plan %d deleted\n", id)
+		return nil
+	},
+}
+
+var planDuplicateCmd = &cobra.Command{
+	Use:   "duplicate <plan_id> [--name <navn>]",
+	Short: "Kopier en plan, f.eks. for å justere den uten å røre originalen",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parsePlanID(args[0])
+		if err != nil {
+			return err
+		}
+		store, err := openPlanStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		ctx, auditLog, closeAudit, err := openAudit()
+		if err != nil {
+			return err
+		}
+		defer closeAudit()
+
+		orig, err := store.GetPlan(id)
+		if err != nil {
+			return err
+		}
+		plan := orig.Copy()
+		plan.ID, plan.RecipeID, plan.Source, plan.Name = 0, "", "", planName
+		if plan.Name == "" {
+			plan.Name = orig.Name + " (kopi)"
+		}
+
+		plan.ID, err = store.SavePlan(plan)
+		auditLog.Record(ctx, audit.ActionPlanCreate, planTarget(plan.ID), nil, plan, err)
+		if err != nil {
+			return fmt.Errorf("save plan: %w", err)
+		}
+		fmt.Printf("✔ Plan %d copied to plan %d (%s)\n", id, plan.ID, plan.Name)
+		return nil
+	},
+}
+
+var planStepCmd = &cobra.Command{
+	Use:   "step",
+	Short: "Legg til, endre, flytt eller slett steg i en plan",
+}
+
+var planStepAddCmd = &cobra.Command{
+	Use:   "add <plan_id> --temp <°C> --hours <timer>",
+	Short: "Sett inn et steg (sist, eller på --position)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("temp") || !cmd.Flags().Changed("hours") {
+			return fmt.Errorf("--temp and --hours are required")
+		}
+		return editPlan(args[0], func(p *fermentation.FermentationPlan) error {
+			return p.InsertStep(stepPosition, fermentation.FermentationStep{
+				Temperature:   stepTemp,
+				DurationHours: stepHours,
+				RampHours:     stepRamp,
+				Description:   stepDesc,
+				Type:          stepType,
+
+				GravityBelow:       stepGravityBelow,
+				AttenuationAbove:   stepAttenuationAbove,
+				GravityStable:      stepGravityStable,
+				GravityStableHours: stepStableHours,
+			})
+		})
+	},
+}
+
+var planStepEditCmd = &cobra.Command{
+	Use:   "edit <plan_id> <step> [--temp] [--hours] [--ramp] [--desc] [--type] [--gravity-below] [--attenuation-above] [--gravity-stable --stable-hours]",
+	Short: "Endre et steg; felt som ikke oppgis beholdes",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := parseStepNumber(args[1])
+		if err != nil {
+			return err
+		}
+		return editPlan(args[0], func(p *fermentation.FermentationPlan) error {
+			if n < 1 || n > len(p.Steps) {
+				return fmt.Errorf("%w: %d (plan has %d steps)", fermentation.ErrInvalidStep, n, len(p.Steps))
+			}
+			step := p.Steps[n-1]
+			f := cmd.Flags()
+			if f.Changed("temp") {
+				step.Temperature = stepTemp
+			}
+			if f.Changed("hours") {
+				step.DurationHours = stepHours
+			}
+			if f.Changed("ramp") {
+				step.RampHours = stepRamp
+			}
+			if f.Changed("desc") {
+				step.Description = stepDesc
+			}
+			if f.Changed("type") {
+				step.Type = stepType
+			}
+			if f.Changed("gravity-below") {
+				step.GravityBelow = stepGravityBelow
+			}
+			if f.Changed("attenuation-above") {
+				step.AttenuationAbove = stepAttenuationAbove
+			}
+			if f.Changed("gravity-stable") {
+				step.GravityStable = stepGravityStable
+			}
+			if f.Changed("stable-hours") {
+				step.GravityStableHours = stepStableHours
+			}
+			return p.ReplaceStep(n, step)
+		})
+	},
+}
+
+var planStepMoveCmd = &cobra.Command{
+	Use:   "move <plan_id> <step> <to>",
+	Short: "Flytt et steg til en ny plass",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := parseStepNumber(args[1])
+		if err != nil {
+			return err
+		}
+		to, err := parseStepNumber(args[2])
+		if err != nil {
+			return err
+		}
+		return editPlan(args[0], func(p *fermentation.FermentationPlan) error {
+			return p.MoveStep(from, to)
+		})
+	},
+}
+
+var planStepDeleteCmd = &cobra.Command{
+	Use:   "delete <plan_id> <step>",
+	Short: "Slett et steg",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := parseStepNumber(args[1])
+		if err != nil {
+			return err
+		}
+		return editPlan(args[0], func(p *fermentation.FermentationPlan) error {
+			return p.DeleteStep(n)
+		})
+	},
+}
+
+// editPlan laster planen, kjører fn på en kopi, validerer, lagrer og logger
+// endringen med planen før og etter.
+func editPlan(arg string, fn func(*fermentation.FermentationPlan) error) error {
+	id, err := parsePlanID(arg)
+	if err != nil {
+		return err
+	}
+	store, err := openPlanStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	ctx, auditLog, closeAudit, err := openAudit()
+	if err != nil {
+		return err
+	}
+	defer closeAudit()
+
+	before, err := store.GetPlan(id)
+	if err != nil {
+		return err
+	}
+	after := before.Copy()
+	err = fn(&after)
+	if err == nil {
+		err = fermentation.ValidatePlan(after)
+	}
+	if err == nil {
+		var version int
+		if version, err = store.UpdatePlan(after); err == nil {
+			after.Version = version
+		}
+	}
+	auditLog.Record(ctx, audit.ActionPlanUpdate, planTarget(id), before, after, auditError(err))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✔ Plan %d updated\n", id)
+	printPlan(&after)
+	return nil
+}
+
+func openPlanStore() (*fermentation.SQLiteStore, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	store, err := fermentation.NewSQLiteStore(cfg.Fermentation.DatabasePath)
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	return store, nil
+}
+
+func printPlan(p *fermentation.FermentationPlan) {
+	fmt.Printf("%s (plan %d, recipe %s)\n", p.Name, p.ID, dash(p.RecipeID))
+	w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tTEMP (C)\tHOURS\tRAMP\tUNTIL\tTYPE\tDESCRIPTION")
+	for _, s := range p.Steps {
+		fmt.Fprintf(w, "%d\t%.1f\t%.1f\t%.1f\t%s\t%s\t%s\n",
+			s.StepNumber, s.Temperature, s.DurationHours, s.RampHours, dash(gravityCondition(s)), dash(s.Type), dash(s.Description))
+	}
+	w.Flush()
+}
+
+// gravityCondition viser stegets gravity-betingelser, f.eks. "SG≤1.012, ≥75%, ±0.001/48t".
+func gravityCondition(s fermentation.FermentationStep) string {
+	var parts []string
+	if s.GravityBelow > 0 {
+		parts = append(parts, fmt.Sprintf("SG≤%.3f", s.GravityBelow))
+	}
+	if s.AttenuationAbove > 0 {
+		parts = append(parts, fmt.Sprintf("≥%g%%", s.AttenuationAbove))
+	}
+	if s.GravityStable > 0 {
+		parts = append(parts, fmt.Sprintf("±%g/%gt", s.GravityStable, s.GravityStableHours))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseStep tolker "temp:timer[:beskrivelse]", f.eks. "18:72:Primær".
+func parseStep(arg string) (fermentation.FermentationStep, error) {
+	parts := strings.SplitN(arg, ":", 3)
+	if len(parts) < 2 {
+		return fermentation.FermentationStep{}, fmt.Errorf("invalid step %q, expected temp:hours[:description]", arg)
+	}
+	temp, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return fermentation.FermentationStep{}, fmt.Errorf("invalid temperature in step %q", arg)
+	}
+	hours, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return fermentation.FermentationStep{}, fmt.Errorf("invalid hours in step %q", arg)
+	}
+	step := fermentation.FermentationStep{Temperature: temp, DurationHours: hours}
+	if len(parts) == 3 {
+		step.Description = parts[2]
+	}
+	return step, nil
+}
+
+func parsePlanID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid plan id %q", arg)
+	}
+	return id, nil
+}
+
+func parseStepNumber(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid step number %q", arg)
+	}
+	return n, nil
+}
+
+func planTarget(id int64) string {
+	return "plan " + strconv.FormatInt(id, 10)
+}
+
+// auditError markerer valideringsfeil og planer i bruk som avvist.
+func auditError(err error) error {
+	switch {
+	case errors.Is(err, fermentation.ErrInvalidPlan),
+		errors.Is(err, fermentation.ErrInvalidStep),
+		errors.Is(err, fermentation.ErrPlanInUse),
+		errors.Is(err, fermentation.ErrPlanChanged),
+		errors.Is(err, fermentation.ErrPlanNotFound):
+		return audit.Rejected(err)
+	}
+	return err
+}
+
+func init() {
+	planCreateCmd.Flags().StringArrayVar(&planSteps, "step", nil, "steg som temp:timer[:beskrivelse], kan gjentas")
+	planCreateCmd.Flags().StringVar(&planRecipeID, "recipe-id", "", "Brewfather recipe/batch-ID planen hører til")
+
+	planUpdateCmd.Flags().StringVar(&planName, "name", "", "nytt navn")
+	planUpdateCmd.Flags().StringVar(&planRecipeID, "recipe-id", "", "ny recipe-ID (tom streng fjerner den)")
+	planDuplicateCmd.Flags().StringVar(&planName, "name", "", "navn på kopien (standard \"<navn> (kopi)\")")
+
+	for _, c := range []*cobra.Command{planStepAddCmd, planStepEditCmd} {
+		f := c.Flags()
+		f.Float64Var(&stepTemp, "temp", 0, "temperatur i °C")
+		f.Float64Var(&stepHours, "hours", 0, "varighet i timer")
+		f.Float64Var(&stepRamp, "ramp", 0, "timer å rampe fra forrige temperatur (inngår i --hours)")
+		f.StringVar(&stepDesc, "desc", "", "beskrivelse")
+		f.StringVar(&stepType, "type", "", "stegtype, f.eks. primary")
+		f.Float64Var(&stepGravityBelow, "gravity-below", 0, "ferdig når SG er på eller under denne (0 = av)")
+		f.Float64Var(&stepAttenuationAbove, "attenuation-above", 0, "ferdig når forgjæringen er minst så mange % (0 = av)")
+		f.Float64Var(&stepGravityStable, "gravity-stable", 0, "ferdig når SG har holdt seg innenfor dette i --stable-hours (0 = av)")
+		f.Float64Var(&stepStableHours, "stable-hours", 0, "timer SG må være stabil for --gravity-stable")
+	}
+	planStepAddCmd.Flags().IntVar(&stepPosition, "position", 0, "stegnummer det nye steget skal få (standard sist)")
+
+	planStepCmd.AddCommand(planStepAddCmd, planStepEditCmd, planStepMoveCmd, planStepDeleteCmd)
+	planCmd.AddCommand(planListCmd, planShowCmd, planCreateCmd, planUpdateCmd, planDeleteCmd, planDuplicateCmd, planStepCmd)
+	rootCmd.AddCommand(planCmd)
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/logger"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/MrBoggi/goTOV/internal/simulator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	simulatePort  int
+	simulateSpeed float64
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Kjør en lokal OPC UA-server med PLS-ens noder og en enkel tankmodell",
+	Long: `Starter en OPC UA-server med alle tags og tanker fra config.yaml.
+Kjøleventiler senker og varmekapper hever temperaturen i tankene.
+Pek goTØV mot den med opcua.endpoint: "opc.tcp://localhost:4840" og auth: "anonymous".`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := logger.New()
+
+		cfg, err := config.Load("")
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		if cmd.Flags().Changed("port") {
+			cfg.Simulator.Port = simulatePort
+		}
+		if cmd.Flags().Changed("speed") {
+			if simulateSpeed <= 0 {
+				return fmt.Errorf("--speed must be positive")
+			}
+			cfg.Simulator.Speed = simulateSpeed
+		}
+
+		tags, err := opcua.NewTagMap(cfg.Tags, cfg.OPCUA.DefaultNamespace)
+		if err != nil {
+			return err
+		}
+		tanks := brew.NewTanks(cfg.Tanks, tags.Resolve).List()
+
+		sim, err := simulator.New(cfg.Simulator, tags, tanks, log)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := sim.Start(ctx); err != nil {
+			return err
+		}
+		defer sim.Close()
+
+		<-ctx.Done()
+		log.Info().Msg("🛑 Simulator stopped")
+		return nil
+	},
+}
+
+func init() {
+	f := simulateCmd.Flags()
+	f.IntVar(&simulatePort, "port", 4840, "TCP-port (overstyrer simulator.port)")
+	f.Float64Var(&simulateSpeed, "speed", 1, "simulert tid per sanntid, f.eks. 60 (overstyrer simulator.speed)")
+	rootCmd.AddCommand(simulateCmd)
+}
@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/auth"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	userRole  string
+	tokenUser string
+	tokenTTL  time.Duration
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Administrer brukere for web-API-et",
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Opprett en bruker (passord leses fra stdin)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		password, err := readPassword("Passord: ")
+		if err != nil {
+			return err
+		}
+		u, err := svc.CreateUser(args[0], password, userRole)
+		if err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		fmt.Printf("✅ Opprettet %s (%s)\n", u.Username, u.Role)
+		return nil
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List brukere",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		users, err := svc.ListUsers()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tROLE\tCREATED")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", u.Username, u.Role, u.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <username>",
+	Short: "Sett nytt passord (logger ut alle sesjoner)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		password, err := readPassword("Nytt passord: ")
+		if err != nil {
+			return err
+		}
+		if _, err := svc.UpdateUser(args[0], password, ""); err != nil {
+			return fmt.Errorf("set password: %w", err)
+		}
+		fmt.Println("✅ Passord endret")
+		return nil
+	},
+}
+
+var userRoleCmd = &cobra.Command{
+	Use:   "role <username> <viewer|operator|admin>",
+	Short: "Endre rollen til en bruker",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if _, err := svc.UpdateUser(args[0], "", args[1]); err != nil {
+			return fmt.Errorf("set role: %w", err)
+		}
+		fmt.Printf("✅ %s er nå %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:   "rm <username>",
+	Short: "Slett en bruker med sesjoner og tokens",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if err := svc.DeleteUser(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("🗑 Slettet %s\n", args[0])
+		return nil
+	},
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Administrer API-tokens (Authorization: Bearer gtv_...)",
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Lag et API-token for en bruker",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		secret, t, err := svc.CreateToken(args[0], tokenUser, tokenTTL)
+		if err != nil {
+			return fmt.Errorf("create token: %w", err)
+		}
+		fmt.Printf("🔑 Token %d (%s, %s) – vises bare nå:\n%s\n", t.ID, t.Username, t.Role, secret)
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API-tokens",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		tokens, err := svc.ListTokens()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tUSER\tROLE\tEXPIRES\tLAST USED")
+		for _, t := range tokens {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Username, t.Role, formatTime(t.ExpiresAt), formatTime(t.LastUsedAt))
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Trekk tilbake et API-token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid token id: %w", err)
+		}
+
+		svc, closeFn, err := openAuth()
+		if err != nil {
+			return err
+		}
+		defer closeFn()
+
+		if err := svc.RevokeToken(id); err != nil {
+			return err
+		}
+		fmt.Printf("🗑 Token %d trukket tilbake\n", id)
+		return nil
+	},
+}
+
+// openAuth åpner auth-databasen fra config.yaml.
+func openAuth() (*auth.Service, func(), error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
+	ttl, err := time.ParseDuration(cfg.Auth.SessionTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid auth.session_ttl %q", cfg.Auth.SessionTTL)
+	}
+
+	store, err := auth.NewSQLiteStore(cfg.Auth.DatabasePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open db: %w", err)
+	}
+	return auth.NewService(store, ttl), func() { _ = store.Close() }, nil
+}
+
+// readPassword leser én linje fra stdin, så passord kan pipes inn.
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func init() {
+	userAddCmd.Flags().StringVar(&userRole, "role", auth.RoleViewer, "viewer, operator eller admin")
+	userCmd.AddCommand(userAddCmd, userListCmd, userPasswdCmd, userRoleCmd, userRemoveCmd)
+	rootCmd.AddCommand(userCmd)
+
+	tokenCreateCmd.Flags().StringVar(&tokenUser, "user", "admin", "brukeren tokenet gir tilgang som")
+	tokenCreateCmd.Flags().DurationVar(&tokenTTL, "ttl", 0, "levetid, f.eks. 720h (0 = uten utløp)")
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
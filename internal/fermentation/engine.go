@@ -1,3 +1,786 @@
 package fermentation
 
-type Engine struct{}
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+)
+
+// PLCTimeout begrenser hvor lenge én regulering eller kommando kan vente på PLS-en.
+const PLCTimeout = 10 * time.Second
+
+// Feil fra motorens kontrollkommandoer.
+var (
+	ErrPlanNotFound = errors.New("fermentation plan not found")
+	ErrUnknownTank  = errors.New("unknown tank")
+	ErrTankBusy     = errors.New("tank already has an active fermentation")
+	ErrNotActive    = errors.New("no active fermentation on tank")
+	ErrInvalidStep  = errors.New("step index outside plan")
+	ErrInvalidState = errors.New("fermentation is not in the required state")
+)
+
+// Controller er det motoren trenger fra PLS-en. *opcua.Client implementerer dette.
+type Controller interface {
+	ReadNodeValue(ctx context.Context, nodeID string) (interface{}, error)
+	WriteNodeValues(ctx context.Context, writes []opcua.NodeWrite) ([]error, error)
+}
+
+// RunStatus er et øyeblikksbilde av én aktiv gjæring.
+type RunStatus struct {
+	FermentationState
+	PlanName      string            `json:"plan_name"`
+	TotalSteps    int               `json:"total_steps"`
+	CurrentStep   *FermentationStep `json:"current_step"`
+	Ramping       bool              `json:"ramping"`     // target er på vei mot stegets temperatur
+	Gravity       *float64          `json:"gravity"`     // siste måling
+	Attenuation   *float64          `json:"attenuation"` // tilsynelatende forgjæring i %
+	Remaining     time.Duration     `json:"-"`
+	RemainingSecs int64             `json:"remaining_seconds"`
+	ActualTemp    *float64          `json:"actual_temp"`
+	CoolingOn     bool              `json:"cooling_on"`
+	HeatingOn     bool              `json:"heating_on"`
+}
+
+// run er motorens interne tilstand for én tank.
+type run struct {
+	state FermentationState
+	plan  FermentationPlan
+	tags  brew.TankTags
+
+	actual     *float64
+	coolingOn  bool
+	heatingOn  bool
+	outputsSet bool      // false til vi har skrevet utgangene minst én gang
+	lastSwitch time.Time // siste gang en utgang byttet tilstand
+
+	gravity           []GravityReading // målinger for batchen, eldste først
+	lastGravitySample time.Time        // siste gang gravity_tag ble lagret
+	lastGravityAt     time.Time        // måletidspunktet til taggverdien som sist ble lagret
+}
+
+// Engine er prosessmotoren: den binder planer til tanker, går gjennom stegene
+// basert på medgått tid og regulerer kjøleventil/varmekappe med hysterese.
+type Engine struct {
+	log   zerolog.Logger
+	plc   Controller
+	store Store
+	tanks *brew.Tanks
+
+	coolingHysteresis float64
+	heatingHysteresis float64
+	checkInterval     time.Duration
+	stabilization     time.Duration
+	persistInterval   time.Duration
+	lastPersist       time.Time
+
+	mu        sync.Mutex
+	runs      map[int]*run // tankNo → run
+	stopping  map[int]*run // avsluttede gjæringer der utgangene ikke er slått av ennå
+	listeners []func(Event)
+}
+
+// NewEngine lager en motor fra gjæringskonfigurasjonen.
+func NewEngine(log zerolog.Logger, plc Controller, store Store, tanks *brew.Tanks, cfg config.FermentationConfig) (*Engine, error) {
+	interval, err := time.ParseDuration(cfg.StepCheckInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid step_check_interval %q: %w", cfg.StepCheckInterval, err)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("step_check_interval must be positive, got %s", interval)
+	}
+
+	stabilization, err := time.ParseDuration(cfg.StabilizationTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stabilization_time %q: %w", cfg.StabilizationTime, err)
+	}
+
+	persist, err := time.ParseDuration(cfg.StatePersistInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state_persist_interval %q: %w", cfg.StatePersistInterval, err)
+	}
+
+	return &Engine{
+		log:               log,
+		plc:               plc,
+		store:             store,
+		tanks:             tanks,
+		coolingHysteresis: cfg.Hysteresis.Cooling,
+		heatingHysteresis: cfg.Hysteresis.Heating,
+		checkInterval:     interval,
+		stabilization:     stabilization,
+		persistInterval:   persist,
+		runs:              make(map[int]*run),
+		stopping:          make(map[int]*run),
+	}, nil
+}
+
+// OnEvent registrerer en funksjon som kalles ved hver hendelse. Den kalles
+// med motoren låst, så den må ikke kalle tilbake inn i motoren.
+func (e *Engine) OnEvent(fn func(Event)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, fn)
+}
+
+// emit må kalles med e.mu låst.
+func (e *Engine) emit(r *run, typ string, at time.Time) {
+	ev := Event{
+		Type:       typ,
+		Time:       at,
+		TankNo:     r.state.TankNo,
+		BatchID:    r.state.BatchID,
+		PlanName:   r.plan.Name,
+		StepIndex:  r.state.StepIndex,
+		TargetTemp: r.state.TargetTemp,
+	}
+	for _, fn := range e.listeners {
+		fn(ev)
+	}
+}
+
+// Start binder en lagret plan til en tank og starter på steget startStep (0-basert).
+// originalGravity er valgfri; uten den brukes første gravity-måling som OG.
+func (e *Engine) Start(planID int64, tankNo int, batchID string, startStep int, originalGravity *float64) (*RunStatus, error) {
+	plan, err := e.store.GetPlan(planID)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.Steps) == 0 {
+		return nil, fmt.Errorf("plan %d has no steps", planID)
+	}
+	if startStep < 0 || startStep >= len(plan.Steps) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidStep, startStep)
+	}
+	if originalGravity != nil {
+		if err := ValidateGravity(*originalGravity); err != nil {
+			return nil, err
+		}
+	}
+
+	tank, ok := e.tanks.Get(tankNo)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownTank, tankNo)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, busy := e.runs[tankNo]; busy {
+		return nil, fmt.Errorf("%w: tank %d", ErrTankBusy, tankNo)
+	}
+
+	now := time.Now()
+	r := &run{
+		state: FermentationState{
+			BatchID:         batchID,
+			PlanID:          plan.ID,
+			TankNo:          tankNo,
+			StepIndex:       startStep,
+			StartedAt:       now,
+			StepStartedAt:   now,
+			Status:          StatusRunning,
+			OriginalGravity: originalGravity,
+		},
+		plan: *plan,
+		tags: tank.Tags,
+	}
+	// Første rampe starter fra det tanken holder nå
+	if tank.Temperature != nil {
+		from := *tank.Temperature
+		r.state.RampFrom = &from
+	}
+	r.state.TargetTemp = r.setpoint(now)
+	if err := e.store.SaveState(r.state); err != nil {
+		return nil, err
+	}
+	e.runs[tankNo] = r
+	// Den nye gjæringen tar over utgangene
+	delete(e.stopping, tankNo)
+	e.emit(r, EventStarted, now)
+
+	e.log.Info().
+		Int("tank", tankNo).
+		Str("plan", plan.Name).
+		Int("steps", len(plan.Steps)).
+		Float64("target", r.state.TargetTemp).
+		Msg("🍺 Fermentation started")
+
+	status := r.status(now)
+	return &status, nil
+}
+
+// Restore laster gjæringer som var aktive før omstart og fortsetter der de var.
+// Steg som ble ferdige mens prosessen var nede hoppes over, slik at gjenstående
+// tid regnes fra når steget faktisk startet.
+func (e *Engine) Restore(ctx context.Context) error {
+	states, err := e.store.ListActiveStates()
+	if err != nil {
+		return fmt.Errorf("list active states: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	for _, st := range states {
+		plan, err := e.store.GetPlan(st.PlanID)
+		if err != nil {
+			e.log.Error().Err(err).Int("tank", st.TankNo).Msg("❌ Could not load plan for active fermentation")
+			continue
+		}
+		if st.StepIndex < 0 || st.StepIndex >= len(plan.Steps) {
+			e.log.Error().Int("tank", st.TankNo).Int("step_index", st.StepIndex).Msg("❌ Stored step index is outside plan")
+			continue
+		}
+
+		tank, ok := e.tanks.Get(st.TankNo)
+		if !ok {
+			e.log.Error().Int("tank", st.TankNo).Msg("❌ Active fermentation refers to a tank that is no longer configured")
+			continue
+		}
+
+		r := &run{
+			state: st,
+			plan:  *plan,
+			tags:  tank.Tags,
+		}
+		readings, err := e.store.ListGravity(st.TankNo, st.BatchID)
+		if err != nil {
+			e.log.Error().Err(err).Int("tank", st.TankNo).Msg("❌ Could not load gravity readings")
+		}
+		for _, g := range readings {
+			// Samme batch-ID kan være brukt før på tanken
+			if !g.Time.Before(st.StartedAt) {
+				r.gravity = append(r.gravity, g)
+			}
+		}
+		e.runs[st.TankNo] = r
+
+		if st.Status == StatusRunning && e.advance(ctx, r, now) {
+			continue
+		}
+		status := r.status(now)
+		e.log.Info().
+			Int("tank", st.TankNo).
+			Str("plan", plan.Name).
+			Int("step", st.StepIndex+1).
+			Dur("remaining", status.Remaining).
+			Msg("♻️ Fermentation resumed")
+	}
+
+	e.lastPersist = now
+	return nil
+}
+
+// Abort stopper gjæringen på en tank og slår av kjøling og varme.
+func (e *Engine) Abort(ctx context.Context, tankNo int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, err := e.get(tankNo)
+	if err != nil {
+		return err
+	}
+
+	r.state.Status = StatusAborted
+	e.finish(ctx, r)
+	e.emit(r, EventAborted, time.Now())
+	e.log.Warn().Int("tank", tankNo).Msg("🛑 Fermentation aborted")
+	return nil
+}
+
+// Pause fryser steg-tiden. Temperaturen holdes fortsatt på target.
+func (e *Engine) Pause(tankNo int) (*RunStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, err := e.get(tankNo)
+	if err != nil {
+		return nil, err
+	}
+	if r.state.Status != StatusRunning {
+		return nil, fmt.Errorf("%w: tank %d is %s", ErrInvalidState, tankNo, r.state.Status)
+	}
+
+	now := time.Now()
+	r.state.Status = StatusPaused
+	r.state.PausedAt = &now
+	e.persist(r)
+	e.emit(r, EventPaused, now)
+
+	e.log.Info().Int("tank", tankNo).Msg("⏸ Fermentation paused")
+	status := r.status(now)
+	return &status, nil
+}
+
+// Resume fortsetter en pauset gjæring; pausetiden legges til steget.
+func (e *Engine) Resume(tankNo int) (*RunStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, err := e.get(tankNo)
+	if err != nil {
+		return nil, err
+	}
+	if r.state.Status != StatusPaused || r.state.PausedAt == nil {
+		return nil, fmt.Errorf("%w: tank %d is %s", ErrInvalidState, tankNo, r.state.Status)
+	}
+
+	now := time.Now()
+	r.state.StepStartedAt = r.state.StepStartedAt.Add(now.Sub(*r.state.PausedAt))
+	r.state.Status = StatusRunning
+	r.state.PausedAt = nil
+	e.persist(r)
+	e.emit(r, EventResumed, now)
+
+	e.log.Info().Int("tank", tankNo).Msg("▶️ Fermentation resumed")
+	status := r.status(now)
+	return &status, nil
+}
+
+// Skip avslutter nåværende steg og starter neste med en gang.
+func (e *Engine) Skip(ctx context.Context, tankNo int) (*RunStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, err := e.get(tankNo)
+	if err != nil {
+		return nil, err
+	}
+	next := r.state.StepIndex + 1
+	if next >= len(r.plan.Steps) {
+		return nil, fmt.Errorf("%w: tank %d is on its last step", ErrInvalidStep, tankNo)
+	}
+	return e.jumpTo(ctx, r, next)
+}
+
+// JumpTo hopper til et vilkårlig steg (0-basert) og starter steg-tiden på nytt.
+func (e *Engine) JumpTo(ctx context.Context, tankNo, stepIndex int) (*RunStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, err := e.get(tankNo)
+	if err != nil {
+		return nil, err
+	}
+	return e.jumpTo(ctx, r, stepIndex)
+}
+
+// jumpTo gjør jobben for Skip og JumpTo. Må kalles med e.mu låst, så planen
+// ikke byttes av ReloadPlan mellom sjekk og hopp.
+func (e *Engine) jumpTo(ctx context.Context, r *run, stepIndex int) (*RunStatus, error) {
+	if stepIndex < 0 || stepIndex >= len(r.plan.Steps) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidStep, stepIndex)
+	}
+
+	tankNo := r.state.TankNo
+	now := time.Now()
+	from := r.state.TargetTemp
+	r.state.StepIndex = stepIndex
+	r.state.StepStartedAt = now
+	r.state.RampFrom = &from
+	if r.state.PausedAt != nil {
+		r.state.PausedAt = &now
+	}
+	r.state.TargetTemp = r.setpoint(now)
+	e.persist(r)
+	e.emit(r, EventStepManual, now)
+
+	e.log.Info().
+		Int("tank", tankNo).
+		Int("step", stepIndex+1).
+		Float64("target", r.state.TargetTemp).
+		Msg("⏭ Fermentation step changed manually")
+
+	e.regulate(ctx, r, now)
+	status := r.status(now)
+	return &status, nil
+}
+
+// ResyncOutputs tvinger ny skriving av kjøling/varme ved neste regulering.
+// Kalles etter reconnect, siden PLS-en kan ha startet på nytt med andre verdier.
+func (e *Engine) ResyncOutputs() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.runs {
+		r.outputsSet = false
+	}
+}
+
+// ReloadPlan henter planen på nytt for aktive gjæringer som bruker den, så
+// endringer fra API-et gjelder med en gang. Endringer fra CLI-en plukkes opp
+// av kontrollsløyfen innen state_persist_interval.
+func (e *Engine) ReloadPlan(planID int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.reloadPlans(planID)
+}
+
+// reloadPlans laster planene til aktive gjæringer på nytt; planID 0 betyr
+// alle. Må kalles med e.mu låst.
+func (e *Engine) reloadPlans(planID int64) {
+	plans := make(map[int64]*FermentationPlan)
+	for _, r := range e.runs {
+		id := r.state.PlanID
+		if planID != 0 && id != planID {
+			continue
+		}
+		plan, ok := plans[id]
+		if !ok {
+			p, err := e.store.GetPlan(id)
+			if err != nil {
+				e.log.Warn().Err(err).Int("tank", r.state.TankNo).Msg("⚠️ Could not reload fermentation plan")
+				continue
+			}
+			plans[id], plan = p, p
+		}
+		e.applyPlan(r, plan)
+	}
+}
+
+// applyPlan bytter til en redigert plan. Target følger nåværende steg,
+// inkludert en endret rampe.
+func (e *Engine) applyPlan(r *run, plan *FermentationPlan) {
+	if r.state.StepIndex >= len(plan.Steps) {
+		e.log.Error().Int("tank", r.state.TankNo).Int("step_index", r.state.StepIndex).Msg("❌ Edited plan no longer has the current step")
+		return
+	}
+	old := r.plan.Steps[r.state.StepIndex]
+	r.plan = plan.Copy()
+	if sameStep(old, plan.Steps[r.state.StepIndex]) {
+		return
+	}
+
+	target := r.setpoint(time.Now())
+	if target == r.state.TargetTemp {
+		return
+	}
+	r.state.TargetTemp = target
+	e.persist(r)
+	e.log.Info().
+		Int("tank", r.state.TankNo).
+		Int("step", r.state.StepIndex+1).
+		Float64("target", target).
+		Msg("✏️ Fermentation plan edited, target updated")
+}
+
+// get må kalles med e.mu låst.
+func (e *Engine) get(tankNo int) (*run, error) {
+	r, ok := e.runs[tankNo]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrNotActive, tankNo)
+	}
+	return r, nil
+}
+
+// Active returnerer alle aktive gjæringer sortert på tanknummer.
+func (e *Engine) Active() []RunStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	out := make([]RunStatus, 0, len(e.runs))
+	for _, r := range e.runs {
+		out = append(out, r.status(now))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TankNo < out[j].TankNo })
+	return out
+}
+
+// Run kjører kontrollsløyfen til ctx kanselleres.
+func (e *Engine) Run(ctx context.Context) error {
+	e.log.Info().
+		Dur("interval", e.checkInterval).
+		Float64("hyst_cooling", e.coolingHysteresis).
+		Float64("hyst_heating", e.heatingHysteresis).
+		Msg("🧪 Fermentation engine started")
+
+	ticker := time.NewTicker(e.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.log.Info().Msg("🧪 Fermentation engine stopped")
+			return nil
+		case <-ticker.C:
+			e.tick(ctx)
+		}
+	}
+}
+
+// tick går gjennom alle aktive gjæringer: steg-overgang først, så regulering.
+func (e *Engine) tick(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, r := range e.stopping {
+		e.switchOff(ctx, r)
+	}
+	for _, r := range e.runs {
+		now := time.Now()
+		e.sampleGravity(r, now)
+		if r.state.Status == StatusRunning && e.advance(ctx, r, now) {
+			continue
+		}
+		e.regulate(ctx, r, now)
+	}
+
+	if time.Since(e.lastPersist) >= e.persistInterval {
+		e.reloadPlans(0)
+		for _, r := range e.runs {
+			e.persist(r)
+		}
+		e.lastPersist = time.Now()
+	}
+}
+
+// advance flytter til neste steg når nåværende steg er ferdig. Neste steg
+// starter når forrige skulle slutte, så flere steg kan hoppes over etter nedetid.
+// Steg med gravity-betingelser avsluttes med en gang betingelsene er oppfylt,
+// og senest når tiden er ute. Bare ett steg per kall kan avsluttes på gravity,
+// så neste steg får egne målinger før det vurderes.
+// Returnerer true hvis gjæringen ble fullført.
+func (e *Engine) advance(ctx context.Context, r *run, now time.Time) bool {
+	for {
+		step := r.plan.Steps[r.state.StepIndex]
+		end := r.state.StepStartedAt.Add(stepDuration(step))
+		trigger := EventStep
+		if now.Before(end) {
+			if !step.HasGravityCondition() || !r.gravityReached(step, now) {
+				return false
+			}
+			end, trigger = now, EventStepGravity
+		}
+
+		if r.state.StepIndex+1 >= len(r.plan.Steps) {
+			r.state.Status = StatusCompleted
+			e.finish(ctx, r)
+			e.emit(r, EventCompleted, end)
+			e.log.Info().
+				Int("tank", r.state.TankNo).
+				Str("plan", r.plan.Name).
+				Msg("🎉 Fermentation completed")
+			return true
+		}
+
+		from := step.Temperature
+		r.state.StepIndex++
+		r.state.StepStartedAt = end
+		r.state.RampFrom = &from
+		r.state.TargetTemp = r.setpoint(end)
+		e.persist(r)
+		e.emit(r, trigger, end)
+
+		e.log.Info().
+			Int("tank", r.state.TankNo).
+			Int("step", r.state.StepIndex+1).
+			Float64("target", r.state.TargetTemp).
+			Str("trigger", trigger).
+			Msg("➡️ Fermentation step advanced")
+
+		if trigger == EventStepGravity {
+			return false
+		}
+	}
+}
+
+// temperature henter live-verdien fra tanken, eller leser fra PLS-en hvis
+// abonnementet ikke har levert noen verdi ennå.
+func (e *Engine) temperature(ctx context.Context, r *run) (float64, error) {
+	if tank, ok := e.tanks.Get(r.state.TankNo); ok && tank.Temperature != nil {
+		return *tank.Temperature, nil
+	}
+
+	raw, err := e.plc.ReadNodeValue(ctx, r.tags.Temperature)
+	if err != nil {
+		return 0, err
+	}
+	temp, ok := brew.ToFloat(raw)
+	if !ok {
+		return 0, fmt.Errorf("unsupported temperature type %T", raw)
+	}
+	return temp, nil
+}
+
+// regulate leser tanktemperaturen og setter kjøling/varme med hysterese.
+//
+// Kjøling slås på over target+hysterese og av ved target; varme slås på under
+// target-hysterese og av ved target. Utgangene holdes minst StabilizationTime
+// i samme tilstand for å skåne ventiler og varmekappe.
+func (e *Engine) regulate(ctx context.Context, r *run, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, PLCTimeout)
+	defer cancel()
+
+	r.state.TargetTemp = r.setpoint(now)
+	target := r.state.TargetTemp
+	e.tanks.SetSetpoint(r.state.TankNo, &target)
+
+	temp, err := e.temperature(ctx, r)
+	if err != nil {
+		e.log.Warn().Err(err).Int("tank", r.state.TankNo).Msg("⚠️ Could not read tank temperature")
+		return
+	}
+	r.actual = &temp
+
+	cooling, heating := r.coolingOn, r.heatingOn
+
+	switch {
+	case temp > target+e.coolingHysteresis:
+		cooling, heating = true, false
+	case temp < target-e.heatingHysteresis:
+		cooling, heating = false, true
+	default:
+		if cooling && temp <= target {
+			cooling = false
+		}
+		if heating && temp >= target {
+			heating = false
+		}
+	}
+
+	if r.outputsSet && cooling == r.coolingOn && heating == r.heatingOn {
+		return
+	}
+	if r.outputsSet && now.Sub(r.lastSwitch) < e.stabilization {
+		return
+	}
+
+	if err := e.setOutputs(ctx, r, cooling, heating); err != nil {
+		e.log.Error().Err(err).Int("tank", r.state.TankNo).Msg("❌ Failed to set tank outputs")
+		return
+	}
+	r.lastSwitch = now
+
+	e.log.Info().
+		Int("tank", r.state.TankNo).
+		Float64("temp", temp).
+		Float64("target", target).
+		Bool("cooling", cooling).
+		Bool("heating", heating).
+		Msg("🌡 Tank outputs updated")
+}
+
+// setOutputs skriver kjøleventil og varmekappe i samme request. Den som skal
+// av står først, slik at vi aldri kjøler og varmer samtidig.
+func (e *Engine) setOutputs(ctx context.Context, r *run, cooling, heating bool) error {
+	writes := []opcua.NodeWrite{
+		{NodeID: r.tags.Cooling, Value: cooling},
+		{NodeID: r.tags.Heater, Value: heating},
+	}
+	if cooling {
+		writes[0], writes[1] = writes[1], writes[0]
+	}
+
+	errs, err := e.plc.WriteNodeValues(ctx, writes)
+	if err != nil {
+		return err
+	}
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("write %s: %w", writes[i].NodeID, err)
+		}
+	}
+
+	r.coolingOn, r.heatingOn = cooling, heating
+	r.outputsSet = true
+	return nil
+}
+
+// finish lagrer sluttilstanden, fjerner gjæringen fra motoren og slår av
+// utgangene. Feiler skrivingen prøver tick igjen til utgangene er av.
+func (e *Engine) finish(ctx context.Context, r *run) {
+	e.persist(r)
+	e.tanks.SetSetpoint(r.state.TankNo, nil)
+	delete(e.runs, r.state.TankNo)
+	e.stopping[r.state.TankNo] = r
+	e.switchOff(ctx, r)
+}
+
+// switchOff slår av utgangene til en avsluttet gjæring. Den blir liggende i
+// e.stopping til skrivingen lykkes. Må kalles med e.mu låst.
+func (e *Engine) switchOff(ctx context.Context, r *run) {
+	ctx, cancel := context.WithTimeout(ctx, PLCTimeout)
+	defer cancel()
+
+	if err := e.setOutputs(ctx, r, false, false); err != nil {
+		e.log.Error().Err(err).Int("tank", r.state.TankNo).Msg("❌ Failed to switch off tank outputs, retrying")
+		return
+	}
+	delete(e.stopping, r.state.TankNo)
+}
+
+// persist lagrer tilstanden; feil logges men stopper ikke reguleringen.
+func (e *Engine) persist(r *run) {
+	if err := e.store.SaveState(r.state); err != nil {
+		e.log.Error().Err(err).Int("tank", r.state.TankNo).Msg("❌ Failed to persist fermentation state")
+	}
+}
+
+func (r *run) status(now time.Time) RunStatus {
+	if r.state.PausedAt != nil {
+		now = *r.state.PausedAt
+	}
+	step := r.plan.Steps[r.state.StepIndex]
+	remaining := stepDuration(step) - now.Sub(r.state.StepStartedAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	var gravity, attenuation *float64
+	if g := r.latestGravity(now); g != nil {
+		sg := g.Gravity
+		gravity, attenuation = &sg, r.attenuation(sg)
+	}
+
+	return RunStatus{
+		FermentationState: r.state,
+		PlanName:          r.plan.Name,
+		TotalSteps:        len(r.plan.Steps),
+		CurrentStep:       &step,
+		Ramping:           step.RampHours > 0 && r.state.RampFrom != nil && r.ramp(now) < 1,
+		Gravity:           gravity,
+		Attenuation:       attenuation,
+		Remaining:         remaining,
+		RemainingSecs:     int64(remaining.Seconds()),
+		ActualTemp:        r.actual,
+		CoolingOn:         r.coolingOn,
+		HeatingOn:         r.heatingOn,
+	}
+}
+
+// setpoint er target for nåværende steg ved now. Med rampe går den lineært
+// fra RampFrom til stegets temperatur over RampHours; pause fryser rampen.
+func (r *run) setpoint(now time.Time) float64 {
+	step := r.plan.Steps[r.state.StepIndex]
+	if step.RampHours <= 0 || r.state.RampFrom == nil {
+		return step.Temperature
+	}
+	from := *r.state.RampFrom
+	return from + (step.Temperature-from)*r.ramp(now)
+}
+
+// ramp er hvor langt rampen har kommet, fra 0 til 1.
+func (r *run) ramp(now time.Time) float64 {
+	step := r.plan.Steps[r.state.StepIndex]
+	if step.RampHours <= 0 {
+		return 1
+	}
+	if r.state.PausedAt != nil {
+		now = *r.state.PausedAt
+	}
+	f := now.Sub(r.state.StepStartedAt).Hours() / step.RampHours
+	return max(0, min(f, 1))
+}
+
+func stepDuration(s FermentationStep) time.Duration {
+	return time.Duration(s.DurationHours * float64(time.Hour))
+}
@@ -0,0 +1,428 @@
+package fermentation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+)
+
+const (
+	testTemp    = "ns=2;s=T1"
+	testCooling = "ns=2;s=C1"
+	testHeater  = "ns=2;s=H1"
+	testGravity = "ns=2;s=G1"
+)
+
+// fakePLC husker siste verdi skrevet til hver node. Med fail satt feiler
+// all skriving, som når PLS-en ikke er tilkoblet.
+type fakePLC struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+	fail   error
+}
+
+func (p *fakePLC) ReadNodeValue(_ context.Context, nodeID string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.values[nodeID]
+	if !ok {
+		return nil, errors.New("no value")
+	}
+	return v, nil
+}
+
+func (p *fakePLC) WriteNodeValues(_ context.Context, writes []opcua.NodeWrite) ([]error, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil {
+		return nil, p.fail
+	}
+	for _, w := range writes {
+		p.values[w.NodeID] = w.Value
+	}
+	return make([]error, len(writes)), nil
+}
+
+func (p *fakePLC) setFail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fail = err
+}
+
+func (p *fakePLC) on(nodeID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, _ := p.values[nodeID].(bool)
+	return b
+}
+
+// memStore er en Store i minnet.
+type memStore struct {
+	plans   map[int64]*FermentationPlan
+	states  map[int]FermentationState
+	gravity []GravityReading
+}
+
+func (s *memStore) GetPlan(id int64) (*FermentationPlan, error) {
+	p, ok := s.plans[id]
+	if !ok {
+		return nil, ErrPlanNotFound
+	}
+	cp := p.Copy()
+	return &cp, nil
+}
+
+func (s *memStore) SaveState(st FermentationState) error {
+	s.states[st.TankNo] = st
+	return nil
+}
+
+func (s *memStore) ListActiveStates() ([]FermentationState, error) {
+	var out []FermentationState
+	for _, st := range s.states {
+		if st.Status == StatusRunning || st.Status == StatusPaused {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+func (s *memStore) SaveGravity(g GravityReading) error {
+	s.gravity = append(s.gravity, g)
+	return nil
+}
+
+func (s *memStore) ListGravity(tankNo int, batchID string) ([]GravityReading, error) {
+	var out []GravityReading
+	for _, g := range s.gravity {
+		if g.TankNo == tankNo && g.BatchID == batchID {
+			out = append(out, g)
+		}
+	}
+	return out, nil
+}
+
+func newTestEngine(t *testing.T, steps ...FermentationStep) (*Engine, *fakePLC, *brew.Tanks, *memStore) {
+	t.Helper()
+	plan := FermentationPlan{ID: 1, Name: "Test", Steps: steps}
+	plan.Renumber()
+	store := &memStore{
+		plans:  map[int64]*FermentationPlan{1: &plan},
+		states: make(map[int]FermentationState),
+	}
+	tanks := brew.NewTanks([]config.TankConfig{{
+		No:             1,
+		TemperatureTag: testTemp,
+		CoolingTag:     testCooling,
+		HeaterTag:      testHeater,
+		GravityTag:     testGravity,
+	}}, func(s string) string { return s })
+	plc := &fakePLC{values: make(map[string]interface{})}
+
+	var cfg config.FermentationConfig
+	cfg.Hysteresis.Cooling, cfg.Hysteresis.Heating = 0.5, 0.5
+	cfg.StepCheckInterval, cfg.StabilizationTime, cfg.StatePersistInterval = "1s", "0s", "1m"
+	e, err := NewEngine(zerolog.Nop(), plc, store, tanks, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, plc, tanks, store
+}
+
+// rewind flytter starten av nåværende steg d bakover i tid.
+func rewind(e *Engine, tankNo int, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r := e.runs[tankNo]
+	r.state.StartedAt = r.state.StartedAt.Add(-d)
+	r.state.StepStartedAt = r.state.StepStartedAt.Add(-d)
+}
+
+func TestSetpointRamp(t *testing.T) {
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	from := 20.0
+	r := &run{
+		state: FermentationState{StepStartedAt: t0, RampFrom: &from},
+		plan:  FermentationPlan{Steps: []FermentationStep{{Temperature: 10, DurationHours: 48, RampHours: 10}}},
+	}
+
+	for _, tt := range []struct {
+		after time.Duration
+		want  float64
+	}{
+		{-time.Hour, 20},
+		{0, 20},
+		{5 * time.Hour, 15},
+		{9 * time.Hour, 11},
+		{10 * time.Hour, 10},
+		{30 * time.Hour, 10},
+	} {
+		if got := r.setpoint(t0.Add(tt.after)); !near(got, tt.want) {
+			t.Errorf("setpoint after %s = %g, want %g", tt.after, got, tt.want)
+		}
+	}
+
+	// Pause fryser rampen der den var
+	paused := t0.Add(4 * time.Hour)
+	r.state.PausedAt = &paused
+	if got := r.setpoint(t0.Add(8 * time.Hour)); !near(got, 16) {
+		t.Errorf("setpoint while paused = %g, want 16", got)
+	}
+	if st := r.status(t0.Add(8 * time.Hour)); !st.Ramping {
+		t.Error("status while paused mid-ramp should be ramping")
+	}
+	r.state.PausedAt = nil
+
+	// Uten rampe eller startpunkt gjelder stegets temperatur med en gang
+	r.state.RampFrom = nil
+	if got := r.setpoint(t0); got != 10 {
+		t.Errorf("setpoint without ramp_from = %g, want 10", got)
+	}
+	r.state.RampFrom = &from
+	r.plan.Steps[0].RampHours = 0
+	if got := r.setpoint(t0); got != 10 {
+		t.Errorf("setpoint without ramp = %g, want 10", got)
+	}
+	if got := r.ramp(t0); got != 1 {
+		t.Errorf("ramp without ramp hours = %g, want 1", got)
+	}
+}
+
+func TestStartRampsFromTankTemperature(t *testing.T) {
+	e, _, tanks, _ := newTestEngine(t, FermentationStep{Temperature: 12, DurationHours: 24, RampHours: 12})
+	tanks.Update(testTemp, 20.0, time.Now())
+
+	st, err := e.Start(1, 1, "b1", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.RampFrom == nil || *st.RampFrom != 20 || !near(st.TargetTemp, 20) || !st.Ramping {
+		t.Fatalf("status after start = %+v, want ramp from 20", st)
+	}
+
+	rewind(e, 1, 6*time.Hour)
+	e.tick(context.Background())
+	if got := e.Active()[0].TargetTemp; !near(got, 16) {
+		t.Errorf("target after 6 h = %g, want 16", got)
+	}
+}
+
+func TestRegulateHysteresis(t *testing.T) {
+	e, plc, tanks, _ := newTestEngine(t, FermentationStep{Temperature: 18, DurationHours: 24})
+	ctx := context.Background()
+	if _, err := e.Start(1, 1, "b1", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		temp             float64
+		cooling, heating bool
+	}{
+		{18.4, false, false}, // innenfor båndet: utgangene skrives av første gang
+		{18.6, true, false},  // over target+hysterese
+		{18.2, true, false},  // kjøler til target
+		{18.0, false, false}, // target nådd
+		{17.6, false, false},
+		{17.4, false, true}, // under target-hysterese
+		{17.9, false, true},
+		{18.0, false, false},
+	} {
+		tanks.Update(testTemp, tt.temp, time.Now())
+		e.tick(ctx)
+		if plc.on(testCooling) != tt.cooling || plc.on(testHeater) != tt.heating {
+			t.Fatalf("at %g °C: cooling=%v heating=%v, want %v/%v",
+				tt.temp, plc.on(testCooling), plc.on(testHeater), tt.cooling, tt.heating)
+		}
+	}
+
+	if err := e.Abort(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	tanks.Update(testTemp, 25.0, time.Now())
+	e.tick(ctx)
+	if plc.on(testCooling) || plc.on(testHeater) {
+		t.Error("outputs must stay off after abort")
+	}
+}
+
+func TestFinishRetriesSwitchOff(t *testing.T) {
+	e, plc, tanks, store := newTestEngine(t, FermentationStep{Temperature: 18, DurationHours: 24})
+	ctx := context.Background()
+	if _, err := e.Start(1, 1, "b1", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	tanks.Update(testTemp, 25.0, time.Now())
+	e.tick(ctx)
+	if !plc.on(testCooling) {
+		t.Fatal("cooling should be on at 25 °C")
+	}
+
+	plc.setFail(errors.New("not connected"))
+	if err := e.Abort(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Active()) != 0 || store.states[1].Status != StatusAborted {
+		t.Fatalf("after abort: active %v, stored %q; want no active run and status aborted", e.Active(), store.states[1].Status)
+	}
+	e.tick(ctx)
+	if !plc.on(testCooling) {
+		t.Fatal("fake PLC should still have cooling on while writes fail")
+	}
+	if len(e.stopping) != 1 {
+		t.Fatalf("stopping = %d runs, want the aborted run kept until the outputs are off", len(e.stopping))
+	}
+
+	// Skrivingen prøves igjen til den lykkes
+	plc.setFail(nil)
+	e.tick(ctx)
+	if plc.on(testCooling) || plc.on(testHeater) {
+		t.Error("outputs must be switched off once the PLC accepts writes")
+	}
+	if len(e.stopping) != 0 {
+		t.Errorf("stopping = %d runs, want none after the outputs are off", len(e.stopping))
+	}
+}
+
+func TestStartTakesOverStoppingTank(t *testing.T) {
+	e, plc, tanks, _ := newTestEngine(t, FermentationStep{Temperature: 18, DurationHours: 24})
+	ctx := context.Background()
+	if _, err := e.Start(1, 1, "b1", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	plc.setFail(errors.New("not connected"))
+	if err := e.Abort(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Start(1, 1, "b2", 0, nil); err != nil {
+		t.Fatalf("Start while outputs are being switched off = %v", err)
+	}
+	plc.setFail(nil)
+	tanks.Update(testTemp, 25.0, time.Now())
+	e.tick(ctx)
+	if len(e.stopping) != 0 || !plc.on(testCooling) {
+		t.Error("the new fermentation should own the outputs, not the old switch-off")
+	}
+}
+
+func TestAdvanceSkipsFinishedSteps(t *testing.T) {
+	e, plc, tanks, store := newTestEngine(t,
+		FermentationStep{Temperature: 18, DurationHours: 24},
+		FermentationStep{Temperature: 20, DurationHours: 24},
+		FermentationStep{Temperature: 4, DurationHours: 48},
+	)
+	tanks.Update(testTemp, 18.0, time.Now())
+	var events []string
+	e.OnEvent(func(ev Event) { events = append(events, ev.Type) })
+
+	if _, err := e.Start(1, 1, "b1", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nedetid på 50 timer: steg 1 og 2 er ferdige
+	rewind(e, 1, 50*time.Hour)
+	e.tick(context.Background())
+	st := e.Active()[0]
+	if st.StepIndex != 2 || st.TargetTemp != 4 {
+		t.Fatalf("after 50 h: step %d target %g, want step 2 target 4", st.StepIndex, st.TargetTemp)
+	}
+	if st.StepStartedAt.After(time.Now().Add(-time.Hour)) {
+		t.Errorf("step 3 started at %s, want when step 2 should have ended", st.StepStartedAt)
+	}
+	if !plc.on(testCooling) {
+		t.Error("cooling should be on towards 4 °C")
+	}
+
+	rewind(e, 1, 48*time.Hour)
+	e.tick(context.Background())
+	if len(e.Active()) != 0 {
+		t.Fatal("fermentation should be completed")
+	}
+	if store.states[1].Status != StatusCompleted {
+		t.Errorf("stored status = %q, want completed", store.states[1].Status)
+	}
+	if plc.on(testCooling) || plc.on(testHeater) {
+		t.Error("outputs must be off after completion")
+	}
+	want := []string{EventStarted, EventStep, EventStep, EventCompleted}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", events, want)
+		}
+	}
+}
+
+func TestRestoreFinishedWhileDisconnected(t *testing.T) {
+	e, plc, _, store := newTestEngine(t, FermentationStep{Temperature: 18, DurationHours: 24})
+	started := time.Now().Add(-50 * time.Hour)
+	store.states[1] = FermentationState{
+		BatchID: "b1", PlanID: 1, TankNo: 1,
+		StartedAt: started, StepStartedAt: started, TargetTemp: 18, Status: StatusRunning,
+	}
+	// Kjølingen stod på da prosessen ble stoppet, og PLS-en er ikke tilkoblet ennå
+	plc.values[testCooling] = true
+	plc.setFail(errors.New("not connected"))
+
+	ctx := context.Background()
+	if err := e.Restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Active()) != 0 || store.states[1].Status != StatusCompleted {
+		t.Fatalf("after restore: active %v, stored %q; want completed", e.Active(), store.states[1].Status)
+	}
+	e.tick(ctx)
+	if !plc.on(testCooling) {
+		t.Fatal("fake PLC should keep its value while disconnected")
+	}
+
+	plc.setFail(nil)
+	e.tick(ctx)
+	if plc.on(testCooling) || plc.on(testHeater) {
+		t.Error("outputs must be switched off once the PLC is connected")
+	}
+}
+
+func TestSkipAndJump(t *testing.T) {
+	e, _, _, _ := newTestEngine(t,
+		FermentationStep{Temperature: 18, DurationHours: 24},
+		FermentationStep{Temperature: 20, DurationHours: 24},
+	)
+	ctx := context.Background()
+	if _, err := e.Start(1, 1, "b1", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := e.Skip(ctx, 1)
+	if err != nil || st.StepIndex != 1 {
+		t.Fatalf("Skip = %+v, %v; want step 1", st, err)
+	}
+	if _, err := e.Skip(ctx, 1); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("Skip on last step = %v, want ErrInvalidStep", err)
+	}
+	if _, err := e.JumpTo(ctx, 1, 5); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("JumpTo outside plan = %v, want ErrInvalidStep", err)
+	}
+	if st, err := e.JumpTo(ctx, 1, 0); err != nil || st.StepIndex != 0 {
+		t.Errorf("JumpTo(0) = %+v, %v", st, err)
+	}
+	if _, err := e.Skip(ctx, 2); !errors.Is(err, ErrNotActive) {
+		t.Errorf("Skip on idle tank = %v, want ErrNotActive", err)
+	}
+	if _, err := e.Start(1, 1, "b2", 0, nil); !errors.Is(err, ErrTankBusy) {
+		t.Errorf("second Start = %v, want ErrTankBusy", err)
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-6 && d > -1e-6
+}
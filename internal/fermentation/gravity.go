@@ -0,0 +1,190 @@
+package fermentation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// gravitySampleInterval er hvor ofte tankens gravity_tag lagres som måling.
+// Oftere gir bare støy; stabilitet måles over timer.
+const gravitySampleInterval = 15 * time.Minute
+
+// RecordGravity legger til en hydrometermåling for den aktive gjæringen på
+// tanken. Målingen brukes av steg med gravity-betingelser ved neste sjekk.
+func (e *Engine) RecordGravity(tankNo int, sg float64, at time.Time, source string) (*RunStatus, error) {
+	if err := ValidateGravity(sg); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, err := e.get(tankNo)
+	if err != nil {
+		return nil, err
+	}
+	if at.Before(r.state.StartedAt) || at.After(time.Now().Add(time.Minute)) {
+		return nil, fmt.Errorf("%w: time %s is outside the fermentation", ErrInvalidGravity, at.Format(time.RFC3339))
+	}
+	if err := e.record(r, GravityReading{
+		TankNo:  tankNo,
+		BatchID: r.state.BatchID,
+		Time:    at,
+		Gravity: sg,
+		Source:  source,
+	}); err != nil {
+		return nil, err
+	}
+
+	e.log.Info().
+		Int("tank", tankNo).
+		Float64("gravity", sg).
+		Str("source", source).
+		Msg("🧪 Gravity reading recorded")
+
+	status := r.status(time.Now())
+	return &status, nil
+}
+
+// Gravity returnerer målingene for den aktive gjæringen på tanken, eldste først.
+func (e *Engine) Gravity(tankNo int) ([]GravityReading, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, err := e.get(tankNo)
+	if err != nil {
+		return nil, err
+	}
+	return append([]GravityReading{}, r.gravity...), nil
+}
+
+// record lagrer målingen og holder r.gravity sortert på tid. Første måling
+// blir OG hvis den ikke ble oppgitt ved start. Må kalles med e.mu låst.
+func (e *Engine) record(r *run, g GravityReading) error {
+	if err := e.store.SaveGravity(g); err != nil {
+		return err
+	}
+	i := sort.Search(len(r.gravity), func(i int) bool { return r.gravity[i].Time.After(g.Time) })
+	r.gravity = append(r.gravity, GravityReading{})
+	copy(r.gravity[i+1:], r.gravity[i:])
+	r.gravity[i] = g
+
+	if r.state.OriginalGravity == nil {
+		og := g.Gravity
+		r.state.OriginalGravity = &og
+		e.persist(r)
+	}
+	return nil
+}
+
+// sampleGravity lagrer tankens gravity_tag hvert gravitySampleInterval.
+// Bare verdier som er målt siden forrige lagring og er nyere enn intervallet
+// tas med, så et hydrometer som har sluttet å sende ikke gir nye målinger av
+// samme verdi. Må kalles med e.mu låst.
+func (e *Engine) sampleGravity(r *run, now time.Time) {
+	if now.Sub(r.lastGravitySample) < gravitySampleInterval {
+		return
+	}
+	tank, ok := e.tanks.Get(r.state.TankNo)
+	if !ok || tank.Gravity == nil {
+		return
+	}
+	if !tank.GravityAt.After(r.lastGravityAt) || now.Sub(tank.GravityAt) > gravitySampleInterval {
+		return
+	}
+	sg := *tank.Gravity
+	if err := ValidateGravity(sg); err != nil {
+		e.log.Debug().Err(err).Int("tank", r.state.TankNo).Msg("Ignoring gravity tag value")
+		return
+	}
+
+	r.lastGravitySample, r.lastGravityAt = now, tank.GravityAt
+	if err := e.record(r, GravityReading{
+		TankNo:  r.state.TankNo,
+		BatchID: r.state.BatchID,
+		Time:    now,
+		Gravity: sg,
+		Source:  GravitySourceTag,
+	}); err != nil {
+		e.log.Error().Err(err).Int("tank", r.state.TankNo).Msg("❌ Failed to store gravity reading")
+	}
+}
+
+// stepGravity er målingene tatt etter at nåværende steg startet og fram til
+// now. Målinger fra tidligere steg teller ikke, ellers ville samme måling
+// avslutte flere steg etter hverandre.
+func (r *run) stepGravity(now time.Time) []GravityReading {
+	from := sort.Search(len(r.gravity), func(i int) bool { return r.gravity[i].Time.After(r.state.StepStartedAt) })
+	to := sort.Search(len(r.gravity), func(i int) bool { return r.gravity[i].Time.After(now) })
+	if to < from {
+		return nil
+	}
+	return r.gravity[from:to]
+}
+
+// gravityReached sier om alle gravity-betingelsene for steget er oppfylt ved now.
+func (r *run) gravityReached(step FermentationStep, now time.Time) bool {
+	readings := r.stepGravity(now)
+	if len(readings) == 0 {
+		return false
+	}
+	latest := readings[len(readings)-1]
+	if step.GravityBelow > 0 && latest.Gravity > step.GravityBelow {
+		return false
+	}
+	if step.AttenuationAbove > 0 {
+		att := r.attenuation(latest.Gravity)
+		if att == nil || *att < step.AttenuationAbove {
+			return false
+		}
+	}
+	if step.GravityStable > 0 && !gravityStable(readings, step.GravityStable, step.GravityStableHours) {
+		return false
+	}
+	return true
+}
+
+// gravityStable sier om SG har holdt seg innenfor tol de siste hours timene
+// fram til siste måling. Vinduet slutter ved siste måling og ikke nå, så
+// stillhet fra et hydrometer som har falt ut aldri regnes som stabilitet, og
+// det må finnes en måling fra før vinduet, ellers vet vi ikke at den har vært
+// stabil lenge nok.
+func gravityStable(readings []GravityReading, tol, hours float64) bool {
+	if len(readings) == 0 {
+		return false
+	}
+	last := readings[len(readings)-1].Time
+	from := last.Add(-time.Duration(hours * float64(time.Hour)))
+	i := sort.Search(len(readings), func(i int) bool { return readings[i].Time.After(from) })
+	if i == 0 {
+		return false
+	}
+
+	lo, hi := readings[i-1].Gravity, readings[i-1].Gravity
+	for _, g := range readings[i:] {
+		lo, hi = min(lo, g.Gravity), max(hi, g.Gravity)
+	}
+	// Litt slakk så 1.012 − 1.011 regnes som 0.001
+	return hi-lo <= tol+1e-9
+}
+
+// latestGravity er siste måling fram til now, eller nil.
+func (r *run) latestGravity(now time.Time) *GravityReading {
+	for i := len(r.gravity) - 1; i >= 0; i-- {
+		if !r.gravity[i].Time.After(now) {
+			return &r.gravity[i]
+		}
+	}
+	return nil
+}
+
+// attenuation er tilsynelatende forgjæring i prosent, eller nil uten OG.
+func (r *run) attenuation(sg float64) *float64 {
+	og := r.state.OriginalGravity
+	if og == nil || *og <= 1 {
+		return nil
+	}
+	att := (*og - sg) / (*og - 1) * 100
+	return &att
+}
@@ -0,0 +1,197 @@
+package fermentation
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var gravityT0 = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// readings gir målinger med én time mellom, fra gravityT0.
+func readings(sgs ...float64) []GravityReading {
+	out := make([]GravityReading, len(sgs))
+	for i, sg := range sgs {
+		out[i] = GravityReading{Time: gravityT0.Add(time.Duration(i) * time.Hour), Gravity: sg}
+	}
+	return out
+}
+
+func TestGravityStable(t *testing.T) {
+	tests := []struct {
+		name     string
+		readings []GravityReading
+		tol      float64
+		hours    float64
+		want     bool
+	}{
+		{"no readings", nil, 0.001, 2, false},
+		{"flat over window", readings(1.020, 1.012, 1.012, 1.012), 0.001, 2, true},
+		{"within tolerance", readings(1.020, 1.012, 1.011, 1.012), 0.001, 2, true},
+		{"still dropping", readings(1.020, 1.015, 1.013, 1.011), 0.001, 2, false},
+		{"drop at window start counts", readings(1.014, 1.012, 1.012), 0.001, 2, false},
+		{"too short history", readings(1.012, 1.012), 0.001, 2, false},
+		{"exact window", readings(1.012, 1.012, 1.012), 0.001, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gravityStable(tt.readings, tt.tol, tt.hours); got != tt.want {
+				t.Errorf("gravityStable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepGravity(t *testing.T) {
+	r := &run{gravity: readings(1.050, 1.040, 1.030, 1.020)}
+	r.state.StepStartedAt = gravityT0.Add(time.Hour) // målingen kl. 1 er fra forrige steg
+
+	got := r.stepGravity(gravityT0.Add(2 * time.Hour))
+	if len(got) != 1 || got[0].Gravity != 1.030 {
+		t.Fatalf("stepGravity = %+v, want only the 1.030 reading", got)
+	}
+	if got := r.stepGravity(gravityT0.Add(30 * time.Minute)); len(got) != 0 {
+		t.Errorf("stepGravity before step start = %+v, want none", got)
+	}
+	if got := r.stepGravity(gravityT0.Add(10 * time.Hour)); len(got) != 2 {
+		t.Errorf("stepGravity = %d readings, want 2", len(got))
+	}
+}
+
+func TestGravityReached(t *testing.T) {
+	og := 1.050
+	r := &run{gravity: readings(1.050, 1.030, 1.014, 1.012, 1.012, 1.012)}
+	r.state.StepStartedAt = gravityT0.Add(-time.Minute)
+	r.state.OriginalGravity = &og
+	end := gravityT0.Add(5 * time.Hour)
+
+	tests := []struct {
+		name string
+		step FermentationStep
+		now  time.Time
+		want bool
+	}{
+		{"below reached", FermentationStep{GravityBelow: 1.012}, end, true},
+		{"below not reached", FermentationStep{GravityBelow: 1.010}, end, false},
+		{"below not reached yet", FermentationStep{GravityBelow: 1.012}, gravityT0.Add(2 * time.Hour), false},
+		{"attenuation reached", FermentationStep{AttenuationAbove: 75}, end, true},
+		{"attenuation not reached", FermentationStep{AttenuationAbove: 80}, end, false},
+		{"stable", FermentationStep{GravityStable: 0.001, GravityStableHours: 2}, end, true},
+		{"not stable long enough", FermentationStep{GravityStable: 0.001, GravityStableHours: 3}, end, false},
+		{"all conditions", FermentationStep{GravityBelow: 1.013, AttenuationAbove: 70, GravityStable: 0.001, GravityStableHours: 2}, end, true},
+		{"one condition fails", FermentationStep{GravityBelow: 1.011, AttenuationAbove: 70, GravityStable: 0.001, GravityStableHours: 2}, end, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.gravityReached(tt.step, tt.now); got != tt.want {
+				t.Errorf("gravityReached = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Uten OG kan forgjæringen ikke regnes ut
+	r.state.OriginalGravity = nil
+	if r.gravityReached(FermentationStep{AttenuationAbove: 50}, end) {
+		t.Error("attenuation condition without OG should not be reached")
+	}
+
+	// Målinger fra før steget startet teller ikke
+	r.state.StepStartedAt = end
+	if r.gravityReached(FermentationStep{GravityBelow: 1.020}, end.Add(time.Hour)) {
+		t.Error("readings from the previous step must not end the new step")
+	}
+}
+
+func TestGravityAdvancesOneStepPerTick(t *testing.T) {
+	gravityStep := FermentationStep{Temperature: 18, DurationHours: 240, GravityBelow: 1.015}
+	e, _, tanks, _ := newTestEngine(t, gravityStep, gravityStep, FermentationStep{Temperature: 2, DurationHours: 48})
+	tanks.Update(testTemp, 18.0, time.Now())
+	var events []Event
+	e.OnEvent(func(ev Event) { events = append(events, ev) })
+
+	og := 1.050
+	if _, err := e.Start(1, 1, "b1", 0, &og); err != nil {
+		t.Fatal(err)
+	}
+	rewind(e, 1, time.Hour)
+	if _, err := e.RecordGravity(1, 1.012, time.Now().Add(-time.Minute), GravitySourceAPI); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	e.tick(ctx)
+	e.tick(ctx)
+	st := e.Active()[0]
+	if st.StepIndex != 1 {
+		t.Fatalf("step index = %d, want 1: one reading may only end one step", st.StepIndex)
+	}
+	if last := events[len(events)-1]; last.Type != EventStepGravity || last.StepIndex != 1 {
+		t.Errorf("last event = %+v, want step_gravity to step 1", last)
+	}
+
+	// En ny måling i steg 2 avslutter det
+	if _, err := e.RecordGravity(1, 1.011, time.Now(), GravitySourceAPI); err != nil {
+		t.Fatal(err)
+	}
+	e.tick(ctx)
+	if st := e.Active()[0]; st.StepIndex != 2 || st.TargetTemp != 2 {
+		t.Errorf("after new reading: step %d target %g, want step 2 target 2", st.StepIndex, st.TargetTemp)
+	}
+}
+
+func TestSampleGravitySkipsStaleValues(t *testing.T) {
+	e, _, tanks, store := newTestEngine(t, FermentationStep{Temperature: 18, DurationHours: 240})
+	if _, err := e.Start(1, 1, "b1", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	e.mu.Lock()
+	r := e.runs[1]
+	e.mu.Unlock()
+
+	sample := func(now time.Time) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.sampleGravity(r, now)
+	}
+
+	now := time.Now()
+	measured := now.Add(-time.Minute)
+	tanks.Update(testGravity, 1.048, measured)
+	sample(now)
+	if len(store.gravity) != 1 || store.gravity[0].Gravity != 1.048 || store.gravity[0].Source != GravitySourceTag {
+		t.Fatalf("stored readings = %+v, want one tag reading of 1.048", store.gravity)
+	}
+	if r.state.OriginalGravity == nil || *r.state.OriginalGravity != 1.048 {
+		t.Errorf("first reading should become OG, got %v", r.state.OriginalGravity)
+	}
+
+	// Hydrometeret har ikke sendt noe nytt: samme verdi lagres ikke igjen
+	now = now.Add(gravitySampleInterval)
+	sample(now)
+	if len(store.gravity) != 1 {
+		t.Fatalf("stale value was stored again: %+v", store.gravity)
+	}
+
+	// En ny verdi som er eldre enn intervallet er også for gammel
+	tanks.Update(testGravity, 1.046, now.Add(-2*gravitySampleInterval))
+	sample(now)
+	if len(store.gravity) != 1 {
+		t.Fatalf("old value was stored: %+v", store.gravity)
+	}
+
+	// Ferske målinger lagres, men maks én per intervall
+	tanks.Update(testGravity, 1.044, now.Add(-time.Second))
+	sample(now)
+	tanks.Update(testGravity, 1.043, now.Add(time.Minute))
+	sample(now.Add(2 * time.Minute))
+	if len(store.gravity) != 2 || store.gravity[1].Gravity != 1.044 {
+		t.Fatalf("stored readings = %+v, want 1.048 and 1.044", store.gravity)
+	}
+
+	// Ugyldige verdier ignoreres
+	tanks.Update(testGravity, 12.5, now.Add(gravitySampleInterval))
+	sample(now.Add(gravitySampleInterval))
+	if len(store.gravity) != 2 {
+		t.Fatalf("invalid value was stored: %+v", store.gravity)
+	}
+}
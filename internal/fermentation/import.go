@@ -0,0 +1,140 @@
+package fermentation
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Resultat av en import.
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+)
+
+// ImportResult sier hva ImportPlan gjorde. Previous er planen før en
+// oppdatering, for audit-loggen.
+type ImportResult struct {
+	Status   string
+	Plan     FermentationPlan
+	Previous *FermentationPlan
+}
+
+// ImportPlan lagrer en plan fra en ekstern kilde (f.eks. "brewfather:batch"),
+// nøklet på source + plan.RecipeID, i én transaksjon:
+//
+//   - finnes den ikke fra før, opprettes den (created)
+//   - er innholdet likt forrige import, gjøres ingenting (unchanged), så lokale
+//     justeringer overlever en ny import av en uendret batch
+//   - ellers erstattes navn og steg (updated), med samme regler som UpdatePlan
+//     for planer som kjører
+//
+// Planer uten source røres aldri, selv med samme recipe_id: de er laget
+// lokalt (f.eks. inline ved start, der recipe_id er batch-ID-en).
+// Planen valideres med de samme grensene som lokale planer.
+func (s *SQLiteStore) ImportPlan(source string, plan FermentationPlan) (*ImportResult, error) {
+	if source == "" || plan.RecipeID == "" {
+		return nil, fmt.Errorf("import needs a source and a recipe id")
+	}
+	plan.Renumber()
+	plan.Source = source
+	if err := ValidatePlan(plan); err != nil {
+		return nil, err
+	}
+	hash, err := planHash(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var existing struct {
+		ID         int64  `db:"id"`
+		SourceHash string `db:"source_hash"`
+		Version    int    `db:"version"`
+	}
+	err = tx.Get(&existing, `
+		SELECT id, source_hash, version FROM fermentation_plans
+		WHERE recipe_id = ? AND source = ?;
+	`, plan.RecipeID, source)
+
+	res := &ImportResult{Plan: plan}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		res.Status = ImportCreated
+		if res.Plan.ID, err = insertPlan(tx, plan, source, hash); err != nil {
+			return nil, err
+		}
+		res.Plan.Version = 1
+	case err != nil:
+		return nil, fmt.Errorf("find imported plan %s: %w", plan.RecipeID, err)
+	case existing.SourceHash == hash:
+		res.Status = ImportUnchanged
+		res.Plan.ID, res.Plan.Version = existing.ID, existing.Version
+		return res, nil
+	default:
+		res.Status = ImportUpdated
+		res.Plan.ID = existing.ID
+		if res.Previous, err = getPlan(tx, existing.ID); err != nil {
+			return nil, err
+		}
+		res.Plan.Version = existing.Version
+		if res.Plan.Version, err = updatePlan(tx, res.Plan); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE fermentation_plans SET source = ?, source_hash = ? WHERE id = ?;`,
+			source, hash, existing.ID); err != nil {
+			return nil, fmt.Errorf("update plan source %d: %w", existing.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return res, nil
+}
+
+// planHash er en hash av det som importeres. Endres batchen i kilden (eller
+// måten vi tolker den på), endres hashen.
+func planHash(plan FermentationPlan) (string, error) {
+	b, err := json.Marshal(struct {
+		Name  string             `json:"name"`
+		Steps []FermentationStep `json:"steps"`
+	}{plan.Name, plan.Steps})
+	if err != nil {
+		return "", fmt.Errorf("hash plan: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func getPlan(tx *sqlx.Tx, id int64) (*FermentationPlan, error) {
+	var plan FermentationPlan
+	if err := tx.Get(&plan, `
+		SELECT id, name, recipe_id, total_steps, source, version
+		FROM fermentation_plans
+		WHERE id = ?;
+	`, id); err != nil {
+		return nil, fmt.Errorf("get plan %d: %w", id, err)
+	}
+	if err := tx.Select(&plan.Steps, `
+		SELECT step_number, temperature, duration_hours, ramp_hours, description, type,
+			gravity_below, attenuation_above, gravity_stable, gravity_stable_hours
+		FROM fermentation_steps
+		WHERE plan_id = ?
+		ORDER BY step_number ASC;
+	`, id); err != nil {
+		return nil, fmt.Errorf("list steps for plan %d: %w", id, err)
+	}
+	return &plan, nil
+}
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS fermentation_plans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    recipe_id TEXT NOT NULL,
+    total_steps INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS fermentation_steps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    plan_id INTEGER NOT NULL,
+    step_number INTEGER NOT NULL,
+    temperature REAL NOT NULL,
+    duration_hours REAL NOT NULL,
+    description TEXT,
+    type TEXT,
+    FOREIGN KEY(plan_id) REFERENCES fermentation_plans(id)
+);
+
+CREATE TABLE IF NOT EXISTS fermentation_states (
+    tank_no INTEGER PRIMARY KEY,
+    batch_id TEXT NOT NULL,
+    plan_id INTEGER NOT NULL,
+    step_index INTEGER NOT NULL,
+    started_at DATETIME NOT NULL,
+    step_started_at DATETIME NOT NULL,
+    target_temp REAL NOT NULL,
+    status TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(plan_id) REFERENCES fermentation_plans(id)
+);
@@ -0,0 +1,8 @@
+-- Hvor en plan er importert fra (f.eks. "brewfather:batch") og hash av det
+-- som ble importert. Tom source = laget lokalt. Samme kilde-ID importeres
+-- aldri til to planer, så ny import oppdaterer i stedet for å duplisere.
+ALTER TABLE fermentation_plans ADD COLUMN source TEXT NOT NULL DEFAULT '';
+ALTER TABLE fermentation_plans ADD COLUMN source_hash TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_fermentation_plans_source
+    ON fermentation_plans(source, recipe_id) WHERE source != '';
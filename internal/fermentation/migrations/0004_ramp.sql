@@ -0,0 +1,4 @@
+-- Ramper: steget går lineært fra forrige setpunkt (ramp_from i tilstanden)
+-- til stegets temperatur over ramp_hours, som er en del av duration_hours.
+ALTER TABLE fermentation_steps ADD COLUMN ramp_hours REAL NOT NULL DEFAULT 0;
+ALTER TABLE fermentation_states ADD COLUMN ramp_from REAL;
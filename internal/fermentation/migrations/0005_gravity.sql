@@ -0,0 +1,19 @@
+-- Gravity-betingelser for steg (0 = av) og målinger per batch. Et steg med
+-- betingelser avsluttes når alle er oppfylt, eller senest etter duration_hours.
+ALTER TABLE fermentation_steps ADD COLUMN gravity_below REAL NOT NULL DEFAULT 0;
+ALTER TABLE fermentation_steps ADD COLUMN attenuation_above REAL NOT NULL DEFAULT 0;
+ALTER TABLE fermentation_steps ADD COLUMN gravity_stable REAL NOT NULL DEFAULT 0;
+ALTER TABLE fermentation_steps ADD COLUMN gravity_stable_hours REAL NOT NULL DEFAULT 0;
+
+ALTER TABLE fermentation_states ADD COLUMN original_gravity REAL;
+
+CREATE TABLE IF NOT EXISTS gravity_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tank_no INTEGER NOT NULL,
+    batch_id TEXT NOT NULL,
+    ts DATETIME NOT NULL,
+    gravity REAL NOT NULL,
+    source TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_gravity_readings_batch ON gravity_readings(tank_no, batch_id, ts);
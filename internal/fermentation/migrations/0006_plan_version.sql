@@ -0,0 +1,4 @@
+-- Økes ved hver endring av planen. UpdatePlan oppdaterer bare hvis versjonen
+-- er den samme som da planen ble lest, så to samtidige redigeringer ikke
+-- overskriver hverandre i stillhet.
+ALTER TABLE fermentation_plans ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,165 @@
+package fermentation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Grenser for steg som lagres. Temperaturene dekker alt fra cold crash til
+// kveik med god margin; utenfor dette er det nesten alltid en tastefeil.
+const (
+	MinStepTemperature = -5.0
+	MaxStepTemperature = 40.0
+	MaxStepHours       = 365 * 24.0
+
+	// Gyldige gravity-verdier (SG). Lett øl kan ende under 1.000.
+	MinGravity = 0.980
+	MaxGravity = 1.200
+)
+
+// Feil fra redigering av planer.
+var (
+	ErrInvalidPlan    = errors.New("invalid fermentation plan")
+	ErrPlanInUse      = errors.New("fermentation plan is in use")
+	ErrPlanChanged    = errors.New("fermentation plan was changed by someone else")
+	ErrInvalidGravity = errors.New("invalid gravity reading")
+)
+
+// ValidateStep sjekker at et steg har positiv varighet, en rampe som får plass
+// i steget, fornuftig temperatur og gyldige gravity-betingelser.
+func ValidateStep(s FermentationStep) error {
+	switch {
+	case math.IsNaN(s.DurationHours) || s.DurationHours <= 0:
+		return fmt.Errorf("%w: step %d: duration_hours must be positive, got %g", ErrInvalidPlan, s.StepNumber, s.DurationHours)
+	case s.DurationHours > MaxStepHours:
+		return fmt.Errorf("%w: step %d: duration_hours must be at most %g, got %g", ErrInvalidPlan, s.StepNumber, MaxStepHours, s.DurationHours)
+	case math.IsNaN(s.RampHours) || s.RampHours < 0 || s.RampHours > s.DurationHours:
+		return fmt.Errorf("%w: step %d: ramp_hours must be between 0 and duration_hours (%g), got %g",
+			ErrInvalidPlan, s.StepNumber, s.DurationHours, s.RampHours)
+	case math.IsNaN(s.Temperature) || s.Temperature < MinStepTemperature || s.Temperature > MaxStepTemperature:
+		return fmt.Errorf("%w: step %d: temperature must be between %g and %g °C, got %g",
+			ErrInvalidPlan, s.StepNumber, MinStepTemperature, MaxStepTemperature, s.Temperature)
+	case s.GravityBelow != 0 && !validGravity(s.GravityBelow):
+		return fmt.Errorf("%w: step %d: gravity_below must be between %g and %g, got %g",
+			ErrInvalidPlan, s.StepNumber, MinGravity, MaxGravity, s.GravityBelow)
+	case math.IsNaN(s.AttenuationAbove) || s.AttenuationAbove < 0 || s.AttenuationAbove > 100:
+		return fmt.Errorf("%w: step %d: attenuation_above must be between 0 and 100 %%, got %g",
+			ErrInvalidPlan, s.StepNumber, s.AttenuationAbove)
+	case math.IsNaN(s.GravityStable) || s.GravityStable < 0 || s.GravityStable > 0.02:
+		return fmt.Errorf("%w: step %d: gravity_stable must be between 0 and 0.02, got %g",
+			ErrInvalidPlan, s.StepNumber, s.GravityStable)
+	case (s.GravityStable > 0) != (s.GravityStableHours > 0):
+		return fmt.Errorf("%w: step %d: gravity_stable and gravity_stable_hours must be set together",
+			ErrInvalidPlan, s.StepNumber)
+	case math.IsNaN(s.GravityStableHours) || s.GravityStableHours > MaxStepHours:
+		return fmt.Errorf("%w: step %d: gravity_stable_hours must be at most %g, got %g",
+			ErrInvalidPlan, s.StepNumber, MaxStepHours, s.GravityStableHours)
+	}
+	return nil
+}
+
+// ValidateGravity sjekker at en måling er en mulig SG.
+func ValidateGravity(sg float64) error {
+	if !validGravity(sg) {
+		return fmt.Errorf("%w: %g is outside %g–%g", ErrInvalidGravity, sg, MinGravity, MaxGravity)
+	}
+	return nil
+}
+
+func validGravity(sg float64) bool {
+	return !math.IsNaN(sg) && sg >= MinGravity && sg <= MaxGravity
+}
+
+// ValidatePlan sjekker navn og alle steg. En plan må ha minst ett steg.
+func ValidatePlan(p FermentationPlan) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPlan)
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("%w: at least one step is required", ErrInvalidPlan)
+	}
+	for _, s := range p.Steps {
+		if err := ValidateStep(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Renumber setter step_number til 1..n i rekkefølge og oppdaterer TotalSteps.
+func (p *FermentationPlan) Renumber() {
+	for i := range p.Steps {
+		p.Steps[i].StepNumber = i + 1
+	}
+	p.TotalSteps = len(p.Steps)
+}
+
+// Copy gir en kopi av planen med egne steg.
+func (p FermentationPlan) Copy() FermentationPlan {
+	p.Steps = append([]FermentationStep(nil), p.Steps...)
+	return p
+}
+
+// InsertStep setter inn s som steg nummer pos (1-basert). pos 0 legger til sist.
+func (p *FermentationPlan) InsertStep(pos int, s FermentationStep) error {
+	if pos == 0 {
+		pos = len(p.Steps) + 1
+	}
+	if pos < 1 || pos > len(p.Steps)+1 {
+		return fmt.Errorf("%w: position %d (plan has %d steps)", ErrInvalidStep, pos, len(p.Steps))
+	}
+	s.StepNumber = pos
+	if err := ValidateStep(s); err != nil {
+		return err
+	}
+	p.Steps = append(p.Steps, FermentationStep{})
+	copy(p.Steps[pos:], p.Steps[pos-1:])
+	p.Steps[pos-1] = s
+	p.Renumber()
+	return nil
+}
+
+// ReplaceStep erstatter steg nummer n (1-basert).
+func (p *FermentationPlan) ReplaceStep(n int, s FermentationStep) error {
+	if n < 1 || n > len(p.Steps) {
+		return fmt.Errorf("%w: %d (plan has %d steps)", ErrInvalidStep, n, len(p.Steps))
+	}
+	s.StepNumber = n
+	if err := ValidateStep(s); err != nil {
+		return err
+	}
+	p.Steps[n-1] = s
+	return nil
+}
+
+// MoveStep flytter steg nummer from til plass to (begge 1-basert).
+func (p *FermentationPlan) MoveStep(from, to int) error {
+	if from < 1 || from > len(p.Steps) {
+		return fmt.Errorf("%w: %d (plan has %d steps)", ErrInvalidStep, from, len(p.Steps))
+	}
+	if to < 1 || to > len(p.Steps) {
+		return fmt.Errorf("%w: %d (plan has %d steps)", ErrInvalidStep, to, len(p.Steps))
+	}
+	s := p.Steps[from-1]
+	p.Steps = append(p.Steps[:from-1], p.Steps[from:]...)
+	p.Steps = append(p.Steps, FermentationStep{})
+	copy(p.Steps[to:], p.Steps[to-1:])
+	p.Steps[to-1] = s
+	p.Renumber()
+	return nil
+}
+
+// DeleteStep fjerner steg nummer n (1-basert). Det siste steget kan ikke fjernes.
+func (p *FermentationPlan) DeleteStep(n int) error {
+	if n < 1 || n > len(p.Steps) {
+		return fmt.Errorf("%w: %d (plan has %d steps)", ErrInvalidStep, n, len(p.Steps))
+	}
+	if len(p.Steps) == 1 {
+		return fmt.Errorf("%w: a plan needs at least one step; delete the plan instead", ErrInvalidPlan)
+	}
+	p.Steps = append(p.Steps[:n-1], p.Steps[n:]...)
+	p.Renumber()
+	return nil
+}
@@ -0,0 +1,125 @@
+package fermentation
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func validStep() FermentationStep {
+	return FermentationStep{StepNumber: 1, Temperature: 18, DurationHours: 72}
+}
+
+func TestValidateStep(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*FermentationStep)
+		ok   bool
+	}{
+		{"valid", func(*FermentationStep) {}, true},
+		{"ramp whole step", func(s *FermentationStep) { s.RampHours = 72 }, true},
+		{"cold crash", func(s *FermentationStep) { s.Temperature = 0 }, true},
+		{"gravity conditions", func(s *FermentationStep) {
+			s.GravityBelow, s.AttenuationAbove, s.GravityStable, s.GravityStableHours = 1.012, 75, 0.001, 48
+		}, true},
+		{"zero duration", func(s *FermentationStep) { s.DurationHours = 0 }, false},
+		{"NaN duration", func(s *FermentationStep) { s.DurationHours = math.NaN() }, false},
+		{"too long", func(s *FermentationStep) { s.DurationHours = MaxStepHours + 1 }, false},
+		{"negative ramp", func(s *FermentationStep) { s.RampHours = -1 }, false},
+		{"ramp longer than step", func(s *FermentationStep) { s.RampHours = 73 }, false},
+		{"too cold", func(s *FermentationStep) { s.Temperature = MinStepTemperature - 0.1 }, false},
+		{"too warm", func(s *FermentationStep) { s.Temperature = MaxStepTemperature + 0.1 }, false},
+		{"NaN temperature", func(s *FermentationStep) { s.Temperature = math.NaN() }, false},
+		{"gravity below out of range", func(s *FermentationStep) { s.GravityBelow = 12 }, false},
+		{"attenuation over 100", func(s *FermentationStep) { s.AttenuationAbove = 101 }, false},
+		{"stable without hours", func(s *FermentationStep) { s.GravityStable = 0.001 }, false},
+		{"hours without stable", func(s *FermentationStep) { s.GravityStableHours = 24 }, false},
+		{"stable too loose", func(s *FermentationStep) { s.GravityStable, s.GravityStableHours = 0.05, 24 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validStep()
+			tt.edit(&s)
+			err := ValidateStep(s)
+			if tt.ok && err != nil {
+				t.Fatalf("ValidateStep: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidPlan) {
+				t.Fatalf("ValidateStep = %v, want ErrInvalidPlan", err)
+			}
+		})
+	}
+}
+
+func TestValidatePlan(t *testing.T) {
+	plan := FermentationPlan{Name: "Ale", Steps: []FermentationStep{validStep(), validStep()}}
+	if err := ValidatePlan(plan); err != nil {
+		t.Fatalf("valid plan: %v", err)
+	}
+
+	for name, p := range map[string]FermentationPlan{
+		"no name":  {Name: "  ", Steps: plan.Steps},
+		"no steps": {Name: "Ale"},
+		"bad step": {Name: "Ale", Steps: []FermentationStep{validStep(), {StepNumber: 2, Temperature: 18}}},
+	} {
+		if err := ValidatePlan(p); !errors.Is(err, ErrInvalidPlan) {
+			t.Errorf("%s: ValidatePlan = %v, want ErrInvalidPlan", name, err)
+		}
+	}
+}
+
+func TestValidateGravity(t *testing.T) {
+	for _, sg := range []float64{MinGravity, 1.010, MaxGravity} {
+		if err := ValidateGravity(sg); err != nil {
+			t.Errorf("ValidateGravity(%g): %v", sg, err)
+		}
+	}
+	for _, sg := range []float64{0, 1.3, math.NaN(), 1050} {
+		if err := ValidateGravity(sg); !errors.Is(err, ErrInvalidGravity) {
+			t.Errorf("ValidateGravity(%g) = %v, want ErrInvalidGravity", sg, err)
+		}
+	}
+}
+
+func TestPlanStepEditing(t *testing.T) {
+	p := FermentationPlan{Name: "Ale", Steps: []FermentationStep{
+		{Temperature: 18, DurationHours: 72},
+		{Temperature: 2, DurationHours: 48},
+	}}
+	p.Renumber()
+
+	if err := p.InsertStep(2, FermentationStep{Temperature: 21, DurationHours: 24}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Steps) != 3 || p.TotalSteps != 3 || p.Steps[1].Temperature != 21 || p.Steps[2].StepNumber != 3 {
+		t.Fatalf("after insert: %+v", p.Steps)
+	}
+	if err := p.InsertStep(5, validStep()); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("insert past end = %v, want ErrInvalidStep", err)
+	}
+	if err := p.InsertStep(0, FermentationStep{Temperature: 99, DurationHours: 1}); !errors.Is(err, ErrInvalidPlan) {
+		t.Errorf("insert invalid step = %v, want ErrInvalidPlan", err)
+	}
+	if len(p.Steps) != 3 {
+		t.Fatalf("failed inserts changed the plan: %+v", p.Steps)
+	}
+
+	if err := p.MoveStep(3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if p.Steps[0].Temperature != 2 || p.Steps[0].StepNumber != 1 || p.Steps[2].Temperature != 21 {
+		t.Fatalf("after move: %+v", p.Steps)
+	}
+	if err := p.DeleteStep(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DeleteStep(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DeleteStep(1); !errors.Is(err, ErrInvalidPlan) {
+		t.Errorf("deleting the last step = %v, want ErrInvalidPlan", err)
+	}
+	if p.TotalSteps != 1 || p.Steps[0].Temperature != 21 {
+		t.Errorf("after delete: %+v", p.Steps)
+	}
+}
@@ -1,10 +1,19 @@
 package fermentation
 
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
 // Henter alle planer
 func (s *SQLiteStore) ListPlans() ([]FermentationPlan, error) {
 	rows := []FermentationPlan{}
 	err := s.DB.Select(&rows, `
-		SELECT id, name, recipe_id, total_steps
+		SELECT id, name, recipe_id, total_steps, source, version
 		FROM fermentation_plans
 		ORDER BY id ASC;
 	`)
@@ -15,7 +24,8 @@ func (s *SQLiteStore) ListPlans() ([]FermentationPlan, error) {
 func (s *SQLiteStore) ListSteps(planID int) ([]FermentationStep, error) {
 	rows := []FermentationStep{}
 	err := s.DB.Select(&rows, `
-		SELECT step_number, temperature, duration_hours, description, type
+		SELECT step_number, temperature, duration_hours, ramp_hours, description, type,
+			gravity_below, attenuation_above, gravity_stable, gravity_stable_hours
 		FROM fermentation_steps
 		WHERE plan_id = ?
 		ORDER BY step_number ASC;
@@ -28,3 +38,219 @@ func (s *SQLiteStore) Clear() error {
 	_, err := s.DB.Exec(`DELETE FROM fermentation_steps; DELETE FROM fermentation_plans;`)
 	return err
 }
+
+// Henter én plan inkludert steps
+func (s *SQLiteStore) GetPlan(id int64) (*FermentationPlan, error) {
+	var plan FermentationPlan
+	err := s.DB.Get(&plan, `
+		SELECT id, name, recipe_id, total_steps, source, version
+		FROM fermentation_plans
+		WHERE id = ?;
+	`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrPlanNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get plan %d: %w", id, err)
+	}
+
+	steps, err := s.ListSteps(int(id))
+	if err != nil {
+		return nil, fmt.Errorf("list steps for plan %d: %w", id, err)
+	}
+	plan.Steps = steps
+	return &plan, nil
+}
+
+// Lagrer (upsert) motorens tilstand for én tank
+func (s *SQLiteStore) SaveState(st FermentationState) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO fermentation_states
+		(tank_no, batch_id, plan_id, step_index, started_at, step_started_at, target_temp, status, paused_at, ramp_from, original_gravity, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(tank_no) DO UPDATE SET
+			batch_id = excluded.batch_id,
+			plan_id = excluded.plan_id,
+			step_index = excluded.step_index,
+			started_at = excluded.started_at,
+			step_started_at = excluded.step_started_at,
+			target_temp = excluded.target_temp,
+			status = excluded.status,
+			paused_at = excluded.paused_at,
+			ramp_from = excluded.ramp_from,
+			original_gravity = excluded.original_gravity,
+			updated_at = excluded.updated_at;
+	`, st.TankNo, st.BatchID, st.PlanID, st.StepIndex, st.StartedAt, st.StepStartedAt,
+		st.TargetTemp, st.Status, st.PausedAt, st.RampFrom, st.OriginalGravity, time.Now())
+	if err != nil {
+		return fmt.Errorf("save state for tank %d: %w", st.TankNo, err)
+	}
+	return nil
+}
+
+// Henter alle gjæringer som var aktive da prosessen sist kjørte
+func (s *SQLiteStore) ListActiveStates() ([]FermentationState, error) {
+	rows := []FermentationState{}
+	err := s.DB.Select(&rows, `
+		SELECT tank_no, batch_id, plan_id, step_index, started_at, step_started_at, target_temp, status, paused_at, ramp_from, original_gravity
+		FROM fermentation_states
+		WHERE status IN (?, ?)
+		ORDER BY tank_no ASC;
+	`, StatusRunning, StatusPaused)
+	return rows, err
+}
+
+// Oppdaterer navn, recipe og steg for en lagret plan og returnerer ny versjon.
+// plan.Version må være versjonen planen ble lest med; har noen andre endret
+// den siden, avvises endringen med ErrPlanChanged.
+func (s *SQLiteStore) UpdatePlan(plan FermentationPlan) (int, error) {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	version, err := updatePlan(tx, plan)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return version, nil
+}
+
+// En plan som kjører på en tank kan redigeres fra nåværende steg og utover,
+// men stegene som allerede er gjennomført må stå urørt, ellers peker
+// step_index på feil steg.
+func updatePlan(tx *sqlx.Tx, plan FermentationPlan) (int, error) {
+	old := []FermentationStep{}
+	if err := tx.Select(&old, `
+		SELECT step_number, temperature, duration_hours, ramp_hours, description, type,
+			gravity_below, attenuation_above, gravity_stable, gravity_stable_hours
+		FROM fermentation_steps
+		WHERE plan_id = ?
+		ORDER BY step_number ASC;
+	`, plan.ID); err != nil {
+		return 0, fmt.Errorf("list steps for plan %d: %w", plan.ID, err)
+	}
+
+	active, err := activeStates(tx, plan.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, st := range active {
+		if st.StepIndex >= len(plan.Steps) {
+			return 0, fmt.Errorf("%w: tank %d is on step %d, the plan cannot be shorter than that",
+				ErrPlanInUse, st.TankNo, st.StepIndex+1)
+		}
+		for i := 0; i < st.StepIndex; i++ {
+			if i >= len(old) || !sameStep(old[i], plan.Steps[i]) {
+				return 0, fmt.Errorf("%w: tank %d is on step %d, steps before it cannot change",
+					ErrPlanInUse, st.TankNo, st.StepIndex+1)
+			}
+		}
+	}
+
+	res, err := tx.Exec(`
+		UPDATE fermentation_plans SET name = ?, recipe_id = ?, total_steps = ?, version = version + 1
+		WHERE id = ? AND version = ?;
+	`, plan.Name, plan.RecipeID, len(plan.Steps), plan.ID, plan.Version)
+	if err != nil {
+		return 0, fmt.Errorf("update plan %d: %w", plan.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var current int
+		if err := tx.Get(&current, `SELECT version FROM fermentation_plans WHERE id = ?;`, plan.ID); err != nil {
+			return 0, fmt.Errorf("%w: %d", ErrPlanNotFound, plan.ID)
+		}
+		return 0, fmt.Errorf("%w: plan %d is at version %d, the edit was based on version %d",
+			ErrPlanChanged, plan.ID, current, plan.Version)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM fermentation_steps WHERE plan_id = ?;`, plan.ID); err != nil {
+		return 0, fmt.Errorf("delete steps for plan %d: %w", plan.ID, err)
+	}
+	if err := insertSteps(tx, plan.ID, plan.Steps); err != nil {
+		return 0, err
+	}
+	return plan.Version + 1, nil
+}
+
+// Sletter én plan med steg. Planer som kjører på en tank kan ikke slettes.
+func (s *SQLiteStore) DeletePlan(id int64) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	active, err := activeStates(tx, id)
+	if err != nil {
+		return err
+	}
+	if len(active) > 0 {
+		return fmt.Errorf("%w: plan %d is %s on tank %d", ErrPlanInUse, id, active[0].Status, active[0].TankNo)
+	}
+
+	res, err := tx.Exec(`DELETE FROM fermentation_plans WHERE id = ?;`, id)
+	if err != nil {
+		return fmt.Errorf("delete plan %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %d", ErrPlanNotFound, id)
+	}
+	if _, err := tx.Exec(`DELETE FROM fermentation_steps WHERE plan_id = ?;`, id); err != nil {
+		return fmt.Errorf("delete steps for plan %d: %w", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// Aktive gjæringer (kjører eller pauset) som bruker planen
+func activeStates(tx *sqlx.Tx, planID int64) ([]FermentationState, error) {
+	rows := []FermentationState{}
+	err := tx.Select(&rows, `
+		SELECT tank_no, batch_id, plan_id, step_index, started_at, step_started_at, target_temp, status, paused_at, ramp_from, original_gravity
+		FROM fermentation_states
+		WHERE plan_id = ? AND status IN (?, ?)
+		ORDER BY tank_no ASC;
+	`, planID, StatusRunning, StatusPaused)
+	if err != nil {
+		return nil, fmt.Errorf("active states for plan %d: %w", planID, err)
+	}
+	return rows, nil
+}
+
+func sameStep(a, b FermentationStep) bool {
+	return a.Temperature == b.Temperature && a.DurationHours == b.DurationHours &&
+		a.RampHours == b.RampHours && a.Description == b.Description && a.Type == b.Type &&
+		a.GravityBelow == b.GravityBelow && a.AttenuationAbove == b.AttenuationAbove &&
+		a.GravityStable == b.GravityStable && a.GravityStableHours == b.GravityStableHours
+}
+
+// Lagrer én gravity-måling
+func (s *SQLiteStore) SaveGravity(g GravityReading) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO gravity_readings (tank_no, batch_id, ts, gravity, source)
+		VALUES (?, ?, ?, ?, ?);
+	`, g.TankNo, g.BatchID, g.Time, g.Gravity, g.Source)
+	if err != nil {
+		return fmt.Errorf("save gravity for tank %d: %w", g.TankNo, err)
+	}
+	return nil
+}
+
+// Henter gravity-målingene for én batch på en tank, eldste først
+func (s *SQLiteStore) ListGravity(tankNo int, batchID string) ([]GravityReading, error) {
+	rows := []GravityReading{}
+	err := s.DB.Select(&rows, `
+		SELECT tank_no, batch_id, ts, gravity, source
+		FROM gravity_readings
+		WHERE tank_no = ? AND batch_id = ?
+		ORDER BY ts ASC;
+	`, tankNo, batchID)
+	return rows, err
+}
@@ -1,8 +1,10 @@
 package fermentation
 
 import (
+	"embed"
 	"fmt"
 
+	"github.com/MrBoggi/goTOV/internal/migrate"
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
 )
@@ -30,51 +32,73 @@ func (s *SQLiteStore) Close() error {
 	return s.DB.Close()
 }
 
-func (s *SQLiteStore) migrate() error {
-	schema := `
-CREATE TABLE IF NOT EXISTS fermentation_plans (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL,
-    recipe_id TEXT NOT NULL,
-    total_steps INTEGER NOT NULL
-);
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations er skjemaendringene for fermentation.db, i rekkefølge.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations",
+	migrate.Migration{
+		Version: 2,
+		Name:    "add_paused_at",
+		// Eldre versjoner la til kolonnen ved oppstart, så den kan finnes allerede
+		Func: func(tx *sqlx.Tx) error {
+			return migrate.EnsureColumn(tx, "fermentation_states", "paused_at", "DATETIME")
+		},
+	},
+)
 
-CREATE TABLE IF NOT EXISTS fermentation_steps (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    plan_id INTEGER NOT NULL,
-    step_number INTEGER NOT NULL,
-    temperature REAL NOT NULL,
-    duration_hours REAL NOT NULL,
-    description TEXT,
-    type TEXT,
-    FOREIGN KEY(plan_id) REFERENCES fermentation_plans(id)
-);
-`
-	_, err := s.DB.Exec(schema)
+func (s *SQLiteStore) migrate() error {
+	_, err := migrate.Up(s.DB, Migrations)
 	return err
 }
 
+// SavePlan lagrer en ny, lokal plan med steg i én transaksjon og gir ID-en.
 func (s *SQLiteStore) SavePlan(plan FermentationPlan) (int64, error) {
-	res, err := s.DB.Exec(`
-INSERT INTO fermentation_plans (name, recipe_id, total_steps)
-VALUES (?, ?, ?)`,
-		plan.Name, plan.RecipeID, len(plan.Steps))
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	planID, err := insertPlan(tx, plan, "", "")
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return planID, nil
+}
+
+func insertPlan(tx *sqlx.Tx, plan FermentationPlan, source, hash string) (int64, error) {
+	res, err := tx.Exec(`
+INSERT INTO fermentation_plans (name, recipe_id, total_steps, source, source_hash)
+VALUES (?, ?, ?, ?, ?)`,
+		plan.Name, plan.RecipeID, len(plan.Steps), source, hash)
 	if err != nil {
 		return 0, fmt.Errorf("insert plan: %w", err)
 	}
 
 	planID, _ := res.LastInsertId()
+	if err := insertSteps(tx, planID, plan.Steps); err != nil {
+		return 0, err
+	}
+	return planID, nil
+}
 
-	for _, step := range plan.Steps {
-		_, err := s.DB.Exec(`
-INSERT INTO fermentation_steps 
-(plan_id, step_number, temperature, duration_hours, description, type)
-VALUES (?, ?, ?, ?, ?, ?)`,
+func insertSteps(tx *sqlx.Tx, planID int64, steps []FermentationStep) error {
+	for _, step := range steps {
+		_, err := tx.Exec(`
+INSERT INTO fermentation_steps
+(plan_id, step_number, temperature, duration_hours, ramp_hours, description, type,
+ gravity_below, attenuation_above, gravity_stable, gravity_stable_hours)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			planID, step.StepNumber, step.Temperature,
-			step.DurationHours, step.Description, step.Type)
+			step.DurationHours, step.RampHours, step.Description, step.Type,
+			step.GravityBelow, step.AttenuationAbove, step.GravityStable, step.GravityStableHours)
 		if err != nil {
-			return 0, fmt.Errorf("insert step: %w", err)
+			return fmt.Errorf("insert step: %w", err)
 		}
 	}
-	return planID, nil
+	return nil
 }
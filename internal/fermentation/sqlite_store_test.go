@@ -0,0 +1,149 @@
+package fermentation
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/migrate"
+)
+
+func openTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "fermentation.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestStoreMigratesToLatest(t *testing.T) {
+	s := openTestStore(t)
+	if v, err := migrate.Current(s.DB); err != nil || v != migrate.Latest(Migrations) {
+		t.Fatalf("schema version = %d, %v; want %d", v, err, migrate.Latest(Migrations))
+	}
+}
+
+func TestUpdatePlanVersion(t *testing.T) {
+	s := openTestStore(t)
+	plan := FermentationPlan{Name: "Ale", Steps: []FermentationStep{validStep()}}
+	plan.Renumber()
+	id, err := s.SavePlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.GetPlan(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Version != 1 {
+		t.Fatalf("new plan has version %d, want 1", stored.Version)
+	}
+
+	// To redigeringer basert på samme versjon: den andre avvises
+	first, second := stored.Copy(), stored.Copy()
+	first.Name, second.Name = "Ale v2", "Ale v2b"
+	v, err := s.UpdatePlan(first)
+	if err != nil || v != 2 {
+		t.Fatalf("UpdatePlan = %d, %v; want version 2", v, err)
+	}
+	if _, err := s.UpdatePlan(second); !errors.Is(err, ErrPlanChanged) {
+		t.Fatalf("stale UpdatePlan = %v, want ErrPlanChanged", err)
+	}
+	if got, _ := s.GetPlan(id); got.Name != "Ale v2" || got.Version != 2 {
+		t.Errorf("plan after stale edit = %q v%d, want %q v2", got.Name, got.Version, "Ale v2")
+	}
+
+	missing := first
+	missing.ID = id + 100
+	if _, err := s.UpdatePlan(missing); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("UpdatePlan of missing plan = %v, want ErrPlanNotFound", err)
+	}
+}
+
+func TestUpdatePlanKeepsCompletedSteps(t *testing.T) {
+	s := openTestStore(t)
+	plan := FermentationPlan{Name: "Ale", Steps: []FermentationStep{validStep(), validStep(), validStep()}}
+	plan.Renumber()
+	id, err := s.SavePlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	if err := s.SaveState(FermentationState{
+		BatchID: "b1", PlanID: id, TankNo: 1, StepIndex: 1,
+		StartedAt: now, StepStartedAt: now, TargetTemp: 18, Status: StatusRunning,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	edit, _ := s.GetPlan(id)
+	edit.Steps[0].Temperature = 20
+	if _, err := s.UpdatePlan(*edit); !errors.Is(err, ErrPlanInUse) {
+		t.Errorf("changing a completed step = %v, want ErrPlanInUse", err)
+	}
+
+	edit, _ = s.GetPlan(id)
+	edit.Steps[2].Temperature = 2
+	if _, err := s.UpdatePlan(*edit); err != nil {
+		t.Errorf("changing a later step: %v", err)
+	}
+	if err := s.DeletePlan(id); !errors.Is(err, ErrPlanInUse) {
+		t.Errorf("DeletePlan of running plan = %v, want ErrPlanInUse", err)
+	}
+}
+
+func TestImportPlan(t *testing.T) {
+	s := openTestStore(t)
+	plan := FermentationPlan{Name: "Batch 12", RecipeID: "abc", Steps: []FermentationStep{validStep()}}
+
+	res, err := s.ImportPlan("brewfather:batch", plan)
+	if err != nil || res.Status != ImportCreated || res.Plan.Version != 1 {
+		t.Fatalf("first import = %+v, %v; want created v1", res, err)
+	}
+	id := res.Plan.ID
+
+	res, err = s.ImportPlan("brewfather:batch", plan)
+	if err != nil || res.Status != ImportUnchanged || res.Plan.ID != id {
+		t.Fatalf("same import = %+v, %v; want unchanged", res, err)
+	}
+
+	plan.Steps[0].Temperature = 19
+	res, err = s.ImportPlan("brewfather:batch", plan)
+	if err != nil || res.Status != ImportUpdated || res.Plan.ID != id || res.Plan.Version != 2 {
+		t.Fatalf("changed import = %+v, %v; want updated v2", res, err)
+	}
+	if res.Previous == nil || res.Previous.Steps[0].Temperature != 18 {
+		t.Errorf("previous plan = %+v, want the 18 °C version", res.Previous)
+	}
+
+	bad := plan.Copy()
+	bad.Steps[0].Temperature = 90
+	if _, err := s.ImportPlan("brewfather:batch", bad); !errors.Is(err, ErrInvalidPlan) {
+		t.Errorf("invalid import = %v, want ErrInvalidPlan", err)
+	}
+}
+
+func TestImportPlanLeavesLocalPlansAlone(t *testing.T) {
+	s := openTestStore(t)
+	local := FermentationPlan{Name: "Local", RecipeID: "abc", Steps: []FermentationStep{validStep()}}
+	local.Renumber()
+	localID, err := s.SavePlan(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.ImportPlan("brewfather:batch", FermentationPlan{
+		Name: "Imported", RecipeID: "abc", Steps: []FermentationStep{{Temperature: 12, DurationHours: 24}},
+	})
+	if err != nil || res.Status != ImportCreated || res.Plan.ID == localID {
+		t.Fatalf("import = %+v, %v; want a new plan", res, err)
+	}
+	got, err := s.GetPlan(localID)
+	if err != nil || got.Name != "Local" || got.Steps[0].Temperature != 18 || got.Source != "" {
+		t.Errorf("local plan after import = %+v, %v; want it untouched", got, err)
+	}
+}
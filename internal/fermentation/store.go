@@ -1 +1,11 @@
 package fermentation
+
+// Store er det prosessmotoren trenger fra lagringslaget.
+// SQLiteStore implementerer dette.
+type Store interface {
+	GetPlan(id int64) (*FermentationPlan, error)
+	SaveState(state FermentationState) error
+	ListActiveStates() ([]FermentationState, error)
+	SaveGravity(reading GravityReading) error
+	ListGravity(tankNo int, batchID string) ([]GravityReading, error)
+}
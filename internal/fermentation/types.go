@@ -1,30 +1,98 @@
 package fermentation
 
+import "time"
+
 // Et enkelt steg i en plan vi LAGRER i SQLite.
 type FermentationStep struct {
 	StepNumber    int     `db:"step_number" json:"step_number"`
 	Temperature   float64 `db:"temperature" json:"temperature"`
 	DurationHours float64 `db:"duration_hours" json:"duration_hours"`
+	RampHours     float64 `db:"ramp_hours" json:"ramp_hours"` // 0 = hopp rett til temperaturen
 	Description   string  `db:"description" json:"description"`
 	Type          string  `db:"type" json:"type"`
+
+	// Gravity-betingelser (0 = av). Med minst én satt avsluttes steget når
+	// alle er oppfylt, og DurationHours blir maks-tiden.
+	GravityBelow       float64 `db:"gravity_below" json:"gravity_below"`               // SG ≤ dette
+	AttenuationAbove   float64 `db:"attenuation_above" json:"attenuation_above"`       // tilsynelatende forgjæring ≥ dette, i %
+	GravityStable      float64 `db:"gravity_stable" json:"gravity_stable"`             // SG har variert maks dette …
+	GravityStableHours float64 `db:"gravity_stable_hours" json:"gravity_stable_hours"` // … de siste så mange timene
+}
+
+// HasGravityCondition sier om steget kan avsluttes på gravity før tiden er ute.
+func (s FermentationStep) HasGravityCondition() bool {
+	return s.GravityBelow > 0 || s.AttenuationAbove > 0 || s.GravityStable > 0
 }
 
 // Selve planen – én plan per recipe.
 type FermentationPlan struct {
-	ID         int64              `db:"id"`
-	Name       string             `db:"name"`
-	RecipeID   string             `db:"recipe_id"`
-	TotalSteps int                `db:"total_steps"`
-	Steps      []FermentationStep `db:"-"` // hentes separat
+	ID         int64              `db:"id" json:"id"`
+	Name       string             `db:"name" json:"name"`
+	RecipeID   string             `db:"recipe_id" json:"recipe_id"`
+	TotalSteps int                `db:"total_steps" json:"total_steps"`
+	Source     string             `db:"source" json:"source"`   // tom for planer laget lokalt
+	Version    int                `db:"version" json:"version"` // økes ved hver endring
+	Steps      []FermentationStep `db:"-" json:"steps"`         // hentes separat
 }
 
-// Til bruk av prosessmotoren (kommer senere)
+// Statusverdier for en kjørende gjæring.
+const (
+	StatusRunning   = "running"
+	StatusPaused    = "paused"
+	StatusCompleted = "completed"
+	StatusAborted   = "aborted"
+)
+
+// FermentationState er prosessmotorens tilstand for én plan bundet til én tank.
 type FermentationState struct {
-	BatchID       string  `db:"batch_id"`
-	TankNo        int     `db:"tank_no"`
-	StepIndex     int     `db:"step_index"`
-	StartedAt     string  `db:"started_at"`
-	StepStartedAt string  `db:"step_started_at"`
-	TargetTemp    float64 `db:"target_temp"`
-	Status        string  `db:"status"`
+	BatchID       string     `db:"batch_id" json:"batch_id"`
+	PlanID        int64      `db:"plan_id" json:"plan_id"`
+	TankNo        int        `db:"tank_no" json:"tank_no"`
+	StepIndex     int        `db:"step_index" json:"step_index"`
+	StartedAt     time.Time  `db:"started_at" json:"started_at"`
+	StepStartedAt time.Time  `db:"step_started_at" json:"step_started_at"`
+	TargetTemp    float64    `db:"target_temp" json:"target_temp"`
+	Status        string     `db:"status" json:"status"`
+	PausedAt      *time.Time `db:"paused_at" json:"paused_at"`
+	RampFrom      *float64   `db:"ramp_from" json:"ramp_from"` // setpunktet rampen startet fra
+	// OG for forgjæringen; første måling hvis den ikke er oppgitt ved start
+	OriginalGravity *float64 `db:"original_gravity" json:"original_gravity"`
+}
+
+// Hendelsestyper motoren sender til lyttere.
+const (
+	EventStarted     = "started"
+	EventStep        = "step"         // automatisk steg-overgang
+	EventStepManual  = "step_manual"  // skip/jump fra API
+	EventStepGravity = "step_gravity" // steg-overgang fordi gravity-betingelsene ble oppfylt
+	EventPaused      = "paused"
+	EventResumed     = "resumed"
+	EventCompleted   = "completed"
+	EventAborted     = "aborted"
+)
+
+// Event beskriver én tilstandsendring i en gjæring.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	TankNo     int       `json:"tank_no"`
+	BatchID    string    `json:"batch_id"`
+	PlanName   string    `json:"plan_name"`
+	StepIndex  int       `json:"step_index"`
+	TargetTemp float64   `json:"target_temp"`
+}
+
+// Kilder for gravity-målinger.
+const (
+	GravitySourceTag = "tag" // tankens gravity_tag
+	GravitySourceAPI = "api" // POST /api/fermentation/{tank}/gravity
+)
+
+// GravityReading er én hydrometermåling for en batch.
+type GravityReading struct {
+	TankNo  int       `db:"tank_no" json:"tank_no"`
+	BatchID string    `db:"batch_id" json:"batch_id"`
+	Time    time.Time `db:"ts" json:"time"`
+	Gravity float64   `db:"gravity" json:"gravity"`
+	Source  string    `db:"source" json:"source"`
 }
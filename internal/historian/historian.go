@@ -0,0 +1,270 @@
+package historian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+)
+
+// ErrUnknownTag is returned when history is requested for a tag that is not
+// in the tag map.
+var ErrUnknownTag = errors.New("unknown tag")
+
+// maxBuffered caps samples kept in memory while the database is failing.
+const maxBuffered = 10000
+
+// Sample is one stored tag value.
+type Sample struct {
+	Tag   string
+	Time  time.Time
+	Value float64
+}
+
+// Bucket aggregates the samples in one step of a history query.
+type Bucket struct {
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Count int       `json:"count"`
+}
+
+// Store persists samples and fermentation events and answers bucketed range
+// queries.
+type Store interface {
+	Insert(samples []Sample) error
+	InsertEvents(events []fermentation.Event) error
+	Query(tag string, from, to time.Time, step time.Duration) ([]Bucket, error)
+	Prune(before time.Time) (int64, error)
+	Close() error
+}
+
+// Open opens the store selected by cfg.Backend.
+func Open(cfg config.HistorianConfig) (Store, error) {
+	switch cfg.Backend {
+	case "timescale":
+		return NewTimescaleStore(cfg.Timescale.DSN)
+	default:
+		return NewSQLiteStore(cfg.DatabasePath)
+	}
+}
+
+// series tracks what has been stored for one tag.
+type series struct {
+	tag     *opcua.Tag
+	last    Sample // last stored sample
+	stored  bool
+	current Sample // latest received value
+	dirty   bool   // current is newer than last and not yet decided on
+}
+
+// Historian filters tag updates through per-tag deadband and downsampling
+// and writes the survivors to a Store in batches.
+type Historian struct {
+	log   zerolog.Logger
+	store Store
+	tags  *opcua.TagMap
+
+	flushInterval time.Duration
+	heartbeat     time.Duration
+	retention     time.Duration
+
+	mu     sync.Mutex
+	series map[string]*series
+	buf    []Sample
+	events []fermentation.Event
+}
+
+// New creates a historian writing to store.
+func New(log zerolog.Logger, store Store, tags *opcua.TagMap, cfg config.HistorianConfig) (*Historian, error) {
+	flush, err := time.ParseDuration(cfg.FlushInterval)
+	if err != nil || flush <= 0 {
+		return nil, fmt.Errorf("invalid flush_interval %q", cfg.FlushInterval)
+	}
+	heartbeat, err := time.ParseDuration(cfg.Heartbeat)
+	if err != nil || heartbeat <= 0 {
+		return nil, fmt.Errorf("invalid heartbeat %q", cfg.Heartbeat)
+	}
+	var retention time.Duration
+	if cfg.Retention != "" {
+		retention, err = time.ParseDuration(cfg.Retention)
+		if err != nil || retention <= 0 {
+			return nil, fmt.Errorf("invalid retention %q", cfg.Retention)
+		}
+	}
+
+	return &Historian{
+		log:           log,
+		store:         store,
+		tags:          tags,
+		flushInterval: flush,
+		heartbeat:     heartbeat,
+		retention:     retention,
+		series:        make(map[string]*series),
+	}, nil
+}
+
+// Record takes a tag update from the dispatcher. It never blocks on I/O.
+func (h *Historian) Record(u opcua.TagUpdate) {
+	h.record(u, time.Now())
+}
+
+func (h *Historian) record(u opcua.TagUpdate, now time.Time) {
+	tag, ok := h.tags.Lookup(u.Name)
+	if !ok {
+		return
+	}
+	v, ok := brew.Numeric(u.Value)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[tag.Name]
+	if !ok {
+		s = &series{tag: tag}
+		h.series[tag.Name] = s
+	}
+	s.current = Sample{Tag: tag.Name, Time: now, Value: v}
+	s.dirty = true
+	h.evaluate(s, now)
+}
+
+// RecordEvent buffers a fermentation event for the next flush.
+func (h *Historian) RecordEvent(ev fermentation.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.events) < maxBuffered {
+		h.events = append(h.events, ev)
+	}
+}
+
+// evaluate decides whether the series' current value should be stored.
+func (h *Historian) evaluate(s *series, now time.Time) {
+	if !s.stored {
+		if s.dirty {
+			h.keep(s, s.current)
+		}
+		return
+	}
+
+	elapsed := now.Sub(s.last.Time)
+	if elapsed < s.tag.HistoryInterval {
+		return // downsampling: keep the newest value until the interval has passed
+	}
+
+	switch {
+	case elapsed >= h.heartbeat:
+		// Lagre på nytt selv uten endring, så hull i grafen betyr at data mangler
+		smp := s.current
+		smp.Time = now
+		h.keep(s, smp)
+	case s.dirty && math.Abs(s.current.Value-s.last.Value) > s.tag.Deadband:
+		h.keep(s, s.current)
+	default:
+		s.dirty = false
+	}
+}
+
+func (h *Historian) keep(s *series, smp Sample) {
+	s.last = smp
+	s.stored = true
+	s.dirty = false
+	if len(h.buf) < maxBuffered {
+		h.buf = append(h.buf, smp)
+	}
+}
+
+// Run flushes buffered samples until ctx is cancelled, then flushes once more.
+func (h *Historian) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.flushInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			h.flush()
+			return
+		case now := <-ticker.C:
+			h.check(now)
+			h.flush()
+
+			if h.retention > 0 && now.Sub(lastPrune) >= time.Hour {
+				lastPrune = now
+				h.prune(now.Add(-h.retention))
+			}
+		}
+	}
+}
+
+// check re-evaluates every series, so downsampled values and heartbeats are
+// stored even when no new update arrives.
+func (h *Historian) check(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.series {
+		h.evaluate(s, now)
+	}
+}
+
+func (h *Historian) flush() {
+	h.mu.Lock()
+	batch, events := h.buf, h.events
+	h.buf, h.events = nil, nil
+	h.mu.Unlock()
+
+	if len(batch) > 0 {
+		if err := h.store.Insert(batch); err != nil {
+			h.log.Error().Err(err).Int("samples", len(batch)).Msg("❌ Failed to write history, retrying next flush")
+			h.mu.Lock()
+			if len(batch)+len(h.buf) <= maxBuffered {
+				h.buf = append(batch, h.buf...)
+			}
+			h.mu.Unlock()
+		}
+	}
+
+	if len(events) > 0 {
+		if err := h.store.InsertEvents(events); err != nil {
+			h.log.Error().Err(err).Int("events", len(events)).Msg("❌ Failed to write fermentation events, retrying next flush")
+			h.mu.Lock()
+			if len(events)+len(h.events) <= maxBuffered {
+				h.events = append(events, h.events...)
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+func (h *Historian) prune(before time.Time) {
+	n, err := h.store.Prune(before)
+	if err != nil {
+		h.log.Error().Err(err).Msg("❌ Failed to prune history")
+		return
+	}
+	if n > 0 {
+		h.log.Info().Int64("removed", n).Time("before", before).Msg("🧹 Pruned old history")
+	}
+}
+
+// Query returns min/max/avg buckets for a tag (name, node ID or symbol).
+func (h *Historian) Query(tag string, from, to time.Time, step time.Duration) (string, []Bucket, error) {
+	t, ok := h.tags.Lookup(tag)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %q", ErrUnknownTag, tag)
+	}
+	buckets, err := h.store.Query(t.Name, from, to, step)
+	return t.Name, buckets, err
+}
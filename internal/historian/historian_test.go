@@ -0,0 +1,275 @@
+package historian
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/rs/zerolog"
+)
+
+const tempNode = "ns=4;s=MAIN.fbUA.glycolTemp"
+
+// fakeStore husker det som skrives. Med fail satt feiler all skriving.
+type fakeStore struct {
+	mu      sync.Mutex
+	samples []Sample
+	events  []fermentation.Event
+	inserts int
+	fail    error
+}
+
+func (s *fakeStore) Insert(samples []Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inserts++
+	if s.fail != nil {
+		return s.fail
+	}
+	s.samples = append(s.samples, samples...)
+	return nil
+}
+
+func (s *fakeStore) InsertEvents(events []fermentation.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *fakeStore) Query(string, time.Time, time.Time, time.Duration) ([]Bucket, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Prune(time.Time) (int64, error) { return 0, nil }
+func (s *fakeStore) Close() error                   { return nil }
+
+func (s *fakeStore) setFail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = err
+}
+
+func newTestHistorian(t *testing.T, deadband float64, historyInterval string) (*Historian, *fakeStore) {
+	t.Helper()
+	tags, err := opcua.NewTagMap([]config.TagConfig{{
+		Name: "glycolTemp", NodeID: tempNode, DataType: "real", SamplingInterval: "1s",
+		Deadband: deadband, HistoryInterval: historyInterval,
+	}}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeStore{}
+	h, err := New(zerolog.Nop(), store, tags, config.HistorianConfig{FlushInterval: "1s", Heartbeat: "10m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, store
+}
+
+// buffered returnerer verdiene som venter på å bli skrevet.
+func (h *Historian) buffered() []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Sample(nil), h.buf...)
+}
+
+var t0 = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestEvaluate(t *testing.T) {
+	type action struct {
+		at    time.Duration
+		value *float64 // nil = bare en runde i Run
+	}
+	rec := func(at time.Duration, v float64) action { return action{at, &v} }
+	tick := func(at time.Duration) action { return action{at: at} }
+	type stored struct {
+		at    time.Duration
+		value float64
+	}
+
+	tests := []struct {
+		name            string
+		deadband        float64
+		historyInterval string
+		actions         []action
+		want            []stored
+	}{
+		{
+			name:     "deadband",
+			deadband: 0.5,
+			actions: []action{
+				rec(0, 20), rec(time.Second, 20.3), rec(2*time.Second, 20.6),
+				rec(3*time.Second, 20.2), rec(4*time.Second, 20), tick(5 * time.Second),
+			},
+			want: []stored{{0, 20}, {2 * time.Second, 20.6}, {4 * time.Second, 20}},
+		},
+		{
+			name: "every change without deadband",
+			actions: []action{
+				rec(0, 20), rec(time.Second, 20), rec(2*time.Second, 20.01),
+			},
+			want: []stored{{0, 20}, {2 * time.Second, 20.01}},
+		},
+		{
+			name:            "history interval keeps the newest value",
+			historyInterval: "1m",
+			actions: []action{
+				rec(0, 20), rec(10*time.Second, 25), rec(20*time.Second, 26),
+				tick(59 * time.Second), tick(time.Minute),
+				rec(70*time.Second, 27), tick(2 * time.Minute),
+			},
+			want: []stored{{0, 20}, {20 * time.Second, 26}, {70 * time.Second, 27}},
+		},
+		{
+			name:            "history interval drops values back within deadband",
+			deadband:        0.5,
+			historyInterval: "1m",
+			actions: []action{
+				rec(0, 20), rec(10*time.Second, 25), rec(20*time.Second, 20.1), tick(time.Minute),
+			},
+			want: []stored{{0, 20}},
+		},
+		{
+			name:     "heartbeat stores unchanged values",
+			deadband: 0.5,
+			actions: []action{
+				rec(0, 20), rec(time.Minute, 20.1),
+				tick(9 * time.Minute), tick(10 * time.Minute),
+				tick(15 * time.Minute), tick(20 * time.Minute),
+			},
+			want: []stored{{0, 20}, {10 * time.Minute, 20.1}, {20 * time.Minute, 20.1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHistorian(t, tt.deadband, tt.historyInterval)
+			for _, a := range tt.actions {
+				if a.value != nil {
+					h.record(opcua.TagUpdate{Name: tempNode, Value: *a.value}, t0.Add(a.at))
+				} else {
+					h.check(t0.Add(a.at))
+				}
+			}
+
+			got := h.buffered()
+			if len(got) != len(tt.want) {
+				t.Fatalf("stored %+v, want %+v", got, tt.want)
+			}
+			for i, w := range tt.want {
+				if got[i].Tag != "glycolTemp" || !got[i].Time.Equal(t0.Add(w.at)) || got[i].Value != w.value {
+					t.Errorf("sample %d = %+v, want %g at +%s", i, got[i], w.value, w.at)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordIgnoresUnknownAndNonNumeric(t *testing.T) {
+	h, _ := newTestHistorian(t, 0, "")
+	h.record(opcua.TagUpdate{Name: "ns=4;s=unknown", Value: 1.0}, t0)
+	h.record(opcua.TagUpdate{Name: tempNode, Value: "warm"}, t0)
+	if got := h.buffered(); len(got) != 0 {
+		t.Errorf("stored %+v, want nothing", got)
+	}
+	// Bool lagres som 0/1, og taggen kan slås opp på navn
+	h.record(opcua.TagUpdate{Name: "glycolTemp", Value: true}, t0)
+	if got := h.buffered(); len(got) != 1 || got[0].Value != 1 {
+		t.Errorf("stored %+v, want one sample of 1", got)
+	}
+}
+
+func TestQueryUnknownTag(t *testing.T) {
+	h, _ := newTestHistorian(t, 0, "")
+	if _, _, err := h.Query("missing", t0, t0.Add(time.Hour), time.Minute); !errors.Is(err, ErrUnknownTag) {
+		t.Errorf("Query of unknown tag = %v, want ErrUnknownTag", err)
+	}
+	name, _, err := h.Query(tempNode, t0, t0.Add(time.Hour), time.Minute)
+	if err != nil || name != "glycolTemp" {
+		t.Errorf("Query by node ID = %q, %v; want glycolTemp", name, err)
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	h, store := newTestHistorian(t, 0, "")
+	for i := range 5 {
+		h.record(opcua.TagUpdate{Name: tempNode, Value: float64(i)}, t0.Add(time.Duration(i)*time.Second))
+	}
+	h.RecordEvent(fermentation.Event{Type: fermentation.EventStarted, TankNo: 1})
+
+	h.flush()
+	if store.inserts != 1 || len(store.samples) != 5 || len(store.events) != 1 {
+		t.Fatalf("after flush: %d inserts, %d samples, %d events; want one batch of 5 and 1 event",
+			store.inserts, len(store.samples), len(store.events))
+	}
+	if len(h.buffered()) != 0 {
+		t.Error("buffer not emptied after flush")
+	}
+
+	// Ingenting å skrive: ingen tom batch
+	h.flush()
+	if store.inserts != 1 {
+		t.Errorf("empty flush wrote a batch (%d inserts)", store.inserts)
+	}
+}
+
+func TestFlushRetriesFailedBatch(t *testing.T) {
+	h, store := newTestHistorian(t, 0, "")
+	h.record(opcua.TagUpdate{Name: tempNode, Value: 1.0}, t0)
+	h.record(opcua.TagUpdate{Name: tempNode, Value: 2.0}, t0.Add(time.Second))
+	h.RecordEvent(fermentation.Event{Type: fermentation.EventStarted, TankNo: 1})
+
+	store.setFail(errors.New("database is locked"))
+	h.flush()
+	if len(store.samples) != 0 || len(h.buffered()) != 2 {
+		t.Fatalf("after failed flush: stored %d, buffered %d; want the batch kept", len(store.samples), len(h.buffered()))
+	}
+
+	// Nye verdier kommer etter de som feilet
+	h.record(opcua.TagUpdate{Name: tempNode, Value: 3.0}, t0.Add(2*time.Second))
+	h.RecordEvent(fermentation.Event{Type: fermentation.EventStep, TankNo: 1})
+	store.setFail(nil)
+	h.flush()
+
+	if len(store.samples) != 3 {
+		t.Fatalf("stored %+v, want all three samples", store.samples)
+	}
+	for i, want := range []float64{1, 2, 3} {
+		if store.samples[i].Value != want {
+			t.Errorf("sample %d = %g, want %g (oldest first)", i, store.samples[i].Value, want)
+		}
+	}
+	if len(store.events) != 2 || store.events[0].Type != fermentation.EventStarted {
+		t.Errorf("events = %+v, want started then step", store.events)
+	}
+	if len(h.buffered()) != 0 {
+		t.Error("buffer not emptied after successful retry")
+	}
+}
+
+func TestBufferIsCapped(t *testing.T) {
+	h, store := newTestHistorian(t, 0, "")
+	for i := range maxBuffered {
+		h.record(opcua.TagUpdate{Name: tempNode, Value: float64(i)}, t0.Add(time.Duration(i)*time.Second))
+	}
+	h.record(opcua.TagUpdate{Name: tempNode, Value: -1.0}, t0.Add(maxBuffered*time.Second))
+	if n := len(h.buffered()); n != maxBuffered {
+		t.Fatalf("buffered %d samples, want the cap of %d", n, maxBuffered)
+	}
+
+	// Bufferet holder seg innenfor grensen også når skrivingen feiler
+	store.setFail(errors.New("disk full"))
+	h.flush()
+	h.record(opcua.TagUpdate{Name: tempNode, Value: -2.0}, t0.Add((maxBuffered+1)*time.Second))
+	h.flush()
+	if n := len(h.buffered()); n != maxBuffered {
+		t.Errorf("buffered %d samples after failed flushes, want %d", n, maxBuffered)
+	}
+}
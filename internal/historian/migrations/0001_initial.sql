@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS tag_history (
+    tag TEXT NOT NULL,
+    ts INTEGER NOT NULL,
+    value REAL NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_history_tag_ts ON tag_history(tag, ts);
+
+CREATE TABLE IF NOT EXISTS fermentation_events (
+    ts INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    tank_no INTEGER NOT NULL,
+    batch_id TEXT,
+    plan_name TEXT,
+    step_index INTEGER,
+    target_temp REAL
+);
+
+CREATE INDEX IF NOT EXISTS idx_fermentation_events_ts ON fermentation_events(ts);
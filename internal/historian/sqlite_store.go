@@ -0,0 +1,144 @@
+package historian
+
+import (
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/migrate"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore keeps history in a local SQLite file. Timestamps are stored as
+// unix milliseconds so buckets can be computed with integer division.
+type SQLiteStore struct {
+	DB *sqlx.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	s := &SQLiteStore{DB: db}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close releases the database connection.
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations er skjemaendringene for historian.db, i rekkefølge.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations")
+
+func (s *SQLiteStore) migrate() error {
+	_, err := migrate.Up(s.DB, Migrations)
+	return err
+}
+
+// Insert writes a batch of samples in one transaction.
+func (s *SQLiteStore) Insert(samples []Sample) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Preparex(`INSERT INTO tag_history (tag, ts, value) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, smp := range samples {
+		if _, err := stmt.Exec(smp.Tag, smp.Time.UnixMilli(), smp.Value); err != nil {
+			return fmt.Errorf("insert sample: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertEvents writes a batch of fermentation events in one transaction.
+func (s *SQLiteStore) InsertEvents(events []fermentation.Event) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, ev := range events {
+		_, err := tx.Exec(`
+INSERT INTO fermentation_events (ts, type, tank_no, batch_id, plan_name, step_index, target_temp)
+VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			ev.Time.UnixMilli(), ev.Type, ev.TankNo, ev.BatchID, ev.PlanName, ev.StepIndex, ev.TargetTemp)
+		if err != nil {
+			return fmt.Errorf("insert event: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Query aggregates [from, to) into buckets of length step.
+func (s *SQLiteStore) Query(tag string, from, to time.Time, step time.Duration) ([]Bucket, error) {
+	stepMs := step.Milliseconds()
+	if stepMs <= 0 {
+		return nil, fmt.Errorf("step must be at least 1ms")
+	}
+
+	var rows []struct {
+		Bucket int64   `db:"bucket"`
+		Min    float64 `db:"min"`
+		Max    float64 `db:"max"`
+		Avg    float64 `db:"avg"`
+		Count  int     `db:"count"`
+	}
+	err := s.DB.Select(&rows, `
+SELECT (ts / ?) * ? AS bucket,
+       MIN(value) AS min,
+       MAX(value) AS max,
+       AVG(value) AS avg,
+       COUNT(*) AS count
+FROM tag_history
+WHERE tag = ? AND ts >= ? AND ts < ?
+GROUP BY bucket
+ORDER BY bucket`,
+		stepMs, stepMs, tag, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("query history: %w", err)
+	}
+
+	out := make([]Bucket, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, Bucket{
+			Time:  time.UnixMilli(r.Bucket).UTC(),
+			Min:   r.Min,
+			Max:   r.Max,
+			Avg:   r.Avg,
+			Count: r.Count,
+		})
+	}
+	return out, nil
+}
+
+// Prune deletes samples older than before.
+func (s *SQLiteStore) Prune(before time.Time) (int64, error) {
+	res, err := s.DB.Exec(`DELETE FROM tag_history WHERE ts < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("prune history: %w", err)
+	}
+	if _, err := s.DB.Exec(`DELETE FROM fermentation_events WHERE ts < ?`, before.UnixMilli()); err != nil {
+		return 0, fmt.Errorf("prune events: %w", err)
+	}
+	return res.RowsAffected()
+}
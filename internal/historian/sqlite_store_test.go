@@ -0,0 +1,55 @@
+package historian
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteQueryBuckets(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "historian.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	at := func(d time.Duration, v float64) Sample { return Sample{Tag: "glycolTemp", Time: t0.Add(d), Value: v} }
+	if err := s.Insert([]Sample{
+		at(-time.Second, 100), // før from
+		at(0, 2),
+		at(10*time.Second, 4),
+		at(50*time.Second, 6),
+		at(65*time.Second, 10),
+		at(2*time.Minute, 100), // to er eksklusiv
+		{Tag: "other", Time: t0, Value: 100},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	buckets, err := s.Query("glycolTemp", t0, t0.Add(2*time.Minute), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bucket{
+		{Time: t0, Min: 2, Max: 6, Avg: 4, Count: 3},
+		{Time: t0.Add(time.Minute), Min: 10, Max: 10, Avg: 10, Count: 1},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("buckets = %+v, want %+v", buckets, want)
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, buckets[i], want[i])
+		}
+	}
+
+	// Én bøtte for hele vinduet
+	buckets, err = s.Query("glycolTemp", t0, t0.Add(2*time.Minute), time.Hour)
+	if err != nil || len(buckets) != 1 || buckets[0].Count != 4 || buckets[0].Max != 10 {
+		t.Errorf("hour bucket = %+v, %v; want all four samples", buckets, err)
+	}
+
+	if _, err := s.Query("glycolTemp", t0, t0.Add(time.Minute), 0); err == nil {
+		t.Error("zero step should fail")
+	}
+}
@@ -0,0 +1,242 @@
+package historian
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// TimescaleStore writes history to a TimescaleDB hypertable. Continuous
+// aggregates with 1-minute and 1-hour rollups serve long ranges and Grafana.
+type TimescaleStore struct {
+	DB *sqlx.DB
+}
+
+func NewTimescaleStore(dsn string) (*TimescaleStore, error) {
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("connect postgres: %w", err)
+	}
+
+	s := &TimescaleStore{DB: db}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close releases the database connection.
+func (s *TimescaleStore) Close() error {
+	return s.DB.Close()
+}
+
+// rollups are the continuous aggregates, smallest first.
+var rollups = []struct {
+	view     string
+	interval time.Duration
+	start    string // refresh window start offset
+	end      string // refresh window end offset
+	schedule string
+}{
+	{"tag_history_1m", time.Minute, "2 hours", "1 minute", "1 minute"},
+	{"tag_history_1h", time.Hour, "3 days", "1 hour", "30 minutes"},
+}
+
+// migrate runs one statement at a time: continuous aggregates cannot be
+// created inside the implicit transaction of a multi-statement Exec.
+func (s *TimescaleStore) migrate() error {
+	stmts := []string{
+		`CREATE EXTENSION IF NOT EXISTS timescaledb`,
+		`CREATE TABLE IF NOT EXISTS tag_history (
+    time TIMESTAMPTZ NOT NULL,
+    tag TEXT NOT NULL,
+    value DOUBLE PRECISION NOT NULL
+)`,
+		`SELECT create_hypertable('tag_history', 'time', if_not_exists => TRUE)`,
+		`CREATE INDEX IF NOT EXISTS tag_history_tag_time_idx ON tag_history (tag, time DESC)`,
+		`CREATE TABLE IF NOT EXISTS fermentation_events (
+    time TIMESTAMPTZ NOT NULL,
+    type TEXT NOT NULL,
+    tank_no INTEGER NOT NULL,
+    batch_id TEXT,
+    plan_name TEXT,
+    step_index INTEGER,
+    target_temp DOUBLE PRECISION
+)`,
+		`SELECT create_hypertable('fermentation_events', 'time', if_not_exists => TRUE)`,
+	}
+	for _, r := range rollups {
+		stmts = append(stmts,
+			fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '%d seconds', time) AS bucket,
+       tag,
+       MIN(value) AS min,
+       MAX(value) AS max,
+       AVG(value) AS avg,
+       COUNT(*) AS count
+FROM tag_history
+GROUP BY bucket, tag
+WITH NO DATA`, r.view, int(r.interval.Seconds())),
+			fmt.Sprintf(`SELECT add_continuous_aggregate_policy('%s',
+    start_offset => INTERVAL '%s',
+    end_offset => INTERVAL '%s',
+    schedule_interval => INTERVAL '%s',
+    if_not_exists => TRUE)`, r.view, r.start, r.end, r.schedule),
+		)
+	}
+
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return fmt.Errorf("migrate timescale: %w", err)
+		}
+	}
+	return nil
+}
+
+// Insert copies a batch of samples into the hypertable.
+func (s *TimescaleStore) Insert(samples []Sample) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(pq.CopyIn("tag_history", "time", "tag", "value"))
+	if err != nil {
+		return fmt.Errorf("prepare copy: %w", err)
+	}
+	for _, smp := range samples {
+		if _, err := stmt.Exec(smp.Time, smp.Tag, smp.Value); err != nil {
+			_ = stmt.Close()
+			return fmt.Errorf("copy sample: %w", err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		_ = stmt.Close()
+		return fmt.Errorf("flush copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("close copy: %w", err)
+	}
+	return tx.Commit()
+}
+
+// InsertEvents copies a batch of fermentation events.
+func (s *TimescaleStore) InsertEvents(events []fermentation.Event) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(pq.CopyIn("fermentation_events",
+		"time", "type", "tank_no", "batch_id", "plan_name", "step_index", "target_temp"))
+	if err != nil {
+		return fmt.Errorf("prepare copy: %w", err)
+	}
+	for _, ev := range events {
+		if _, err := stmt.Exec(ev.Time, ev.Type, ev.TankNo, ev.BatchID, ev.PlanName, ev.StepIndex, ev.TargetTemp); err != nil {
+			_ = stmt.Close()
+			return fmt.Errorf("copy event: %w", err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		_ = stmt.Close()
+		return fmt.Errorf("flush copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("close copy: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Query aggregates [from, to) into buckets of length step. Steps that are
+// whole minutes or hours are answered from the matching rollup.
+func (s *TimescaleStore) Query(tag string, from, to time.Time, step time.Duration) ([]Bucket, error) {
+	if step < time.Second {
+		return nil, fmt.Errorf("step must be at least 1s")
+	}
+
+	query := `
+SELECT time_bucket($1::interval, time) AS bucket,
+       MIN(value) AS min,
+       MAX(value) AS max,
+       AVG(value) AS avg,
+       COUNT(*) AS count
+FROM tag_history
+WHERE tag = $2 AND time >= $3 AND time < $4
+GROUP BY 1
+ORDER BY 1`
+	if view := rollupView(step); view != "" {
+		query = fmt.Sprintf(`
+SELECT time_bucket($1::interval, bucket) AS bucket,
+       MIN(min) AS min,
+       MAX(max) AS max,
+       SUM(avg * count) / SUM(count) AS avg,
+       SUM(count) AS count
+FROM %s
+WHERE tag = $2 AND bucket >= $3 AND bucket < $4
+GROUP BY 1
+ORDER BY 1`, view)
+	}
+
+	var rows []struct {
+		Bucket time.Time `db:"bucket"`
+		Min    float64   `db:"min"`
+		Max    float64   `db:"max"`
+		Avg    float64   `db:"avg"`
+		Count  int       `db:"count"`
+	}
+	interval := fmt.Sprintf("%d seconds", int64(step.Seconds()))
+	if err := s.DB.Select(&rows, query, interval, tag, from, to); err != nil {
+		return nil, fmt.Errorf("query history: %w", err)
+	}
+
+	out := make([]Bucket, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, Bucket{
+			Time:  r.Bucket.UTC(),
+			Min:   r.Min,
+			Max:   r.Max,
+			Avg:   r.Avg,
+			Count: r.Count,
+		})
+	}
+	return out, nil
+}
+
+// rollupView returns the largest rollup that divides step evenly, or "" when
+// the query has to read the raw hypertable.
+func rollupView(step time.Duration) string {
+	for i := len(rollups) - 1; i >= 0; i-- {
+		r := rollups[i]
+		if step >= r.interval && step%r.interval == 0 {
+			return r.view
+		}
+	}
+	return ""
+}
+
+// Prune drops hypertable chunks older than before and returns how many
+// chunks were removed.
+func (s *TimescaleStore) Prune(before time.Time) (int64, error) {
+	var n int64
+	for _, table := range []string{"tag_history", "fermentation_events"} {
+		var chunks []string
+		if err := s.DB.Select(&chunks, `SELECT drop_chunks($1::regclass, older_than => $2::timestamptz)`, table, before); err != nil {
+			return n, fmt.Errorf("drop chunks %s: %w", table, err)
+		}
+		n += int64(len(chunks))
+	}
+	return n, nil
+}
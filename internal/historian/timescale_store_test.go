@@ -0,0 +1,28 @@
+package historian
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupView(t *testing.T) {
+	tests := []struct {
+		step time.Duration
+		want string
+	}{
+		{time.Second, ""},
+		{30 * time.Second, ""},
+		{90 * time.Second, ""}, // ikke et helt antall minutter
+		{time.Minute, "tag_history_1m"},
+		{5 * time.Minute, "tag_history_1m"},
+		{90 * time.Minute, "tag_history_1m"},
+		{time.Hour, "tag_history_1h"},
+		{24 * time.Hour, "tag_history_1h"},
+		{time.Hour + time.Second, ""},
+	}
+	for _, tt := range tests {
+		if got := rollupView(tt.step); got != tt.want {
+			t.Errorf("rollupView(%s) = %q, want %q", tt.step, got, tt.want)
+		}
+	}
+}
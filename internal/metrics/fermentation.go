@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Run is one active fermentation as reported at scrape time.
+type Run struct {
+	TankNo     int
+	BatchID    string
+	StepIndex  int
+	TargetTemp float64
+	ActualTemp *float64
+	Paused     bool
+}
+
+var (
+	stepIndexDesc = prometheus.NewDesc(namespace+"_fermentation_step_index",
+		"Current 0-based step index of the active fermentation.", []string{"tank", "batch_id"}, nil)
+	targetDesc = prometheus.NewDesc(namespace+"_fermentation_target_celsius",
+		"Target temperature of the current step.", []string{"tank", "batch_id"}, nil)
+	actualDesc = prometheus.NewDesc(namespace+"_fermentation_actual_celsius",
+		"Last temperature the engine regulated on.", []string{"tank", "batch_id"}, nil)
+	pausedDesc = prometheus.NewDesc(namespace+"_fermentation_paused",
+		"1 when the fermentation is paused.", []string{"tank", "batch_id"}, nil)
+)
+
+// fermentationCollector reads the engine on every scrape, so finished
+// fermentations disappear without explicit cleanup.
+type fermentationCollector struct {
+	active func() []Run
+}
+
+// RegisterFermentation exposes active fermentations from the engine.
+func RegisterFermentation(active func() []Run) {
+	Registry.MustRegister(fermentationCollector{active: active})
+}
+
+func (c fermentationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- stepIndexDesc
+	ch <- targetDesc
+	ch <- actualDesc
+	ch <- pausedDesc
+}
+
+func (c fermentationCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, r := range c.active() {
+		labels := []string{strconv.Itoa(r.TankNo), r.BatchID}
+		ch <- prometheus.MustNewConstMetric(stepIndexDesc, prometheus.GaugeValue, float64(r.StepIndex), labels...)
+		ch <- prometheus.MustNewConstMetric(targetDesc, prometheus.GaugeValue, r.TargetTemp, labels...)
+		ch <- prometheus.MustNewConstMetric(pausedDesc, prometheus.GaugeValue, Bool(r.Paused), labels...)
+		if r.ActualTemp != nil {
+			ch <- prometheus.MustNewConstMetric(actualDesc, prometheus.GaugeValue, *r.ActualTemp, labels...)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Package metrics holds the Prometheus collectors exposed on /metrics.
+// It only depends on the Prometheus client so every other package can
+// import it.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gotov"
+
+// Registry is the registry served on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	TagValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tag_value",
+		Help:      "Latest value of each subscribed tag (booleans as 0/1).",
+	}, []string{"tag", "unit", "role"})
+
+	TankTemperature = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tank_temperature_celsius",
+		Help:      "Actual tank temperature.",
+	}, []string{"tank", "name"})
+
+	TankSetpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tank_setpoint_celsius",
+		Help:      "Fermentation target temperature; absent when no fermentation is active.",
+	}, []string{"tank", "name"})
+
+	TankOutput = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tank_output_on",
+		Help:      "Whether a tank output (cooling/heating) is on.",
+	}, []string{"tank", "name", "output"})
+
+	OPCUAConnectionState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "opcua_connection_state",
+		Help:      "1 for the current OPC UA connection state, 0 for the others.",
+	}, []string{"state"})
+
+	OPCUANotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "opcua_notifications_total",
+		Help:      "Data change notifications received per tag.",
+	}, []string{"tag"})
+
+	OPCUADroppedUpdates = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "opcua_dropped_updates_total",
+		Help:      "Tag updates dropped because the update channel was full.",
+	})
+
+	WSClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ws_clients",
+		Help:      "Connected WebSocket clients.",
+	})
+
+	BrewfatherLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "brewfather_request_duration_seconds",
+		Help:      "Brewfather API request latency.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"endpoint", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		TagValue,
+		TankTemperature,
+		TankSetpoint,
+		TankOutput,
+		OPCUAConnectionState,
+		OPCUANotifications,
+		OPCUADroppedUpdates,
+		WSClients,
+		BrewfatherLatency,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// SetConnectionState marks state as the current one among states.
+func SetConnectionState(state string, states ...string) {
+	for _, s := range states {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		OPCUAConnectionState.WithLabelValues(s).Set(v)
+	}
+}
+
+// Bool converts a boolean to a gauge value.
+func Bool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// InstrumentBrewfather wraps a transport so every request is observed in
+// BrewfatherLatency. A nil next means http.DefaultTransport.
+func InstrumentBrewfather(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		BrewfatherLatency.WithLabelValues(endpoint(req.URL.Path), code).Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// endpoint keeps the resource name of a Brewfather path so IDs don't create
+// new label values ("/v2/batches/abc" → "batches").
+func endpoint(path string) string {
+	path = strings.TrimPrefix(path, "/v2")
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" {
+		return "other"
+	}
+	return path
+}
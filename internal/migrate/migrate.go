@@ -0,0 +1,230 @@
+// Package migrate applies versioned schema migrations to the SQLite
+// databases. Each database has an ordered list of up-migrations embedded in
+// the binary; applied versions are recorded in the schema_version table.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNewerSchema is returned when a database has been migrated by a newer
+// goTØV than this one. Nothing is changed; upgrade goTØV instead.
+var ErrNewerSchema = errors.New("database schema is newer than this version of goTØV")
+
+// Migration is one schema change. Either SQL or Func is set.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string               // fra migrations/NNNN_navn.sql
+	Func    func(*sqlx.Tx) error // for endringer som må sjekke eksisterende skjema
+}
+
+// State is a migration and when it was applied (nil if pending).
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+const createVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+);`
+
+// MustLoad reads NNNN_name.sql files from dir in fsys and merges them with
+// funcs. It panics on bad file names or duplicate versions, since the files
+// are embedded at build time.
+func MustLoad(fsys fs.FS, dir string, funcs ...Migration) []Migration {
+	ms, err := Load(fsys, dir, funcs...)
+	if err != nil {
+		panic(err)
+	}
+	return ms
+}
+
+// Load reads NNNN_name.sql files from dir in fsys and merges them with funcs,
+// sorted by version. Versions must start at 1 and have no gaps.
+func Load(fsys fs.FS, dir string, funcs ...Migration) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	ms := append([]Migration(nil), funcs...)
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %q: name must be NNNN_name.sql", e.Name())
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %q: %w", e.Name(), err)
+		}
+		ms = append(ms, Migration{Version: version, Name: name, SQL: string(b)})
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d (%s): versions must be 1..n without gaps or duplicates", m.Version, m.Name)
+		}
+		if (m.SQL == "") == (m.Func == nil) {
+			return nil, fmt.Errorf("migration %d (%s): needs either SQL or Func", m.Version, m.Name)
+		}
+	}
+	return ms, nil
+}
+
+// Latest returns the highest version in migrations.
+func Latest(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Current returns the highest applied version, or 0 for a database that has
+// never been migrated.
+func Current(db *sqlx.DB) (int, error) {
+	var exists int
+	if err := db.Get(&exists, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`); err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+	var v int
+	if err := db.Get(&v, `SELECT COALESCE(MAX(version), 0) FROM schema_version`); err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	return v, nil
+}
+
+// Up applies all pending migrations in order, each in its own transaction
+// together with its schema_version row. A failed migration is rolled back
+// and stops the run, so the database is always at a known version.
+func Up(db *sqlx.DB, migrations []Migration) ([]Migration, error) {
+	if _, err := db.Exec(createVersionTable); err != nil {
+		return nil, fmt.Errorf("create schema_version: %w", err)
+	}
+	current, err := Current(db)
+	if err != nil {
+		return nil, err
+	}
+	if latest := Latest(migrations); current > latest {
+		return nil, fmt.Errorf("%w: database is at version %d, this binary knows %d", ErrNewerSchema, current, latest)
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		ok, err := apply(db, m)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if ok {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// apply kjører én migrering. Versjonen sjekkes på nytt i transaksjonen i
+// tilfelle en annen prosess (server og CLI) kom først.
+func apply(db *sqlx.DB, m Migration) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var done int
+	if err := tx.Get(&done, `SELECT COUNT(*) FROM schema_version WHERE version = ?`, m.Version); err != nil {
+		return false, err
+	}
+	if done > 0 {
+		return false, nil
+	}
+
+	if m.Func != nil {
+		err = m.Func(tx)
+	} else {
+		_, err = tx.Exec(m.SQL)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Name, time.Now().UTC()); err != nil {
+		return false, fmt.Errorf("record version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit: %w", err)
+	}
+	return true, nil
+}
+
+// Status lists every migration with the time it was applied. It only reads,
+// so it can be used on a database that has not been migrated yet.
+func Status(db *sqlx.DB, migrations []Migration) ([]State, error) {
+	current, err := Current(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time)
+	if current > 0 {
+		var rows []struct {
+			Version   int       `db:"version"`
+			AppliedAt time.Time `db:"applied_at"`
+		}
+		if err := db.Select(&rows, `SELECT version, applied_at FROM schema_version`); err != nil {
+			return nil, fmt.Errorf("schema version: %w", err)
+		}
+		for _, r := range rows {
+			applied[r.Version] = r.AppliedAt
+		}
+	}
+
+	out := make([]State, len(migrations))
+	for i, m := range migrations {
+		out[i].Migration = m
+		if t, ok := applied[m.Version]; ok {
+			out[i].AppliedAt = &t
+		}
+	}
+	return out, nil
+}
+
+// EnsureColumn adds a column to an existing table unless it is already
+// there, e.g. because an older goTØV added it outside the migrations.
+func EnsureColumn(tx *sqlx.Tx, table, column, decl string) error {
+	var n int
+	if err := tx.Get(&n, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column); err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, decl)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package migrate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func testMigrations(t *testing.T) []Migration {
+	t.Helper()
+	fsys := fstest.MapFS{
+		"migrations/0001_items.sql":  {Data: []byte(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL);`)},
+		"migrations/0003_index.sql":  {Data: []byte(`CREATE INDEX idx_items_name ON items(name);`)},
+		"migrations/README.md":       {Data: []byte(`ignored`)},
+		"migrations/0004_extra.sql":  {Data: []byte(`CREATE TABLE extra (id INTEGER PRIMARY KEY);`)},
+		"migrations/0005_seed.sql":   {Data: []byte(`INSERT INTO items (name) VALUES ('first');`)},
+		"migrations/0006_unused.sql": {Data: []byte(`CREATE TABLE unused (id INTEGER);`)},
+	}
+	ms, err := Load(fsys, "migrations", Migration{
+		Version: 2,
+		Name:    "items_note",
+		Func:    func(tx *sqlx.Tx) error { return EnsureColumn(tx, "items", "note", "TEXT NOT NULL DEFAULT ''") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ms
+}
+
+func TestLoad(t *testing.T) {
+	ms := testMigrations(t)
+	if len(ms) != 6 {
+		t.Fatalf("got %d migrations, want 6", len(ms))
+	}
+	for i, m := range ms {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.Version)
+		}
+	}
+	if ms[1].Func == nil || ms[1].Name != "items_note" {
+		t.Errorf("migration 2 = %+v, want the Go migration", ms[1])
+	}
+	if ms[0].Name != "items" {
+		t.Errorf("migration 1 name = %q, want %q", ms[0].Name, "items")
+	}
+}
+
+func TestLoadRejectsGapsAndBadNames(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"gap":       {"m/0001_a.sql": {Data: []byte("SELECT 1;")}, "m/0003_c.sql": {Data: []byte("SELECT 1;")}},
+		"duplicate": {"m/0001_a.sql": {Data: []byte("SELECT 1;")}, "m/0001_b.sql": {Data: []byte("SELECT 1;")}},
+		"bad name":  {"m/first.sql": {Data: []byte("SELECT 1;")}},
+		"zero":      {"m/0000_a.sql": {Data: []byte("SELECT 1;")}},
+	} {
+		if _, err := Load(fsys, "m"); err == nil {
+			t.Errorf("%s: Load succeeded, want error", name)
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	db := openDB(t)
+	ms := testMigrations(t)
+
+	applied, err := Up(db, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(ms) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(ms))
+	}
+	if v, err := Current(db); err != nil || v != Latest(ms) {
+		t.Fatalf("Current = %d, %v; want %d", v, err, Latest(ms))
+	}
+
+	var note string
+	if err := db.Get(&note, `SELECT note FROM items WHERE name = 'first'`); err != nil {
+		t.Fatalf("Go migration did not add items.note: %v", err)
+	}
+
+	// Andre gang er det ingenting å gjøre
+	applied, err = Up(db, ms)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second Up = %d applied, %v; want 0, nil", len(applied), err)
+	}
+	var n int
+	if err := db.Get(&n, `SELECT COUNT(*) FROM items`); err != nil || n != 1 {
+		t.Fatalf("items has %d rows (%v), want 1: seed must not run twice", n, err)
+	}
+
+	states, err := Status(db, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d has no applied_at", s.Version)
+		}
+	}
+}
+
+func TestUpFromPartialVersion(t *testing.T) {
+	db := openDB(t)
+	ms := testMigrations(t)
+
+	if _, err := Up(db, ms[:2]); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := Up(db, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(ms)-2 || applied[0].Version != 3 {
+		t.Fatalf("applied %+v, want versions 3..%d", applied, Latest(ms))
+	}
+
+	states, err := Status(db, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states[0].AppliedAt == nil || states[len(states)-1].AppliedAt == nil {
+		t.Errorf("Status = %+v, want every migration applied", states)
+	}
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	db := openDB(t)
+	ms := []Migration{
+		{Version: 1, Name: "items", SQL: `CREATE TABLE items (id INTEGER PRIMARY KEY);`},
+		{Version: 2, Name: "broken", SQL: `CREATE TABLE half (id INTEGER); INSERT INTO missing VALUES (1);`},
+		{Version: 3, Name: "after", SQL: `CREATE TABLE after (id INTEGER);`},
+	}
+
+	applied, err := Up(db, ms)
+	if err == nil {
+		t.Fatal("Up succeeded, want error from migration 2")
+	}
+	if len(applied) != 1 || applied[0].Version != 1 {
+		t.Fatalf("applied %+v, want only version 1", applied)
+	}
+	if v, _ := Current(db); v != 1 {
+		t.Fatalf("Current = %d, want 1", v)
+	}
+
+	var n int
+	if err := db.Get(&n, `SELECT COUNT(*) FROM sqlite_master WHERE name IN ('half', 'after')`); err != nil || n != 0 {
+		t.Fatalf("found %d tables from failed/later migrations (%v), want 0", n, err)
+	}
+}
+
+func TestUpRefusesNewerSchema(t *testing.T) {
+	db := openDB(t)
+	ms := testMigrations(t)
+	if _, err := Up(db, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Up(db, ms[:3])
+	if !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("Up with older binary = %v, want ErrNewerSchema", err)
+	}
+}
+
+func TestStatusOnNewDatabase(t *testing.T) {
+	db := openDB(t)
+	ms := testMigrations(t)
+
+	states, err := Status(db, ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.AppliedAt != nil {
+			t.Errorf("migration %d reported as applied on a new database", s.Version)
+		}
+	}
+	if v, err := Current(db); err != nil || v != 0 {
+		t.Fatalf("Current = %d, %v; want 0", v, err)
+	}
+}
+
+func TestEnsureColumnIsIdempotent(t *testing.T) {
+	db := openDB(t)
+	if _, err := db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, note TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := EnsureColumn(tx, "items", "note", "TEXT"); err != nil {
+		t.Fatalf("existing column: %v", err)
+	}
+	if err := EnsureColumn(tx, "items", "added", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		t.Fatalf("new column: %v", err)
+	}
+	var n int
+	if err := tx.Get(&n, `SELECT COUNT(*) FROM pragma_table_info('items') WHERE name = 'added'`); err != nil || n != 1 {
+		t.Fatalf("items.added exists %d times (%v), want 1", n, err)
+	}
+}
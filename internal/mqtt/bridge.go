@@ -0,0 +1,240 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// writeTimeout bounds one PLC write triggered by a command message.
+	writeTimeout = 10 * time.Second
+
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+// Writer is the shared tag write path. *opcua.Client implements it.
+type Writer interface {
+	WriteTag(ctx context.Context, key string, value interface{}) (*opcua.WriteResult, error)
+}
+
+// TagMessage is the retained payload on <prefix>/tags/<name>.
+type TagMessage struct {
+	Value     interface{} `json:"value"`
+	Type      string      `json:"type"`
+	Unit      string      `json:"unit,omitempty"`
+	Role      string      `json:"role,omitempty"`
+	NodeID    string      `json:"node_id"`
+	Timestamp int64       `json:"ts_ms"`
+}
+
+// CommandResult is published (not retained) on <prefix>/tags/<name>/set/result.
+type CommandResult struct {
+	Status string      `json:"status"` // "ok" or "error"
+	Value  interface{} `json:"value,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Bridge mirrors tag updates to MQTT and accepts write commands.
+//
+// Topics:
+//
+//	<prefix>/status               "online" / "offline" (retained, LWT)
+//	<prefix>/tags/<name>          TagMessage (retained)
+//	<prefix>/tags/<name>/set      command: raw JSON value or {"value": ...}
+//	<prefix>/tags/<name>/set/result
+type Bridge struct {
+	log      zerolog.Logger
+	client   paho.Client
+	tags     *opcua.TagMap
+	writer   Writer
+	prefix   string
+	qos      byte
+	commands bool
+
+	// topics maps the topic segment of each tag back to its name, since
+	// topicSafe can change the name ("fermenter/1" → "fermenter_1").
+	topics map[string]string
+}
+
+// New creates a bridge. No connection is made until Start.
+func New(log zerolog.Logger, cfg config.MQTTConfig, tags *opcua.TagMap, writer Writer) *Bridge {
+	b := &Bridge{
+		log:      log,
+		tags:     tags,
+		writer:   writer,
+		prefix:   strings.TrimSuffix(cfg.TopicPrefix, "/"),
+		qos:      cfg.QoS,
+		commands: cfg.Commands,
+		topics:   make(map[string]string),
+	}
+	for _, t := range tags.All() {
+		topic := topicSafe(t.Name)
+		if other, dup := b.topics[topic]; dup {
+			log.Warn().Str("tag", t.Name).Str("other", other).Str("topic", topic).
+				Msg("⚠️ Tags share an MQTT topic, commands go to the first")
+			continue
+		}
+		b.topics[topic] = t.Name
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetWill(b.statusTopic(), statusOffline, 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetOrderMatters(false).
+		SetWriteTimeout(2 * time.Second).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn().Err(err).Msg("⚠️ MQTT connection lost, reconnecting")
+		})
+	b.client = paho.NewClient(opts)
+	return b
+}
+
+// Start connects in the background; the broker does not need to be up yet.
+func (b *Bridge) Start() {
+	b.log.Info().Str("prefix", b.prefix).Bool("commands", b.commands).Msg("📡 MQTT bridge starting")
+	b.client.Connect()
+}
+
+// Close publishes offline status and disconnects.
+func (b *Bridge) Close() {
+	if b.client.IsConnected() {
+		b.client.Publish(b.statusTopic(), 1, true, statusOffline).WaitTimeout(time.Second)
+	}
+	b.client.Disconnect(250)
+}
+
+// onConnect runs after every (re)connect: the session is clean, so status
+// and command subscriptions are set up again.
+func (b *Bridge) onConnect(c paho.Client) {
+	b.log.Info().Msg("✅ Connected to MQTT broker")
+	c.Publish(b.statusTopic(), 1, true, statusOnline)
+
+	if !b.commands {
+		return
+	}
+	topic := b.prefix + "/tags/+/set"
+	if tok := c.Subscribe(topic, b.qos, b.handleCommand); tok.WaitTimeout(5*time.Second) && tok.Error() != nil {
+		b.log.Error().Err(tok.Error()).Str("topic", topic).Msg("❌ MQTT subscribe failed")
+	}
+}
+
+// Publish mirrors a tag update as a retained message. Updates are dropped
+// while the broker is unreachable; the retained values are refreshed by the
+// next change.
+func (b *Bridge) Publish(u opcua.TagUpdate) {
+	if !b.client.IsConnectionOpen() {
+		return
+	}
+
+	name := u.DisplayName
+	if t, ok := b.tags.Lookup(u.Name); ok {
+		name = t.Name
+	}
+
+	payload, err := json.Marshal(TagMessage{
+		Value:     u.Value,
+		Type:      u.Type,
+		Unit:      u.Unit,
+		Role:      u.Role,
+		NodeID:    u.Name,
+		Timestamp: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		b.log.Warn().Err(err).Str("tag", name).Msg("⚠️ Could not encode MQTT payload")
+		return
+	}
+	b.client.Publish(b.tagTopic(name), b.qos, true, payload)
+}
+
+// handleCommand writes the payload of <prefix>/tags/<name>/set to the tag.
+func (b *Bridge) handleCommand(c paho.Client, msg paho.Message) {
+	name := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), b.prefix+"/tags/"), "/set")
+	if tagName, ok := b.topics[name]; ok {
+		name = tagName
+	}
+	tag, ok := b.tags.Lookup(name)
+	if !ok {
+		b.reply(c, msg.Topic(), CommandResult{Status: "error", Error: fmt.Sprintf("unknown tag %q", name)})
+		return
+	}
+
+	value, err := decodeValue(msg.Payload())
+	if err != nil {
+		b.reply(c, msg.Topic(), CommandResult{Status: "error", Error: err.Error()})
+		return
+	}
+
+	b.log.Info().
+		Str("tag", tag.Name).
+		Interface("value", value).
+		Msg("📝 MQTT write command received")
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	ctx = audit.WithActor(ctx, audit.Actor{User: "mqtt", Source: audit.SourceMQTT})
+	res, err := b.writer.WriteTag(ctx, tag.Name, value)
+	if err != nil {
+		b.log.Error().Err(err).Str("tag", tag.Name).Msg("❌ MQTT write failed")
+		b.reply(c, msg.Topic(), CommandResult{Status: "error", Value: value, Error: err.Error()})
+		return
+	}
+	b.reply(c, msg.Topic(), CommandResult{Status: "ok", Value: res.Value})
+}
+
+func (b *Bridge) reply(c paho.Client, commandTopic string, res CommandResult) {
+	payload, _ := json.Marshal(res)
+	c.Publish(commandTopic+"/result", b.qos, false, payload)
+}
+
+// decodeValue accepts a bare JSON value ("true", "18.5"), {"value": ...}, or
+// an unquoted string.
+func decodeValue(payload []byte) (interface{}, error) {
+	s := strings.TrimSpace(string(payload))
+	if s == "" {
+		return nil, fmt.Errorf("empty payload")
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s, nil
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		val, ok := obj["value"]
+		if !ok {
+			return nil, fmt.Errorf(`object payload must have a "value" field`)
+		}
+		return val, nil
+	}
+	return v, nil
+}
+
+func (b *Bridge) statusTopic() string {
+	return b.prefix + "/status"
+}
+
+func (b *Bridge) tagTopic(name string) string {
+	return b.prefix + "/tags/" + topicSafe(name)
+}
+
+// topicSafe replaces characters with special meaning in MQTT topics.
+func topicSafe(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
@@ -0,0 +1,181 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+)
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    interface{}
+		err     bool
+	}{
+		{"true", true, false},
+		{" false\n", false, false},
+		{"18.5", 18.5, false},
+		{"-3", -3.0, false},
+		{`"on"`, "on", false},
+		{"on", "on", false}, // ikke gyldig JSON: brukes som streng
+		{`{"value": 42}`, 42.0, false},
+		{`{"value": "open"}`, "open", false},
+		{`{"value": null}`, nil, false},
+		{`{"val": 1}`, nil, true},
+		{"", nil, true},
+		{"   ", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := decodeValue([]byte(tt.payload))
+		if (err != nil) != tt.err {
+			t.Errorf("decodeValue(%q) error = %v, want error %v", tt.payload, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeValue(%q) = %#v, want %#v", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestTopicSafe(t *testing.T) {
+	for in, want := range map[string]string{
+		"hltTemp":       "hltTemp",
+		"fermenter/1":   "fermenter_1",
+		"a+b#c":         "a_b_c",
+		"MAIN.fbUA.x y": "MAIN.fbUA.x y",
+	} {
+		if got := topicSafe(in); got != want {
+			t.Errorf("topicSafe(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// fakeWriter husker skrivingene fra kommandoer.
+type fakeWriter struct {
+	key   string
+	value interface{}
+	actor audit.Actor
+	err   error
+}
+
+func (w *fakeWriter) WriteTag(ctx context.Context, key string, value interface{}) (*opcua.WriteResult, error) {
+	w.key, w.value, w.actor = key, value, audit.ActorFromContext(ctx)
+	if w.err != nil {
+		return nil, w.err
+	}
+	return &opcua.WriteResult{Tag: key, Value: value}, nil
+}
+
+// fakeClient fanger svarene bridgen publiserer. Bare Publish brukes.
+type fakeClient struct {
+	paho.Client
+	topic   string
+	payload []byte
+}
+
+func (c *fakeClient) Publish(topic string, _ byte, _ bool, payload interface{}) paho.Token {
+	c.topic, c.payload = topic, payload.([]byte)
+	return nil
+}
+
+func (c *fakeClient) result(t *testing.T) CommandResult {
+	t.Helper()
+	var res CommandResult
+	if err := json.Unmarshal(c.payload, &res); err != nil {
+		t.Fatalf("result payload %q: %v", c.payload, err)
+	}
+	return res
+}
+
+type fakeMessage struct {
+	paho.Message
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Topic() string   { return m.topic }
+func (m fakeMessage) Payload() []byte { return m.payload }
+
+func newTestBridge(t *testing.T, w Writer) *Bridge {
+	t.Helper()
+	tags, err := opcua.NewTagMap([]config.TagConfig{
+		{Name: "fermenter/1/valve", NodeID: "ns=4;s=MAIN.fbUA.valve1", DataType: "bool", Writable: true, SamplingInterval: "1s"},
+		{Name: "hltSetpoint", NodeID: "ns=4;s=MAIN.fbUA.hltSetpoint", DataType: "real", Writable: true, SamplingInterval: "1s"},
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(zerolog.Nop(), config.MQTTConfig{Broker: "tcp://127.0.0.1:1", TopicPrefix: "gotov/", Commands: true}, tags, w)
+}
+
+func TestHandleCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+		tag     string
+		value   interface{}
+		status  string
+	}{
+		{"plain name", "gotov/tags/hltSetpoint/set", "66.5", "hltSetpoint", 66.5, "ok"},
+		{"sanitised topic", "gotov/tags/fermenter_1_valve/set", `{"value": true}`, "fermenter/1/valve", true, "ok"},
+		{"symbol", "gotov/tags/MAIN.fbUA.hltSetpoint/set", "70", "hltSetpoint", 70.0, "ok"},
+		{"unknown tag", "gotov/tags/nope/set", "1", "", nil, "error"},
+		{"bad payload", "gotov/tags/hltSetpoint/set", `{"val": 1}`, "", nil, "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &fakeWriter{}
+			b := newTestBridge(t, w)
+			c := &fakeClient{}
+			b.handleCommand(c, fakeMessage{topic: tt.topic, payload: []byte(tt.payload)})
+
+			if c.topic != tt.topic+"/result" {
+				t.Errorf("reply on %q, want %q", c.topic, tt.topic+"/result")
+			}
+			res := c.result(t)
+			if res.Status != tt.status {
+				t.Fatalf("result = %+v, want status %s", res, tt.status)
+			}
+			if w.key != tt.tag || !reflect.DeepEqual(w.value, tt.value) {
+				t.Errorf("wrote %q = %#v, want %q = %#v", w.key, w.value, tt.tag, tt.value)
+			}
+			if tt.tag != "" && (w.actor.User != "mqtt" || w.actor.Source != audit.SourceMQTT) {
+				t.Errorf("write actor = %+v, want mqtt", w.actor)
+			}
+		})
+	}
+}
+
+func TestHandleCommandWriteError(t *testing.T) {
+	w := &fakeWriter{err: errors.New("tag is read-only")}
+	c := &fakeClient{}
+	newTestBridge(t, w).handleCommand(c, fakeMessage{topic: "gotov/tags/hltSetpoint/set", payload: []byte("1")})
+	if res := c.result(t); res.Status != "error" || res.Error != "tag is read-only" || res.Value != 1.0 {
+		t.Errorf("result = %+v, want the write error", res)
+	}
+}
+
+func TestSharedTopicGoesToFirstTag(t *testing.T) {
+	tags, err := opcua.NewTagMap([]config.TagConfig{
+		{Name: "a/b", NodeID: "ns=4;s=first", SamplingInterval: "1s"},
+		{Name: "a+b", NodeID: "ns=4;s=second", SamplingInterval: "1s"},
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &fakeWriter{}
+	b := New(zerolog.Nop(), config.MQTTConfig{TopicPrefix: "gotov", Commands: true}, tags, w)
+	b.handleCommand(&fakeClient{}, fakeMessage{topic: "gotov/tags/a_b/set", payload: []byte("1")})
+	if w.key != "a/b" {
+		t.Errorf("command went to %q, want the first tag a/b", w.key)
+	}
+}
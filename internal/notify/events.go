@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"fmt"
+
+	"github.com/MrBoggi/goTOV/internal/alarm"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+)
+
+// AlarmEvent varsler om en alarmovergang. Shelvede alarmer varsles ikke.
+// Signaturen passer alarm.Manager.OnEvent.
+func (n *Notifier) AlarmEvent(ev alarm.Event, a alarm.Alarm) {
+	if ev.Shelved {
+		return
+	}
+	n.Notify(AlarmMessage(ev, a))
+}
+
+// FermentationEvent varsler om en hendelse fra gjæringsmotoren.
+// Signaturen passer fermentation.Engine.OnEvent.
+func (n *Notifier) FermentationEvent(ev fermentation.Event) {
+	n.Notify(FermentationMessage(ev))
+}
+
+// AlarmMessage lager meldingen for en alarmovergang.
+func AlarmMessage(ev alarm.Event, a alarm.Alarm) Message {
+	var title string
+	switch ev.Transition {
+	case alarm.TransitionActivated:
+		title = "🚨 Alarm: " + a.Name
+	case alarm.TransitionCleared:
+		title = "✅ Alarm normal: " + a.Name
+	case alarm.TransitionAcked:
+		title = "👍 Alarm kvittert: " + a.Name
+	case alarm.TransitionShelved:
+		title = "🔕 Alarm shelvet: " + a.Name
+	default:
+		title = "🔔 Alarm " + ev.Transition + ": " + a.Name
+	}
+
+	body := a.Message
+	if ev.Value != nil {
+		body += fmt.Sprintf("\nVerdi: %g (grense %g)", *ev.Value, a.Limit)
+	}
+	if ev.User != "" {
+		body += "\nAv: " + ev.User
+	}
+
+	return Message{
+		Source:   "alarm",
+		Event:    "alarm." + ev.Transition,
+		Severity: ev.Severity,
+		Title:    title,
+		Body:     body,
+		Time:     ev.Time,
+		Fields: map[string]interface{}{
+			"alarm": a.Name,
+			"tag":   a.Tag,
+			"type":  a.Type,
+			"state": ev.State,
+			"value": ev.Value,
+			"limit": a.Limit,
+			"user":  ev.User,
+		},
+	}
+}
+
+// FermentationMessage lager meldingen for en gjæringshendelse.
+// Steg vises 1-basert, som i planene.
+func FermentationMessage(ev fermentation.Event) Message {
+	step := ev.StepIndex + 1
+	severity := config.SeverityInfo
+
+	var title string
+	switch ev.Type {
+	case fermentation.EventStarted:
+		title = fmt.Sprintf("🍺 Tank %d: gjæring startet", ev.TankNo)
+	case fermentation.EventStep, fermentation.EventStepManual:
+		title = fmt.Sprintf("🌡 Tank %d: steg %d nådd", ev.TankNo, step)
+	case fermentation.EventStepGravity:
+		title = fmt.Sprintf("🧪 Tank %d: steg %d nådd (gravity)", ev.TankNo, step)
+	case fermentation.EventPaused:
+		title = fmt.Sprintf("⏸ Tank %d: gjæring pauset", ev.TankNo)
+	case fermentation.EventResumed:
+		title = fmt.Sprintf("▶️ Tank %d: gjæring gjenopptatt", ev.TankNo)
+	case fermentation.EventCompleted:
+		title = fmt.Sprintf("🎉 Tank %d: gjæring ferdig", ev.TankNo)
+	case fermentation.EventAborted:
+		title = fmt.Sprintf("🛑 Tank %d: gjæring avbrutt", ev.TankNo)
+		severity = config.SeverityWarning
+	default:
+		title = fmt.Sprintf("Tank %d: %s", ev.TankNo, ev.Type)
+	}
+
+	body := fmt.Sprintf("Plan: %s\nBatch: %s", ev.PlanName, ev.BatchID)
+	if ev.Type != fermentation.EventCompleted && ev.Type != fermentation.EventAborted {
+		body += fmt.Sprintf("\nSteg %d – mål %.1f °C", step, ev.TargetTemp)
+	}
+
+	return Message{
+		Source:   "fermentation",
+		Event:    "fermentation." + ev.Type,
+		Severity: severity,
+		Title:    title,
+		Body:     body,
+		Time:     ev.Time,
+		Fields: map[string]interface{}{
+			"tank":        ev.TankNo,
+			"batch_id":    ev.BatchID,
+			"plan":        ev.PlanName,
+			"step":        step,
+			"target_temp": ev.TargetTemp,
+		},
+	}
+}
@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+)
+
+var httpClient = &http.Client{}
+
+// post sender body og feiler på alt som ikke er 2xx.
+func post(ctx context.Context, method, target, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, target, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// webhook sender meldingen til en vilkårlig URL. Uten mal sendes meldingen som JSON.
+type webhook struct {
+	url     string
+	method  string
+	headers map[string]string
+	tmpl    *template.Template
+}
+
+func newWebhook(c config.NotifierConfig) (*webhook, error) {
+	w := &webhook{url: c.URL, method: c.Method, headers: c.Headers}
+	if c.Template != "" {
+		tmpl, err := template.New(c.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		w.tmpl = tmpl
+	}
+	return w, nil
+}
+
+func (w *webhook) Send(ctx context.Context, msg Message) error {
+	var body []byte
+	if w.tmpl == nil {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		body = b
+	} else {
+		var buf bytes.Buffer
+		if err := w.tmpl.Execute(&buf, msg); err != nil {
+			return fmt.Errorf("render template: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
+	contentType := "application/json"
+	if _, ok := w.headers["Content-Type"]; ok {
+		contentType = ""
+	}
+	return post(ctx, w.method, w.url, contentType, body, w.headers)
+}
+
+// toJSON lar maler skrive trygge JSON-verdier: {"text": {{json .Title}}}.
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// telegram bruker Bot API sendMessage.
+type telegram struct {
+	base   string
+	token  string
+	chatID string
+}
+
+func (t *telegram) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.chatID,
+		"text":    msg.Text(),
+	})
+	if err != nil {
+		return err
+	}
+	err = post(ctx, http.MethodPost, t.base+"/bot"+t.token+"/sendMessage", "application/json", body, nil)
+	if err != nil {
+		// URL-en inneholder tokenet; ikke lekk det i loggen
+		return errors.New(strings.ReplaceAll(err.Error(), t.token, "***"))
+	}
+	return nil
+}
+
+// discord sender til en kanal-webhook.
+type discord struct {
+	url string
+}
+
+func (d *discord) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]string{
+		"content": "**" + msg.Title + "**\n" + msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, http.MethodPost, d.url, "application/json", body, nil)
+}
+
+// ntfy publiserer til et topic, f.eks. https://ntfy.sh/mitt-bryggeri.
+// Meldingen sendes som JSON til serverroten, slik at æøå i tittelen ikke
+// må gå i HTTP-headere.
+type ntfy struct {
+	url   string
+	token string
+}
+
+func (n *ntfy) Send(ctx context.Context, msg Message) error {
+	u, err := url.Parse(n.url)
+	if err != nil {
+		return err
+	}
+	topic := strings.Trim(u.Path, "/")
+	u.Path = "/"
+	if i := strings.LastIndexByte(topic, '/'); i >= 0 {
+		u.Path = "/" + topic[:i+1]
+		topic = topic[i+1:]
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"topic":    topic,
+		"title":    msg.Title,
+		"message":  msg.Body,
+		"priority": ntfyPriority(msg.Severity),
+		"tags":     []string{msg.Source},
+	})
+	if err != nil {
+		return err
+	}
+
+	var headers map[string]string
+	if n.token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + n.token}
+	}
+	return post(ctx, http.MethodPost, u.String(), "application/json", body, headers)
+}
+
+func ntfyPriority(severity string) int {
+	switch severity {
+	case config.SeverityCritical:
+		return 5
+	case config.SeverityWarning:
+		return 4
+	default:
+		return 3
+	}
+}
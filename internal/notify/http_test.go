@@ -0,0 +1,291 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/rs/zerolog"
+)
+
+// request er det testserveren mottok.
+type request struct {
+	method, path, contentType, auth string
+	header                          http.Header
+	body                            []byte
+}
+
+// newTestServer svarer med status og body, og husker siste forespørsel.
+func newTestServer(t *testing.T, status int, reply string) (*httptest.Server, func() request) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		last request
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		last = request{
+			method: r.Method, path: r.URL.Path, contentType: r.Header.Get("Content-Type"),
+			auth: r.Header.Get("Authorization"), header: r.Header.Clone(), body: body,
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() request {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func newTestSender(t *testing.T, c config.NotifierConfig) Sender {
+	t.Helper()
+	s, err := newSender(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var testMsg = Message{
+	Source:   "alarm",
+	Event:    "alarm.activated",
+	Severity: config.SeverityCritical,
+	Title:    `Glykol "høy"`,
+	Body:     "Glykol 4.2 °C > 3 °C",
+	Time:     time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+	Fields:   map[string]interface{}{"alarm": "glycolHigh", "tank": 2},
+}
+
+func TestWebhookDefaultJSON(t *testing.T) {
+	srv, last := newTestServer(t, http.StatusNoContent, "")
+	s := newTestSender(t, config.NotifierConfig{
+		Name: "hook", Type: config.NotifierWebhook, URL: srv.URL + "/hook", Method: http.MethodPut,
+		Headers: map[string]string{"X-Api-Key": "secret"},
+	})
+	if err := s.Send(context.Background(), testMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	req := last()
+	if req.method != http.MethodPut || req.path != "/hook" {
+		t.Errorf("request = %s %s, want PUT /hook", req.method, req.path)
+	}
+	if req.contentType != "application/json" || req.header.Get("X-Api-Key") != "secret" {
+		t.Errorf("headers = %v, want JSON and X-Api-Key", req.header)
+	}
+	var got Message
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatalf("body %s: %v", req.body, err)
+	}
+	if got.Title != testMsg.Title || got.Event != testMsg.Event || !got.Time.Equal(testMsg.Time) || got.Fields["alarm"] != "glycolHigh" {
+		t.Errorf("body = %+v, want the message", got)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	srv, last := newTestServer(t, http.StatusOK, "")
+	s := newTestSender(t, config.NotifierConfig{
+		Name: "hook", Type: config.NotifierWebhook, URL: srv.URL, Method: http.MethodPost,
+		Template: `{"text": {{json .Text}}, "tank": {{index .Fields "tank"}}, "level": "{{.Severity}}"}`,
+	})
+	if err := s.Send(context.Background(), testMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Text  string `json:"text"`
+		Tank  int    `json:"tank"`
+		Level string `json:"level"`
+	}
+	req := last()
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatalf("rendered %s: %v", req.body, err)
+	}
+	if got.Text != testMsg.Text() || got.Tank != 2 || got.Level != config.SeverityCritical {
+		t.Errorf("rendered %+v, want text, tank and level from the message", got)
+	}
+
+	// Egen Content-Type i headerne vinner
+	srv2, last2 := newTestServer(t, http.StatusOK, "")
+	s = newTestSender(t, config.NotifierConfig{
+		Name: "form", Type: config.NotifierWebhook, URL: srv2.URL, Method: http.MethodPost,
+		Headers:  map[string]string{"Content-Type": "text/plain"},
+		Template: "{{.Title}}",
+	})
+	if err := s.Send(context.Background(), testMsg); err != nil {
+		t.Fatal(err)
+	}
+	if req := last2(); req.contentType != "text/plain" || string(req.body) != testMsg.Title {
+		t.Errorf("request = %q %q, want text/plain with the title", req.contentType, req.body)
+	}
+}
+
+func TestWebhookTemplateError(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusOK, "")
+	s := newTestSender(t, config.NotifierConfig{
+		Name: "hook", Type: config.NotifierWebhook, URL: srv.URL, Method: http.MethodPost,
+		Template: `{{index .Fields "tank" "x"}}`,
+	})
+	if err := s.Send(context.Background(), testMsg); err == nil || !strings.Contains(err.Error(), "render template") {
+		t.Errorf("Send = %v, want a render error", err)
+	}
+}
+
+func TestPostErrorStatus(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusBadGateway, "upstream down\n"+strings.Repeat("x", 1000))
+	err := post(context.Background(), http.MethodPost, srv.URL, "application/json", []byte("{}"), nil)
+	if err == nil {
+		t.Fatal("post should fail on 502")
+	}
+	if !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "upstream down") {
+		t.Errorf("error = %v, want the status and response body", err)
+	}
+	if len(err.Error()) > 700 {
+		t.Errorf("error is %d bytes, want the response body truncated", len(err.Error()))
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	srv, last := newTestServer(t, http.StatusOK, `{"ok":true}`)
+	s := newTestSender(t, config.NotifierConfig{
+		Name: "tg", Type: config.NotifierTelegram, URL: srv.URL + "/", Token: "123:abc", ChatID: "-42",
+	})
+	if err := s.Send(context.Background(), testMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	req := last()
+	if req.path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s, want /bot123:abc/sendMessage", req.path)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["chat_id"] != "-42" || got["text"] != testMsg.Title+"\n"+testMsg.Body {
+		t.Errorf("body = %v, want chat id and text", got)
+	}
+}
+
+func TestTelegramHidesToken(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusUnauthorized, `{"ok":false,"description":"Unauthorized"}`)
+	s := newTestSender(t, config.NotifierConfig{
+		Name: "tg", Type: config.NotifierTelegram, URL: srv.URL, Token: "123:secret", ChatID: "1",
+	})
+	err := s.Send(context.Background(), testMsg)
+	if err == nil {
+		t.Fatal("Send should fail on 401")
+	}
+	if strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "/bot***/sendMessage") {
+		t.Errorf("error = %v, want the token masked", err)
+	}
+}
+
+func TestDiscord(t *testing.T) {
+	srv, last := newTestServer(t, http.StatusNoContent, "")
+	s := newTestSender(t, config.NotifierConfig{Name: "dc", Type: config.NotifierDiscord, URL: srv.URL + "/api/webhooks/1/x"})
+	if err := s.Send(context.Background(), testMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	req := last()
+	var got map[string]string
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if req.path != "/api/webhooks/1/x" || got["content"] != "**"+testMsg.Title+"**\n"+testMsg.Body {
+		t.Errorf("request = %s %v, want bold title and body", req.path, got)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		severity string
+		wantPath string
+		topic    string
+		priority int
+	}{
+		{"topic at root", "/brew", "", config.SeverityCritical, "/", "brew", 5},
+		{"topic below a path", "/ntfy/brew/", "tk_1", config.SeverityWarning, "/ntfy/", "brew", 4},
+		{"info", "/brew", "", config.SeverityInfo, "/", "brew", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, last := newTestServer(t, http.StatusOK, "{}")
+			s := newTestSender(t, config.NotifierConfig{Name: "n", Type: config.NotifierNtfy, URL: srv.URL + tt.path, Token: tt.token})
+			msg := testMsg
+			msg.Severity = tt.severity
+			if err := s.Send(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+
+			req := last()
+			if req.path != tt.wantPath {
+				t.Errorf("path = %s, want %s", req.path, tt.wantPath)
+			}
+			var got struct {
+				Topic    string   `json:"topic"`
+				Title    string   `json:"title"`
+				Message  string   `json:"message"`
+				Priority int      `json:"priority"`
+				Tags     []string `json:"tags"`
+			}
+			if err := json.Unmarshal(req.body, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Topic != tt.topic || got.Priority != tt.priority || got.Title != msg.Title || got.Message != msg.Body ||
+				len(got.Tags) != 1 || got.Tags[0] != "alarm" {
+				t.Errorf("body = %+v, want topic %s with priority %d", got, tt.topic, tt.priority)
+			}
+			wantAuth := ""
+			if tt.token != "" {
+				wantAuth = "Bearer " + tt.token
+			}
+			if req.auth != wantAuth {
+				t.Errorf("Authorization = %q, want %q", req.auth, wantAuth)
+			}
+		})
+	}
+}
+
+func TestSendTest(t *testing.T) {
+	srv, last := newTestServer(t, http.StatusOK, "")
+	failing, _ := newTestServer(t, http.StatusInternalServerError, "nope")
+	n, err := New(zerolog.Nop(), config.NotificationsConfig{Channels: []config.NotifierConfig{
+		{Name: "ok", Type: config.NotifierDiscord, URL: srv.URL},
+		{Name: "broken", Type: config.NotifierDiscord, URL: failing.URL},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.SendTest(context.Background(), "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if req := last(); !strings.Contains(string(req.body), "testvarsel") {
+		t.Errorf("body = %s, want the test message", req.body)
+	}
+	if err := n.SendTest(context.Background(), "broken"); err == nil || !strings.HasPrefix(err.Error(), "broken: ") {
+		t.Errorf("SendTest(broken) = %v, want an error naming the channel", err)
+	}
+	if err := n.SendTest(context.Background(), ""); err == nil {
+		t.Error("SendTest to all should fail when one channel fails")
+	}
+	if err := n.SendTest(context.Background(), "pager"); err == nil || !strings.Contains(err.Error(), "unknown notifier") {
+		t.Errorf("SendTest(pager) = %v, want unknown notifier", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package notify sender varsler om alarmer og gjæringshendelser til
+// e-post, webhooks og push-tjenester.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/rs/zerolog"
+)
+
+const (
+	queueSize   = 100
+	sendTimeout = 15 * time.Second
+)
+
+// Standard hendelser når en kanal ikke har events-filter.
+var defaultEvents = []string{"alarm.activated", "alarm.cleared", "fermentation.*"}
+
+// Message er ett varsel, uavhengig av kanal.
+type Message struct {
+	Source   string    `json:"source"` // "alarm" eller "fermentation"
+	Event    string    `json:"event"`  // f.eks. "alarm.activated", "fermentation.completed"
+	Severity string    `json:"severity"`
+	Title    string    `json:"title"`
+	Body     string    `json:"body"`
+	Time     time.Time `json:"time"`
+
+	// Ekstra felt for webhook-maler (alarmnavn, tank, steg ...).
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Text er tittel og tekst i én streng, for kanaler uten eget tittelfelt.
+func (m Message) Text() string {
+	if m.Body == "" {
+		return m.Title
+	}
+	return m.Title + "\n" + m.Body
+}
+
+// Sender leverer en melding til én tjeneste.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// channel er en sender med filtre og egen kø.
+type channel struct {
+	name   string
+	typ    string
+	sender Sender
+
+	minSeverity      int
+	events           []string
+	quiet            *quietHours
+	quietMinSeverity int
+
+	queue chan Message
+}
+
+// Notifier fordeler meldinger til kanalene som skal ha dem.
+type Notifier struct {
+	log      zerolog.Logger
+	channels []*channel
+}
+
+// New bygger kanalene fra config. Ingen meldinger sendes før Run startes.
+func New(log zerolog.Logger, cfg config.NotificationsConfig) (*Notifier, error) {
+	n := &Notifier{log: log}
+
+	for _, c := range cfg.Channels {
+		sender, err := newSender(c)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", c.Name, err)
+		}
+
+		ch := &channel{
+			name:             c.Name,
+			typ:              c.Type,
+			sender:           sender,
+			minSeverity:      config.SeverityRank(c.MinSeverity),
+			events:           c.Events,
+			quietMinSeverity: config.SeverityRank(c.QuietMinSeverity),
+			queue:            make(chan Message, queueSize),
+		}
+		if len(ch.events) == 0 {
+			ch.events = defaultEvents
+		}
+		if c.QuietHours != "" {
+			q, err := parseQuietHours(c.QuietHours)
+			if err != nil {
+				return nil, fmt.Errorf("notifier %q: %w", c.Name, err)
+			}
+			ch.quiet = q
+		}
+		n.channels = append(n.channels, ch)
+	}
+
+	return n, nil
+}
+
+func newSender(c config.NotifierConfig) (Sender, error) {
+	switch c.Type {
+	case config.NotifierSMTP:
+		return &smtpSender{cfg: c.SMTP}, nil
+	case config.NotifierWebhook:
+		return newWebhook(c)
+	case config.NotifierTelegram:
+		return &telegram{base: strings.TrimRight(c.URL, "/"), token: c.Token, chatID: c.ChatID}, nil
+	case config.NotifierDiscord:
+		return &discord{url: c.URL}, nil
+	case config.NotifierNtfy:
+		return &ntfy{url: c.URL, token: c.Token}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", c.Type)
+	}
+}
+
+// Channels returnerer navnene på de konfigurerte kanalene.
+func (n *Notifier) Channels() []string {
+	names := make([]string, 0, len(n.channels))
+	for _, ch := range n.channels {
+		names = append(names, ch.name)
+	}
+	return names
+}
+
+// Notify legger meldingen i køen til hver kanal som slipper den gjennom.
+// Blokkerer aldri; er køen full droppes meldingen.
+func (n *Notifier) Notify(msg Message) {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	for _, ch := range n.channels {
+		if !ch.accepts(msg) {
+			continue
+		}
+		select {
+		case ch.queue <- msg:
+		default:
+			n.log.Warn().Str("channel", ch.name).Str("event", msg.Event).Msg("⚠️ Notification queue full, message dropped")
+		}
+	}
+}
+
+// Run sender meldinger fra køene til ctx kanselleres.
+func (n *Notifier) Run(ctx context.Context) {
+	n.log.Info().Strs("channels", n.Channels()).Msg("🔔 Notifier started")
+	for _, ch := range n.channels {
+		go n.worker(ctx, ch)
+	}
+	<-ctx.Done()
+}
+
+// SendTest sender en testmelding direkte til én kanal (eller alle når name er tom),
+// uten filtre og stilletid.
+func (n *Notifier) SendTest(ctx context.Context, name string) error {
+	msg := Message{
+		Source:   "test",
+		Event:    "test",
+		Severity: config.SeverityInfo,
+		Title:    "goTØV testvarsel",
+		Body:     "Hvis du leser dette, fungerer varslingen.",
+		Time:     time.Now(),
+	}
+
+	found := false
+	for _, ch := range n.channels {
+		if name != "" && ch.name != name {
+			continue
+		}
+		found = true
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := ch.sender.Send(sendCtx, msg)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", ch.name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown notifier %q", name)
+	}
+	return nil
+}
+
+func (n *Notifier) worker(ctx context.Context, ch *channel) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-ch.queue:
+			sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+			err := ch.sender.Send(sendCtx, msg)
+			cancel()
+			if err != nil {
+				n.log.Error().Err(err).Str("channel", ch.name).Str("event", msg.Event).Msg("❌ Failed to send notification")
+				continue
+			}
+			n.log.Debug().Str("channel", ch.name).Str("event", msg.Event).Msg("🔔 Notification sent")
+		}
+	}
+}
+
+// accepts sjekker alvorlighetsgrad, hendelsesfilter og stilletid.
+func (ch *channel) accepts(msg Message) bool {
+	sev := config.SeverityRank(msg.Severity)
+	if sev < ch.minSeverity {
+		return false
+	}
+	if !matchEvent(ch.events, msg.Event) {
+		return false
+	}
+	if ch.quiet != nil && ch.quiet.contains(msg.Time) && sev < ch.quietMinSeverity {
+		return false
+	}
+	return true
+}
+
+// matchEvent støtter glob-mønstre som "fermentation.*".
+func matchEvent(patterns []string, event string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, event); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// quietHours er et daglig tidsrom, angitt i minutter etter midnatt.
+// start > end betyr at perioden går over midnatt.
+type quietHours struct {
+	start, end int
+}
+
+func parseQuietHours(s string) (*quietHours, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet_hours %q (want HH:MM-HH:MM)", s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet_hours %q: %w", s, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet_hours %q: %w", s, err)
+	}
+	return &quietHours{
+		start: start.Hour()*60 + start.Minute(),
+		end:   end.Hour()*60 + end.Minute(),
+	}, nil
+}
+
+func (q *quietHours) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if q.start <= q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/rs/zerolog"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int
+		err        bool
+	}{
+		{"22:00-07:00", 22 * 60, 7 * 60, false},
+		{" 08:30 - 17:15 ", 8*60 + 30, 17*60 + 15, false},
+		{"00:00-00:00", 0, 0, false},
+		{"22:00", 0, 0, true},
+		{"25:00-07:00", 0, 0, true},
+		{"22:00-7", 0, 0, true},
+		{"", 0, 0, true},
+	}
+	for _, tt := range tests {
+		q, err := parseQuietHours(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parseQuietHours(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && (q.start != tt.start || q.end != tt.end) {
+			t.Errorf("parseQuietHours(%q) = %d-%d, want %d-%d", tt.in, q.start, q.end, tt.start, tt.end)
+		}
+	}
+}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2026, 5, 1, hour, minute, 0, 0, time.Local)
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := &quietHours{start: 22 * 60, end: 7 * 60}
+	daytime := &quietHours{start: 8 * 60, end: 17 * 60}
+	tests := []struct {
+		q    *quietHours
+		t    time.Time
+		want bool
+	}{
+		{overnight, at(21, 59), false},
+		{overnight, at(22, 0), true},
+		{overnight, at(23, 30), true},
+		{overnight, at(0, 0), true},
+		{overnight, at(6, 59), true},
+		{overnight, at(7, 0), false},
+		{overnight, at(12, 0), false},
+		{daytime, at(7, 59), false},
+		{daytime, at(8, 0), true},
+		{daytime, at(16, 59), true},
+		{daytime, at(17, 0), false},
+		{daytime, at(23, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.q.contains(tt.t); got != tt.want {
+			t.Errorf("%d-%d contains %s = %v, want %v", tt.q.start, tt.q.end, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestMatchEvent(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		event    string
+		want     bool
+	}{
+		{defaultEvents, "alarm.activated", true},
+		{defaultEvents, "alarm.cleared", true},
+		{defaultEvents, "alarm.acked", false},
+		{defaultEvents, "fermentation.completed", true},
+		{[]string{"alarm.*"}, "alarm.shelved", true},
+		{[]string{"alarm.*"}, "fermentation.step", false},
+		{[]string{"*"}, "fermentation.step", true},
+		{[]string{"fermentation.step*"}, "fermentation.step_gravity", true},
+		{[]string{"[bad"}, "alarm.activated", false},
+		{nil, "alarm.activated", false},
+	}
+	for _, tt := range tests {
+		if got := matchEvent(tt.patterns, tt.event); got != tt.want {
+			t.Errorf("matchEvent(%v, %q) = %v, want %v", tt.patterns, tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestChannelAccepts(t *testing.T) {
+	n, err := New(zerolog.Nop(), config.NotificationsConfig{Channels: []config.NotifierConfig{{
+		Name: "phone", Type: config.NotifierDiscord, URL: "http://127.0.0.1:1",
+		MinSeverity: config.SeverityWarning, Events: []string{"alarm.*", "fermentation.completed"},
+		QuietHours: "22:00-07:00", QuietMinSeverity: config.SeverityCritical,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := n.channels[0]
+
+	tests := []struct {
+		name     string
+		event    string
+		severity string
+		time     time.Time
+		want     bool
+	}{
+		{"warning alarm by day", "alarm.activated", config.SeverityWarning, at(12, 0), true},
+		{"info below min severity", "alarm.activated", config.SeverityInfo, at(12, 0), false},
+		{"unknown severity counts as info", "alarm.activated", "loud", at(12, 0), false},
+		{"event not in filter", "fermentation.step", config.SeverityCritical, at(12, 0), false},
+		{"exact event", "fermentation.completed", config.SeverityWarning, at(12, 0), true},
+		{"warning in quiet hours before midnight", "alarm.activated", config.SeverityWarning, at(23, 0), false},
+		{"warning in quiet hours after midnight", "alarm.activated", config.SeverityWarning, at(3, 0), false},
+		{"critical in quiet hours", "alarm.activated", config.SeverityCritical, at(3, 0), true},
+		{"warning after quiet hours", "alarm.activated", config.SeverityWarning, at(7, 0), true},
+	}
+	for _, tt := range tests {
+		msg := Message{Event: tt.event, Severity: tt.severity, Time: tt.time}
+		if got := ch.accepts(msg); got != tt.want {
+			t.Errorf("%s: accepts = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	n, err := New(zerolog.Nop(), config.NotificationsConfig{Channels: []config.NotifierConfig{
+		{Name: "all", Type: config.NotifierNtfy, URL: "http://127.0.0.1:1/brew"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := n.channels[0]
+	if ch.quiet != nil || ch.minSeverity != 0 || len(ch.events) != len(defaultEvents) {
+		t.Errorf("channel = %+v, want no quiet hours, all severities and the default events", ch)
+	}
+
+	for _, c := range []config.NotifierConfig{
+		{Name: "bad", Type: "pager"},
+		{Name: "bad", Type: config.NotifierNtfy, QuietHours: "late"},
+		{Name: "bad", Type: config.NotifierWebhook, Template: "{{.Title"},
+	} {
+		if _, err := New(zerolog.Nop(), config.NotificationsConfig{Channels: []config.NotifierConfig{c}}); err == nil {
+			t.Errorf("New(%+v) should fail", c)
+		}
+	}
+}
+
+func TestNotifyQueuesAcceptedMessages(t *testing.T) {
+	n, err := New(zerolog.Nop(), config.NotificationsConfig{Channels: []config.NotifierConfig{
+		{Name: "alarms", Type: config.NotifierDiscord, Events: []string{"alarm.*"}},
+		{Name: "brewing", Type: config.NotifierDiscord, Events: []string{"fermentation.*"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(Message{Event: "fermentation.completed", Severity: config.SeverityInfo})
+	if len(n.channels[0].queue) != 0 || len(n.channels[1].queue) != 1 {
+		t.Fatalf("queues = %d/%d, want 0/1", len(n.channels[0].queue), len(n.channels[1].queue))
+	}
+	if msg := <-n.channels[1].queue; msg.Time.IsZero() {
+		t.Error("Notify should set the time on messages without one")
+	}
+
+	// Full kø blokkerer ikke
+	for range queueSize + 5 {
+		n.Notify(Message{Event: "alarm.activated", Severity: config.SeverityCritical})
+	}
+	if len(n.channels[0].queue) != queueSize {
+		t.Errorf("queue = %d, want it capped at %d", len(n.channels[0].queue), queueSize)
+	}
+}
@@ -0,0 +1,322 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/gopcua/opcua/ua"
+)
+
+// ErrSkipped marks entries in a batch write that were not sent because
+// another entry failed validation.
+var ErrSkipped = errors.New("not written: another value in the batch was rejected")
+
+// ReadResult is the outcome of reading one node in a batch.
+type ReadResult struct {
+	Tag        string      `json:"tag,omitempty"` // tomt når noden ikke er i tag-konfigurasjonen
+	NodeID     string      `json:"node_id"`
+	Value      interface{} `json:"value"`
+	Type       string      `json:"value_type,omitempty"`
+	SourceTime *time.Time  `json:"source_time,omitempty"`
+	Status     string      `json:"status"` // "ok" eller "error"
+	Error      string      `json:"error,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// NodeWrite is one value in a batch write.
+type NodeWrite struct {
+	NodeID string
+	Value  interface{}
+}
+
+// TagWrite is one entry in a WriteTags batch.
+type TagWrite struct {
+	Tag   string      `json:"tag"`
+	Value interface{} `json:"value"`
+}
+
+// BatchWriteResult is the per-tag outcome of WriteTags.
+type BatchWriteResult struct {
+	WriteResult
+	Status string `json:"status"` // ok, rejected, skipped eller error
+	Error  string `json:"error,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// ReadNodeValues reads several nodes in a single ReadRequest. Each result
+// carries its own status; err is only set when the request as a whole failed.
+func (c *Client) ReadNodeValues(ctx context.Context, nodeIDs []string) ([]ReadResult, error) {
+	results := make([]ReadResult, len(nodeIDs))
+	var (
+		toRead []*ua.ReadValueID
+		index  []int // results-indeks for hver node i requesten
+	)
+	for i, nodeID := range nodeIDs {
+		results[i].NodeID = nodeID
+		if t, ok := c.tags.Lookup(nodeID); ok {
+			results[i].Tag = t.Name
+		}
+		id, err := ua.ParseNodeID(nodeID)
+		if err != nil {
+			results[i].fail(fmt.Errorf("invalid node id: %w", err))
+			continue
+		}
+		toRead = append(toRead, &ua.ReadValueID{NodeID: id, AttributeID: ua.AttributeIDValue})
+		index = append(index, i)
+	}
+	if len(toRead) == 0 {
+		return results, nil
+	}
+
+	conn, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := conn.Read(ctx, &ua.ReadRequest{
+		MaxAge:             2000,
+		NodesToRead:        toRead,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	if resp == nil || len(resp.Results) != len(toRead) {
+		return nil, fmt.Errorf("read failed: expected %d results", len(toRead))
+	}
+
+	for n, dv := range resp.Results {
+		r := &results[index[n]]
+		if dv.Status != ua.StatusOK {
+			r.fail(fmt.Errorf("status not OK: %v", dv.Status))
+			continue
+		}
+		if dv.Value == nil || dv.Value.Value() == nil {
+			r.fail(fmt.Errorf("value is nil"))
+			continue
+		}
+		r.Value = dv.Value.Value()
+		r.Type = fmt.Sprintf("%T", r.Value)
+		if !dv.SourceTimestamp.IsZero() {
+			ts := dv.SourceTimestamp
+			r.SourceTime = &ts
+		}
+		r.Status = "ok"
+	}
+	return results, nil
+}
+
+// ReadTags reads tags by name, symbol or node ID in one request. Keys that
+// are not in the tag map are read as raw node IDs.
+func (c *Client) ReadTags(ctx context.Context, keys []string) ([]ReadResult, error) {
+	nodeIDs := make([]string, len(keys))
+	for i, key := range keys {
+		nodeIDs[i] = key
+		if t, ok := c.tags.Lookup(key); ok {
+			nodeIDs[i] = t.NodeID
+		}
+	}
+	return c.ReadNodeValues(ctx, nodeIDs)
+}
+
+func (r *ReadResult) fail(err error) {
+	r.Status, r.Error, r.Err = "error", err.Error(), err
+}
+
+// WriteNodeValues writes several nodes in a single WriteRequest, in the given
+// order. There is no writable or min/max check – the fermentation engine owns
+// its outputs – but each value is converted to the node's DataType like in
+// WriteTag, so a bool reaches a valve declared as INT as 0/1. If a value
+// can't be converted nothing is written. Each write is audited.
+// The returned slice has one error (or nil) per write; err is set when the
+// request as a whole failed and nothing was written.
+func (c *Client) WriteNodeValues(ctx context.Context, writes []NodeWrite) ([]error, error) {
+	old := make([]interface{}, len(writes))
+	for i, w := range writes {
+		old[i], _ = c.LastValue(w.NodeID)
+	}
+
+	coerced := append([]NodeWrite(nil), writes...)
+	var err error
+	for i := range coerced {
+		if coerced[i].Value, err = c.coerceNode(ctx, writes[i].NodeID, writes[i].Value); err != nil {
+			coerced = writes
+			break
+		}
+	}
+
+	var errs []error
+	if err == nil {
+		errs, err = c.writeNodes(ctx, coerced)
+	}
+	for i, w := range coerced {
+		target := w.NodeID
+		if tag, ok := c.tags.Lookup(w.NodeID); ok {
+			target = tag.Name
+		}
+		nodeErr := err
+		if nodeErr == nil {
+			nodeErr = errs[i]
+		}
+		if errors.Is(nodeErr, ErrInvalidValue) {
+			nodeErr = audit.Rejected(nodeErr)
+		}
+		c.audit.Record(ctx, audit.ActionTagWrite, target, old[i], w.Value, nodeErr)
+	}
+	return errs, err
+}
+
+// coerceNode konverterer value til nodens datatype, også for noder som ikke
+// er konfigurert som tag (tankenes utganger).
+func (c *Client) coerceNode(ctx context.Context, nodeID string, value interface{}) (interface{}, error) {
+	tag, ok := c.tags.Lookup(nodeID)
+	if !ok {
+		id, err := ua.ParseNodeID(nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node id %q: %w", nodeID, err)
+		}
+		tag = &Tag{Name: nodeID, NodeID: nodeID, id: id}
+	}
+	typ, err := c.dataType(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	v, err := Coerce(value, typ)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tag.Name, err)
+	}
+	return v, nil
+}
+
+// WriteTags validates every entry like WriteTag and writes them in one
+// request. If any entry is rejected nothing is written, so related outputs
+// (e.g. valve and heater) never end up half-set because of a bad value.
+// err is the first failure; the results say what happened to each entry.
+func (c *Client) WriteTags(ctx context.Context, writes []TagWrite) ([]BatchWriteResult, error) {
+	results := make([]BatchWriteResult, len(writes))
+	old := make([]interface{}, len(writes))
+	var firstErr error
+
+	for i, w := range writes {
+		r := &results[i]
+		r.Tag, r.Value = w.Tag, w.Value
+
+		tag, ok := c.tags.Lookup(w.Tag)
+		if !ok {
+			r.fail(fmt.Errorf("%w: %q", ErrUnknownTag, w.Tag))
+		} else {
+			old[i], _ = c.LastValue(tag.NodeID)
+			res, err := c.validate(ctx, tag, w.Value)
+			if err != nil {
+				r.Tag, r.NodeID = tag.Name, tag.NodeID
+				r.fail(err)
+			} else {
+				r.WriteResult = *res
+			}
+		}
+		if firstErr == nil && r.Err != nil {
+			firstErr = r.Err
+		}
+	}
+
+	if firstErr != nil {
+		for i := range results {
+			r := &results[i]
+			if r.Err == nil {
+				r.fail(ErrSkipped)
+			}
+			err := r.Err
+			if !errors.Is(err, ErrNotConnected) {
+				err = audit.Rejected(err)
+			}
+			c.audit.Record(ctx, audit.ActionTagWrite, r.Tag, old[i], writes[i].Value, err)
+		}
+		return results, firstErr
+	}
+
+	nodes := make([]NodeWrite, len(results))
+	for i, r := range results {
+		nodes[i] = NodeWrite{NodeID: r.NodeID, Value: r.Value}
+	}
+	errs, err := c.writeNodes(ctx, nodes)
+	for i := range results {
+		r := &results[i]
+		nodeErr := err
+		if nodeErr == nil {
+			nodeErr = errs[i]
+		}
+		if nodeErr != nil {
+			r.fail(nodeErr)
+			if firstErr == nil {
+				firstErr = nodeErr
+			}
+		} else {
+			r.Status = "ok"
+		}
+		c.audit.Record(ctx, audit.ActionTagWrite, r.Tag, old[i], r.Value, nodeErr)
+	}
+	return results, firstErr
+}
+
+func (r *BatchWriteResult) fail(err error) {
+	r.Err, r.Error = err, err.Error()
+	switch {
+	case errors.Is(err, ErrSkipped):
+		r.Status = "skipped"
+	case errors.Is(err, ErrUnknownTag), errors.Is(err, ErrNotWritable),
+		errors.Is(err, ErrInvalidValue), errors.Is(err, ErrOutOfRange):
+		r.Status = "rejected"
+	default:
+		r.Status = "error"
+	}
+}
+
+// writeNodes sends all values in one WriteRequest.
+func (c *Client) writeNodes(ctx context.Context, writes []NodeWrite) ([]error, error) {
+	req := &ua.WriteRequest{NodesToWrite: make([]*ua.WriteValue, len(writes))}
+	for i, w := range writes {
+		id, err := ua.ParseNodeID(w.NodeID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node id %q: %w", w.NodeID, err)
+		}
+		v, err := ua.NewVariant(w.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", w.NodeID, err)
+		}
+		req.NodesToWrite[i] = &ua.WriteValue{
+			NodeID:      id,
+			AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{
+				EncodingMask: ua.DataValueValue,
+				Value:        v,
+			},
+		}
+	}
+
+	conn, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := conn.Write(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	if len(resp.Results) != len(writes) {
+		return nil, fmt.Errorf("write failed: expected %d results, got %d", len(writes), len(resp.Results))
+	}
+
+	errs := make([]error, len(writes))
+	for i, status := range resp.Results {
+		if status != ua.StatusOK {
+			errs[i] = fmt.Errorf("write not OK: %v", status)
+			continue
+		}
+		c.log.Info().Msgf("✅ Wrote %v to %s", writes[i].Value, writes[i].NodeID)
+	}
+	return errs, nil
+}
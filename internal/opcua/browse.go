@@ -0,0 +1,285 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// Grenser for Browse, så et feilskrevet startpunkt ikke drar med seg hele ns=0.
+const (
+	DefaultBrowseDepth = 3
+	MaxBrowseDepth     = 10
+	maxBrowseNodes     = 10000
+	browseChunk        = 100 // noder per Browse/Read-request
+)
+
+// ErrInvalidNodeID is returned by Browse for a start node that does not parse.
+var ErrInvalidNodeID = errors.New("invalid node id")
+
+// BrowseOptions limits a recursive browse.
+type BrowseOptions struct {
+	Depth     int    // nivåer under startnoden (0 = DefaultBrowseDepth)
+	Filter    string // glob mot Path, f.eks. "MAIN.fbUA.*Temp"
+	Variables bool   // bare variabler (objekter traverseres fortsatt)
+}
+
+// BrowseNode describes one node found by Browse.
+type BrowseNode struct {
+	NodeID      string `json:"node_id"`
+	BrowseName  string `json:"browse_name"`
+	DisplayName string `json:"display_name"`
+	Path        string `json:"path"` // browse-navn fra startnoden, skilt med "."
+	NodeClass   string `json:"node_class"`
+	DataType    string `json:"data_type,omitempty"`    // data_type-navn for config.yaml, eller DataType-nodens ID
+	AccessLevel string `json:"access_level,omitempty"` // read, write eller read/write
+	Depth       int    `json:"depth"`
+}
+
+// Writable reports whether the current user may write the node's value.
+func (n BrowseNode) Writable() bool {
+	return strings.Contains(n.AccessLevel, "write")
+}
+
+// ConfigDataType returns DataType if it can be used as data_type in
+// config.yaml, or "" for structures, enums and other non built-in types.
+func (n BrowseNode) ConfigDataType() string {
+	if _, ok := TypeIDByName(n.DataType); ok {
+		return n.DataType
+	}
+	return ""
+}
+
+// Browse walks the hierarchical references below start (default the Objects
+// folder) breadth first and returns objects and variables with their data
+// type and access level. Nodes are browsed and read in batches per level.
+func (c *Client) Browse(ctx context.Context, start string, opts BrowseOptions) ([]BrowseNode, error) {
+	startID := ua.NewNumericNodeID(0, id.ObjectsFolder)
+	if start != "" {
+		var err error
+		if startID, err = ua.ParseNodeID(start); err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidNodeID, start, err)
+		}
+	}
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = DefaultBrowseDepth
+	}
+	if depth > MaxBrowseDepth {
+		return nil, fmt.Errorf("depth %d exceeds max %d", depth, MaxBrowseDepth)
+	}
+
+	conn, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+
+	type parent struct {
+		id   *ua.NodeID
+		path string
+	}
+	var (
+		found   []BrowseNode
+		level   = []parent{{id: startID}}
+		visited = map[string]bool{startID.String(): true}
+	)
+
+	for d := 1; d <= depth && len(level) > 0; d++ {
+		var next []parent
+		for i := 0; i < len(level); i += browseChunk {
+			chunk := level[i:min(i+browseChunk, len(level))]
+			ids := make([]*ua.NodeID, len(chunk))
+			for j, p := range chunk {
+				ids[j] = p.id
+			}
+			refs, err := c.browseChildren(ctx, conn, ids)
+			if err != nil {
+				return nil, err
+			}
+
+			for j, p := range chunk {
+				for _, ref := range refs[j] {
+					if ref.NodeID == nil || ref.NodeID.NodeID == nil || ref.NodeID.ServerIndex != 0 {
+						continue
+					}
+					nodeID := ref.NodeID.NodeID.String()
+					if visited[nodeID] {
+						continue
+					}
+					visited[nodeID] = true
+
+					n := BrowseNode{
+						NodeID:    nodeID,
+						NodeClass: strings.TrimPrefix(ref.NodeClass.String(), "NodeClass"),
+						Depth:     d,
+					}
+					if ref.BrowseName != nil {
+						n.BrowseName = ref.BrowseName.Name
+					}
+					if ref.DisplayName != nil {
+						n.DisplayName = ref.DisplayName.Text
+					}
+					n.Path = n.BrowseName
+					if p.path != "" {
+						n.Path = p.path + "." + n.BrowseName
+					}
+
+					found = append(found, n)
+					if len(found) > maxBrowseNodes {
+						return nil, fmt.Errorf("browse returned more than %d nodes; start lower or reduce depth", maxBrowseNodes)
+					}
+					next = append(next, parent{id: ref.NodeID.NodeID, path: n.Path})
+				}
+			}
+		}
+		level = next
+	}
+
+	out := found[:0]
+	for _, n := range found {
+		if opts.Variables && n.NodeClass != "Variable" {
+			continue
+		}
+		if opts.Filter != "" {
+			if ok, _ := path.Match(opts.Filter, n.Path); !ok {
+				continue
+			}
+		}
+		out = append(out, n)
+	}
+
+	if err := c.readVariableAttributes(ctx, conn, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// browseChildren returns the forward hierarchical references (objects and
+// variables) of each node, following continuation points.
+func (c *Client) browseChildren(ctx context.Context, conn *opcua.Client, ids []*ua.NodeID) ([][]*ua.ReferenceDescription, error) {
+	req := &ua.BrowseRequest{
+		View:          &ua.ViewDescription{ViewID: ua.NewTwoByteNodeID(0)},
+		NodesToBrowse: make([]*ua.BrowseDescription, len(ids)),
+	}
+	for i, nid := range ids {
+		req.NodesToBrowse[i] = &ua.BrowseDescription{
+			NodeID:          nid,
+			BrowseDirection: ua.BrowseDirectionForward,
+			ReferenceTypeID: ua.NewNumericNodeID(0, id.HierarchicalReferences),
+			IncludeSubtypes: true,
+			NodeClassMask:   uint32(ua.NodeClassObject | ua.NodeClassVariable),
+			ResultMask:      uint32(ua.BrowseResultMaskAll),
+		}
+	}
+
+	resp, err := conn.Browse(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("browse failed: %w", err)
+	}
+	if len(resp.Results) != len(ids) {
+		return nil, fmt.Errorf("browse failed: expected %d results", len(ids))
+	}
+
+	refs := make([][]*ua.ReferenceDescription, len(ids))
+	for i, res := range resp.Results {
+		if res.StatusCode != ua.StatusOK {
+			if len(ids) == 1 {
+				return nil, fmt.Errorf("browse %s: %v", ids[0], res.StatusCode)
+			}
+			c.log.Debug().Str("node", ids[i].String()).Msgf("Browse status %v", res.StatusCode)
+			continue
+		}
+		refs[i] = res.References
+
+		cp := res.ContinuationPoint
+		for len(cp) > 0 {
+			more, err := conn.BrowseNext(ctx, &ua.BrowseNextRequest{ContinuationPoints: [][]byte{cp}})
+			if err != nil {
+				return nil, fmt.Errorf("browse next failed: %w", err)
+			}
+			if len(more.Results) == 0 || more.Results[0].StatusCode != ua.StatusOK {
+				break
+			}
+			refs[i] = append(refs[i], more.Results[0].References...)
+			cp = more.Results[0].ContinuationPoint
+		}
+	}
+	return refs, nil
+}
+
+// readVariableAttributes fills DataType and AccessLevel for all variables.
+func (c *Client) readVariableAttributes(ctx context.Context, conn *opcua.Client, nodes []BrowseNode) error {
+	var vars []int
+	for i, n := range nodes {
+		if n.NodeClass == "Variable" {
+			vars = append(vars, i)
+		}
+	}
+
+	for i := 0; i < len(vars); i += browseChunk {
+		chunk := vars[i:min(i+browseChunk, len(vars))]
+		req := &ua.ReadRequest{NodesToRead: make([]*ua.ReadValueID, 0, 3*len(chunk))}
+		for _, idx := range chunk {
+			nid, err := ua.ParseNodeID(nodes[idx].NodeID)
+			if err != nil {
+				return err
+			}
+			req.NodesToRead = append(req.NodesToRead,
+				&ua.ReadValueID{NodeID: nid, AttributeID: ua.AttributeIDDataType},
+				&ua.ReadValueID{NodeID: nid, AttributeID: ua.AttributeIDUserAccessLevel},
+				&ua.ReadValueID{NodeID: nid, AttributeID: ua.AttributeIDAccessLevel},
+			)
+		}
+
+		resp, err := conn.Read(ctx, req)
+		if err != nil {
+			return fmt.Errorf("read attributes failed: %w", err)
+		}
+		if len(resp.Results) != len(req.NodesToRead) {
+			return fmt.Errorf("read attributes failed: expected %d results", len(req.NodesToRead))
+		}
+
+		for j, idx := range chunk {
+			n := &nodes[idx]
+			if dv := resp.Results[3*j]; dv.Status == ua.StatusOK && dv.Value != nil {
+				if dt, ok := dv.Value.Value().(*ua.NodeID); ok {
+					n.DataType = dt.String()
+					if typ, ok := builtinType(dt); ok {
+						n.DataType = configTypeName(typ)
+					}
+				}
+			}
+			// UserAccessLevel gjelder innlogget bruker; ikke alle servere har den
+			for _, dv := range resp.Results[3*j+1 : 3*j+3] {
+				if dv.Status != ua.StatusOK || dv.Value == nil {
+					continue
+				}
+				if level, ok := dv.Value.Value().(uint8); ok {
+					n.AccessLevel = accessLevel(ua.AccessLevelType(level))
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func accessLevel(l ua.AccessLevelType) string {
+	r := l&ua.AccessLevelTypeCurrentRead != 0
+	w := l&ua.AccessLevelTypeCurrentWrite != 0
+	switch {
+	case r && w:
+		return "read/write"
+	case r:
+		return "read"
+	case w:
+		return "write"
+	}
+	return ""
+}
@@ -4,20 +4,64 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
+	"sync"
 	"time"
 
+	"github.com/MrBoggi/goTOV/internal/audit"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/metrics"
 	"github.com/gopcua/opcua"
 	"github.com/gopcua/opcua/ua"
 	"github.com/rs/zerolog"
 )
 
+// ErrNotConnected is returned when no OPC UA session is currently active.
+var ErrNotConnected = errors.New("not connected to OPC UA server")
+
+// dialTimeout bounds endpoint discovery and session setup.
+const dialTimeout = 15 * time.Second
+
+// ConnectionState describes the supervised OPC UA connection.
+type ConnectionState string
+
+const (
+	StateConnecting   ConnectionState = "connecting"
+	StateConnected    ConnectionState = "connected"
+	StateReconnecting ConnectionState = "reconnecting"
+	StateClosed       ConnectionState = "closed"
+)
+
 // Client wraps the underlying gopcua.Client with logging and helper methods.
+// The underlying connection is replaced on every reconnect, so always go
+// through session() instead of holding on to it.
 type Client struct {
-	conn         *opcua.Client
-	log          zerolog.Logger
-	Updates      chan TagUpdate    // 👈 internal event channel for tag updates
-	displayNames map[string]string // 🔧 cache of NodeID → DisplayName
+	endpoint string
+	username string
+	password string
+	log      zerolog.Logger
+	Updates  chan TagUpdate // 👈 internal event channel for tag updates
+	tags     *TagMap
+	security *security
+
+	// Backoff between reconnect attempts
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// Optional audit log for writes (nil = no audit)
+	audit *audit.Log
+
+	// Latest subscribed value per node ID, used as "old value" in the audit log
+	lastMu sync.RWMutex
+	last   map[string]interface{}
+
+	// DataType per node ID, read on first write (see dataType)
+	typesMu sync.Mutex
+	types   map[string]ua.TypeID
+
+	mu        sync.RWMutex
+	conn      *opcua.Client
+	state     ConnectionState
+	listeners []func(ConnectionState)
 }
 
 // TagUpdate represents a single OPC UA value update
@@ -26,134 +70,306 @@ type TagUpdate struct {
 	DisplayName string      `json:"display_name"`
 	Value       interface{} `json:"value"`
 	Type        string      `json:"type"`
+	Unit        string      `json:"unit,omitempty"`
+	Role        string      `json:"role,omitempty"`
+	Time        time.Time   `json:"time"` // kildens tidsstempel, ellers når vi mottok verdien
+}
+
+// NewClient creates an OPC UA client from the opcua section in config.yaml.
+// Certificates are loaded (or generated on first run) here, but no
+// connection is made until Connect or Run is called.
+func NewClient(cfg config.OPCUAConfig, tags *TagMap, log zerolog.Logger) (*Client, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("missing OPC UA endpoint")
+	}
+
+	minBackoff, err := time.ParseDuration(cfg.Reconnect.MinBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reconnect.min_backoff %q: %w", cfg.Reconnect.MinBackoff, err)
+	}
+	maxBackoff, err := time.ParseDuration(cfg.Reconnect.MaxBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reconnect.max_backoff %q: %w", cfg.Reconnect.MaxBackoff, err)
+	}
+	if minBackoff <= 0 || maxBackoff < minBackoff {
+		return nil, fmt.Errorf("invalid reconnect backoff %s..%s", minBackoff, maxBackoff)
+	}
+
+	sec, err := newSecurity(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("opcua security: %w", err)
+	}
+
+	reportState(StateClosed)
+	return &Client{
+		endpoint:   cfg.Endpoint,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		log:        log,
+		Updates:    make(chan TagUpdate, 100),
+		tags:       tags,
+		security:   sec,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		state:      StateClosed,
+		types:      make(map[string]ua.TypeID),
+		last:       make(map[string]interface{}),
+	}, nil
+}
+
+// SetAudit records all writes in l.
+func (c *Client) SetAudit(l *audit.Log) {
+	c.audit = l
+}
+
+// LastValue returns the latest subscribed value of a node.
+func (c *Client) LastValue(nodeID string) (interface{}, bool) {
+	c.lastMu.RLock()
+	defer c.lastMu.RUnlock()
+	v, ok := c.last[nodeID]
+	return v, ok
+}
+
+// Tags returns the configured tag map.
+func (c *Client) Tags() *TagMap {
+	return c.tags
+}
+
+// State returns the current connection state.
+func (c *Client) State() ConnectionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
 }
 
-// NewClient creates an OPC UA client supporting both Anonymous and Username/Password authentication.
-func NewClient(endpoint, username, password string, log zerolog.Logger) (*Client, error) {
-	ctx := context.Background()
+// OnStateChange registers a callback for connection state changes.
+func (c *Client) OnStateChange(fn func(ConnectionState)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+func (c *Client) setState(s ConnectionState) {
+	c.mu.Lock()
+	if c.state == s {
+		c.mu.Unlock()
+		return
+	}
+	c.state = s
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	reportState(s)
+	c.log.Info().Str("state", string(s)).Msg("🔌 OPC UA connection state changed")
+	for _, fn := range listeners {
+		fn(s)
+	}
+}
+
+// reportState updates the gotov_opcua_connection_state metric.
+func reportState(s ConnectionState) {
+	metrics.SetConnectionState(string(s),
+		string(StateConnecting), string(StateConnected), string(StateReconnecting), string(StateClosed))
+}
+
+// dial discovers endpoints and opens a new session. stateCh receives the
+// low-level gopcua state changes for the new connection.
+func (c *Client) dial(ctx context.Context, stateCh chan<- opcua.ConnState) (*opcua.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
 
 	// --- Discover endpoints ---
-	endpoints, err := opcua.GetEndpoints(ctx, endpoint)
+	endpoints, err := opcua.GetEndpoints(ctx, c.endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("get endpoints: %w", err)
 	}
 
-	// --- Prefer SecurityPolicy=None for Beckhoff PLCs (simple setups) ---
-	ep, err := opcua.SelectEndpoint(endpoints, "None", ua.MessageSecurityModeFromString("None"))
+	// --- Pick the endpoint matching the configured policy and mode ---
+	sec := c.security
+	ep, err := opcua.SelectEndpoint(endpoints, sec.policy, sec.mode)
 	if err != nil {
 		return nil, fmt.Errorf("select endpoint: %w", err)
 	}
+	if err := sec.verifyServer(ep.ServerCertificate, c.log); err != nil {
+		return nil, err
+	}
 
-	// --- Choose user token type based on credentials ---
-	var userToken ua.UserTokenType
-	if username != "" {
-		userToken = ua.UserTokenTypeUserName
-	} else {
-		userToken = ua.UserTokenTypeAnonymous
+	userToken := sec.userTokenType()
+	if !offersToken(ep, userToken) {
+		return nil, fmt.Errorf("endpoint %s does not accept %s authentication", ep.SecurityPolicyURI, sec.auth)
 	}
 
 	// --- Build options ---
+	// gopcua's own reconnect gives up on ECONNREFUSED (PLC rebooting), so we
+	// disable it and supervise the connection ourselves in Run.
 	opts := []opcua.Option{
-		opcua.SecurityPolicy("None"),
-		opcua.SecurityModeString("None"),
-		opcua.SecurityMode(ua.MessageSecurityModeNone),
 		opcua.SecurityFromEndpoint(ep, userToken),
-		opcua.ApplicationName("goTOV"),
-		opcua.ApplicationURI("urn:gotov:opcua:client"),
-		opcua.ProductURI("urn:gotov:product"),
+		opcua.ApplicationName(applicationName),
+		opcua.ApplicationURI(applicationURI),
+		opcua.ProductURI(productURI),
+		opcua.AutoReconnect(false),
+	}
+	if sec.cert != nil {
+		opts = append(opts, opcua.Certificate(sec.cert), opcua.PrivateKey(sec.key))
+	}
+	if stateCh != nil {
+		opts = append(opts, opcua.StateChangedCh(stateCh))
 	}
 
 	// --- Add authentication ---
-	if username != "" {
-		log.Info().Msgf("🔐 Using username authentication for OPC UA user '%s'", username)
-		opts = append(opts, opcua.AuthUsername(username, password))
-	} else {
-		log.Info().Msg("🕶 Using anonymous authentication (no credentials)")
+	switch sec.auth {
+	case "username":
+		c.log.Debug().Msgf("🔐 Using username authentication for OPC UA user '%s'", c.username)
+		opts = append(opts, opcua.AuthUsername(c.username, c.password))
+	case "certificate":
+		c.log.Debug().Msg("🔐 Using X.509 certificate authentication")
+		opts = append(opts, opcua.AuthCertificate(sec.userCert), opcua.AuthPrivateKey(sec.userKey))
+	default:
+		c.log.Debug().Msg("🕶 Using anonymous authentication (no credentials)")
 		opts = append(opts, opcua.AuthAnonymous())
 	}
 
 	// --- Create client ---
-	c, err := opcua.NewClient(endpoint, opts...)
+	conn, err := opcua.NewClient(c.endpoint, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("create client: %w", err)
 	}
+	if err := conn.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("connect failed: %w", err)
+	}
+	return conn, nil
+}
 
-	return &Client{
-		conn:         c,
-		log:          log,
-		Updates:      make(chan TagUpdate, 100),
-		displayNames: make(map[string]string), // 🔧 initialize here
-	}, nil
+// offersToken reports whether the endpoint accepts the given user token type.
+func offersToken(ep *ua.EndpointDescription, t ua.UserTokenType) bool {
+	for _, p := range ep.UserIdentityTokens {
+		if p.TokenType == t {
+			return true
+		}
+	}
+	return false
 }
 
-// Connect establishes the OPC UA session.
+// Connect establishes a single, unsupervised OPC UA session.
+// Use Run for long-lived connections.
 func (c *Client) Connect() error {
 	c.log.Info().Msg("Connecting to OPC UA server...")
-	if err := c.conn.Connect(context.Background()); err != nil {
-		return fmt.Errorf("connect failed: %w", err)
+	c.setState(StateConnecting)
+
+	conn, err := c.dial(context.Background(), nil)
+	if err != nil {
+		c.setState(StateClosed)
+		return err
 	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	c.setState(StateConnected)
 	c.log.Info().Msg("✅ Connected to OPC UA server")
 	return nil
 }
 
-// Close terminates the session gracefully.
-func (c *Client) Close() error {
-	c.log.Info().Msg("Closing OPC UA connection...")
-	return c.conn.Close(context.Background())
-}
-
-// ReadNodeValue reads a single node value and returns the raw value (interface{}).
-func (c *Client) ReadNodeValue(ctx context.Context, nodeID string) (interface{}, error) {
-	id, err := ua.ParseNodeID(nodeID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid node id: %w", err)
+// Run keeps a session open and all configured tags subscribed until ctx is
+// cancelled. Lost connections are re-established with exponential backoff
+// and the monitored items are re-created on the new session.
+func (c *Client) Run(ctx context.Context) error {
+	tags := c.tags.All()
+	if len(tags) == 0 {
+		return fmt.Errorf("no tags to subscribe")
 	}
 
-	req := &ua.ReadRequest{
-		MaxAge: 2000,
-		NodesToRead: []*ua.ReadValueID{
-			{NodeID: id},
-		},
-		TimestampsToReturn: ua.TimestampsToReturnBoth,
-	}
+	backoff := c.minBackoff
+	c.setState(StateConnecting)
 
-	var resp *ua.ReadResponse
 	for {
-		resp, err = c.conn.Read(ctx, req)
-		if err == nil {
-			break
+		connected, err := c.runSession(ctx, tags)
+		if ctx.Err() != nil {
+			c.setState(StateClosed)
+			return nil
 		}
 
-		switch {
-		case errors.Is(err, io.EOF) && c.conn.State() != opcua.Closed:
-			time.Sleep(time.Second)
-			continue
-		case errors.Is(err, ua.StatusBadSessionIDInvalid),
-			errors.Is(err, ua.StatusBadSessionNotActivated),
-			errors.Is(err, ua.StatusBadSecureChannelIDInvalid):
-			time.Sleep(time.Second)
-			continue
-		default:
-			return nil, fmt.Errorf("read failed: %w", err)
+		if connected {
+			backoff = c.minBackoff
 		}
-	}
+		c.setState(StateReconnecting)
+		c.log.Warn().Err(err).Dur("retry_in", backoff).Msg("⚠️ OPC UA session lost, reconnecting")
 
-	if resp == nil || len(resp.Results) == 0 {
-		return nil, fmt.Errorf("no response or empty results")
+		select {
+		case <-ctx.Done():
+			c.setState(StateClosed)
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.maxBackoff)
 	}
-	if resp.Results[0].Status != ua.StatusOK {
-		return nil, fmt.Errorf("status not OK: %v", resp.Results[0].Status)
+}
+
+// runSession dials, subscribes and blocks until the session fails or ctx ends.
+// connected reports whether a session was established at all.
+func (c *Client) runSession(ctx context.Context, tags []*Tag) (connected bool, err error) {
+	stateCh := make(chan opcua.ConnState, 8)
+	conn, err := c.dial(ctx, stateCh)
+	if err != nil {
+		return false, err
 	}
 
-	val := resp.Results[0].Value.Value()
-	if val == nil {
-		return nil, fmt.Errorf("value is nil")
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	// Programmet i PLS-en kan ha blitt lastet ned på nytt; les typene igjen
+	c.typesMu.Lock()
+	clear(c.types)
+	c.typesMu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		_ = conn.Close(context.Background())
+	}()
+
+	c.setState(StateConnected)
+	c.log.Info().Msg("✅ Connected to OPC UA server")
+
+	return true, c.subscribe(ctx, conn, tags, stateCh)
+}
+
+// session returns the currently active connection.
+func (c *Client) session() (*opcua.Client, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conn == nil || c.state != StateConnected {
+		return nil, ErrNotConnected
 	}
+	return c.conn, nil
+}
 
-	return val, nil
+// Close terminates the session gracefully.
+func (c *Client) Close() error {
+	c.log.Info().Msg("Closing OPC UA connection...")
+
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	c.setState(StateClosed)
+	if conn == nil {
+		return nil
+	}
+	return conn.Close(context.Background())
 }
 
-// 🔧 Utility: store display names for later use
-func (c *Client) SetDisplayName(nodeID, name string) {
-	c.displayNames[nodeID] = name
+// ReadNodeValue reads a single node value and returns the raw value (interface{}).
+func (c *Client) ReadNodeValue(ctx context.Context, nodeID string) (interface{}, error) {
+	results, err := c.ReadNodeValues(ctx, []string{nodeID})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Err != nil {
+		return nil, results[0].Err
+	}
+	return results[0].Value, nil
 }
@@ -0,0 +1,219 @@
+package opcua
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// typeNames maps data_type in config.yaml (IEC 61131-3 and Go names) to OPC UA built-in types.
+var typeNames = map[string]ua.TypeID{
+	"bool":    ua.TypeIDBoolean,
+	"boolean": ua.TypeIDBoolean,
+	"sint":    ua.TypeIDSByte,
+	"int8":    ua.TypeIDSByte,
+	"usint":   ua.TypeIDByte,
+	"byte":    ua.TypeIDByte,
+	"uint8":   ua.TypeIDByte,
+	"int":     ua.TypeIDInt16,
+	"int16":   ua.TypeIDInt16,
+	"uint":    ua.TypeIDUint16,
+	"word":    ua.TypeIDUint16,
+	"uint16":  ua.TypeIDUint16,
+	"dint":    ua.TypeIDInt32,
+	"int32":   ua.TypeIDInt32,
+	"udint":   ua.TypeIDUint32,
+	"dword":   ua.TypeIDUint32,
+	"uint32":  ua.TypeIDUint32,
+	"lint":    ua.TypeIDInt64,
+	"int64":   ua.TypeIDInt64,
+	"ulint":   ua.TypeIDUint64,
+	"lword":   ua.TypeIDUint64,
+	"uint64":  ua.TypeIDUint64,
+	"real":    ua.TypeIDFloat,
+	"float":   ua.TypeIDFloat,
+	"float32": ua.TypeIDFloat,
+	"lreal":   ua.TypeIDDouble,
+	"double":  ua.TypeIDDouble,
+	"float64": ua.TypeIDDouble,
+	"string":  ua.TypeIDString,
+}
+
+// TypeIDByName returns the built-in type for a data_type name from config.yaml.
+func TypeIDByName(name string) (ua.TypeID, bool) {
+	id, ok := typeNames[strings.ToLower(name)]
+	return id, ok
+}
+
+// typeName gir "Int16" i stedet for "TypeIDInt16".
+func typeName(typ ua.TypeID) string {
+	return strings.TrimPrefix(typ.String(), "TypeID")
+}
+
+// configTypeName gir navnet data_type bruker i config.yaml for en built-in type.
+func configTypeName(typ ua.TypeID) string {
+	switch typ {
+	case ua.TypeIDBoolean:
+		return "bool"
+	case ua.TypeIDSByte:
+		return "int8"
+	case ua.TypeIDByte:
+		return "uint8"
+	}
+	return strings.ToLower(typeName(typ))
+}
+
+// builtinType converts a DataType node ID (ns=0;i=1..12) to a TypeID we can coerce to.
+func builtinType(id *ua.NodeID) (ua.TypeID, bool) {
+	if id == nil || id.Namespace() != 0 {
+		return 0, false
+	}
+	t := ua.TypeID(id.IntID())
+	if t >= ua.TypeIDBoolean && t <= ua.TypeIDString {
+		return t, true
+	}
+	return 0, false
+}
+
+// Coerce converts a decoded JSON/MQTT value to the Go type gopcua encodes as typ.
+func Coerce(value interface{}, typ ua.TypeID) (interface{}, error) {
+	if typ == ua.TypeIDBoolean {
+		return toBool(value)
+	}
+	if typ == ua.TypeIDString {
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(value), nil
+	}
+
+	f, err := toNumber(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case ua.TypeIDFloat:
+		if math.Abs(f) > math.MaxFloat32 {
+			return nil, fmt.Errorf("%w: %g does not fit in Float", ErrInvalidValue, f)
+		}
+		return float32(f), nil
+	case ua.TypeIDDouble:
+		return f, nil
+	}
+
+	if f != math.Trunc(f) {
+		return nil, fmt.Errorf("%w: %g is not an integer", ErrInvalidValue, f)
+	}
+	lo, hi := intRange(typ)
+	if f < lo || f >= hi {
+		return nil, fmt.Errorf("%w: %g is outside %s range [%g, %g)", ErrInvalidValue, f, typeName(typ), lo, hi)
+	}
+
+	switch typ {
+	case ua.TypeIDSByte:
+		return int8(f), nil
+	case ua.TypeIDByte:
+		return uint8(f), nil
+	case ua.TypeIDInt16:
+		return int16(f), nil
+	case ua.TypeIDUint16:
+		return uint16(f), nil
+	case ua.TypeIDInt32:
+		return int32(f), nil
+	case ua.TypeIDUint32:
+		return uint32(f), nil
+	case ua.TypeIDInt64:
+		return int64(f), nil
+	default:
+		return uint64(f), nil
+	}
+}
+
+// intRange gir [lo, hi) for heltallstypen. Øvre grense er eksklusiv fordi
+// MaxInt64 og MaxUint64 ikke kan representeres som float64: de rundes opp til
+// 2^63 og 2^64, som ville flyte over ved konvertering.
+func intRange(typ ua.TypeID) (lo, hi float64) {
+	switch typ {
+	case ua.TypeIDSByte:
+		return math.MinInt8, math.MaxInt8 + 1
+	case ua.TypeIDByte:
+		return 0, math.MaxUint8 + 1
+	case ua.TypeIDInt16:
+		return math.MinInt16, math.MaxInt16 + 1
+	case ua.TypeIDUint16:
+		return 0, math.MaxUint16 + 1
+	case ua.TypeIDInt32:
+		return math.MinInt32, math.MaxInt32 + 1
+	case ua.TypeIDUint32:
+		return 0, math.MaxUint32 + 1
+	case ua.TypeIDInt64:
+		return math.MinInt64, 1 << 63
+	default:
+		return 0, 1 << 64
+	}
+}
+
+// toBool godtar true/false, 0/1 og "on"/"off".
+func toBool(v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(x)) {
+		case "true", "1", "on":
+			return true, nil
+		case "false", "0", "off":
+			return false, nil
+		}
+	default:
+		if f, err := toNumber(v); err == nil && (f == 0 || f == 1) {
+			return f == 1, nil
+		}
+	}
+	return false, fmt.Errorf("%w: %v is not a boolean (use true/false or 0/1)", ErrInvalidValue, v)
+}
+
+// toNumber avviser NaN og ±Inf, som ellers ville sluppet gjennom min/max
+// (alle sammenligninger med NaN er false).
+func toNumber(v interface{}) (float64, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%w: %v is not a finite number", ErrInvalidValue, v)
+	}
+	return f, nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case int:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case json.Number:
+		if f, err := x.Float64(); err == nil {
+			return f, nil
+		}
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+			return f, nil
+		}
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%w: %v (%T) is not a number", ErrInvalidValue, v, v)
+}
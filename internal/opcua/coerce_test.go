@@ -0,0 +1,95 @@
+package opcua
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		typ   ua.TypeID
+		want  interface{}
+	}{
+		{"bool", true, ua.TypeIDBoolean, true},
+		{"bool from 0", 0.0, ua.TypeIDBoolean, false},
+		{"bool from on", "on", ua.TypeIDBoolean, true},
+		{"int16 from bool", true, ua.TypeIDInt16, int16(1)},
+		{"int16 from float", 42.0, ua.TypeIDInt16, int16(42)},
+		{"int16 from string", " -7 ", ua.TypeIDInt16, int16(-7)},
+		{"int16 from json.Number", json.Number("300"), ua.TypeIDInt16, int16(300)},
+		{"byte max", 255.0, ua.TypeIDByte, uint8(255)},
+		{"sbyte min", -128.0, ua.TypeIDSByte, int8(-128)},
+		{"uint32 max", float64(math.MaxUint32), ua.TypeIDUint32, uint32(math.MaxUint32)},
+		{"int64", float64(1 << 53), ua.TypeIDInt64, int64(1 << 53)},
+		{"float", 18.5, ua.TypeIDFloat, float32(18.5)},
+		{"double", 18.25, ua.TypeIDDouble, 18.25},
+		{"string", 12.5, ua.TypeIDString, "12.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Coerce(tt.value, tt.typ)
+			if err != nil {
+				t.Fatalf("Coerce(%v, %s): %v", tt.value, typeName(tt.typ), err)
+			}
+			if got != tt.want {
+				t.Errorf("Coerce(%v, %s) = %v (%T), want %v (%T)", tt.value, typeName(tt.typ), got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoerceRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		typ   ua.TypeID
+	}{
+		{"bool from 2", 2.0, ua.TypeIDBoolean},
+		{"bool from text", "maybe", ua.TypeIDBoolean},
+		{"fraction", 1.5, ua.TypeIDInt16},
+		{"int16 overflow", 32768.0, ua.TypeIDInt16},
+		{"byte negative", -1.0, ua.TypeIDByte},
+		{"uint32 overflow", float64(math.MaxUint32) + 1, ua.TypeIDUint32},
+		// MaxInt64/MaxUint64 rundes til 2^63/2^64 som float64
+		{"int64 2^63", math.Pow(2, 63), ua.TypeIDInt64},
+		{"uint64 2^64", math.Pow(2, 64), ua.TypeIDUint64},
+		{"float overflow", math.MaxFloat64, ua.TypeIDFloat},
+		{"NaN", math.NaN(), ua.TypeIDDouble},
+		{"NaN string", "NaN", ua.TypeIDInt32},
+		{"Inf", math.Inf(1), ua.TypeIDFloat},
+		{"-Inf string", "-Inf", ua.TypeIDUint64},
+		{"not a number", "warm", ua.TypeIDDouble},
+		{"unsupported type", []int{1}, ua.TypeIDInt16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Coerce(tt.value, tt.typ)
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("Coerce(%v, %s) = %v, %v; want ErrInvalidValue", tt.value, typeName(tt.typ), got, err)
+			}
+		})
+	}
+}
+
+func TestTypeIDByName(t *testing.T) {
+	for name, want := range map[string]ua.TypeID{
+		"BOOL":  ua.TypeIDBoolean,
+		"int":   ua.TypeIDInt16,
+		"DINT":  ua.TypeIDInt32,
+		"REAL":  ua.TypeIDFloat,
+		"lreal": ua.TypeIDDouble,
+	} {
+		if got, ok := TypeIDByName(name); !ok || got != want {
+			t.Errorf("TypeIDByName(%q) = %s, %v; want %s", name, typeName(got), ok, typeName(want))
+		}
+	}
+	if _, ok := TypeIDByName("decimal"); ok {
+		t.Error(`TypeIDByName("decimal") should not be known`)
+	}
+}
@@ -0,0 +1,350 @@
+package opcua
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/gopcua/opcua/ua"
+	"github.com/rs/zerolog"
+)
+
+const (
+	applicationName = "goTOV"
+	applicationURI  = "urn:gotov:opcua:client"
+	productURI      = "urn:gotov:product"
+
+	// Self-signed client certificates are valid for ten years.
+	certificateLifetime = 10 * 365 * 24 * time.Hour
+)
+
+// ErrUntrustedServer is returned when the server certificate is not in the
+// trust store.
+var ErrUntrustedServer = errors.New("untrusted OPC UA server certificate")
+
+// security is the resolved security setup for a client.
+type security struct {
+	policy string // full policy URI
+	mode   ua.MessageSecurityMode
+	auth   string
+
+	cert []byte // client certificate (DER)
+	key  *rsa.PrivateKey
+
+	userCert []byte // X.509 user token (DER)
+	userKey  *rsa.PrivateKey
+
+	trustedDir  string
+	rejectedDir string
+	autoAccept  bool
+}
+
+// newSecurity validates the security section and loads (or creates) the
+// certificates it needs.
+func newSecurity(cfg config.OPCUAConfig, log zerolog.Logger) (*security, error) {
+	sc := cfg.Security
+
+	policy, err := policyURI(sc.Policy)
+	if err != nil {
+		return nil, err
+	}
+	mode := ua.MessageSecurityModeFromString(sc.Mode)
+	if mode == ua.MessageSecurityModeInvalid {
+		return nil, fmt.Errorf("invalid security mode %q (None, Sign or SignAndEncrypt)", sc.Mode)
+	}
+	if (policy == ua.SecurityPolicyURINone) != (mode == ua.MessageSecurityModeNone) {
+		return nil, fmt.Errorf("security policy %q cannot be combined with mode %q", sc.Policy, sc.Mode)
+	}
+
+	s := &security{
+		policy:      policy,
+		mode:        mode,
+		auth:        cfg.Auth,
+		trustedDir:  sc.TrustedDir,
+		rejectedDir: sc.RejectedDir,
+		autoAccept:  sc.AutoAcceptServer,
+	}
+
+	switch s.auth {
+	case "anonymous", "username", "certificate":
+	default:
+		return nil, fmt.Errorf("invalid auth %q (anonymous, username or certificate)", s.auth)
+	}
+	if s.auth == "username" && cfg.Username == "" {
+		return nil, fmt.Errorf("auth username requires opcua.username")
+	}
+
+	// The client certificate is only needed for a secure channel or as the
+	// default user certificate.
+	if policy != ua.SecurityPolicyURINone || (s.auth == "certificate" && cfg.UserCertificate == "") {
+		s.cert, s.key, err = loadOrCreateCertificate(sc.Certificate, sc.PrivateKey, log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.auth == "certificate" {
+		if cfg.UserCertificate == "" {
+			s.userCert, s.userKey = s.cert, s.key
+		} else {
+			s.userCert, s.userKey, err = loadCertificate(cfg.UserCertificate, cfg.UserPrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("user certificate: %w", err)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// userTokenType returns the token type to pick from the endpoint.
+func (s *security) userTokenType() ua.UserTokenType {
+	switch s.auth {
+	case "username":
+		return ua.UserTokenTypeUserName
+	case "certificate":
+		return ua.UserTokenTypeCertificate
+	default:
+		return ua.UserTokenTypeAnonymous
+	}
+}
+
+// policyURI accepts both short names ("Basic256Sha256") and full URIs.
+func policyURI(name string) (string, error) {
+	switch strings.ReplaceAll(name, "_", "") {
+	case "", "None", ua.SecurityPolicyURINone:
+		return ua.SecurityPolicyURINone, nil
+	case "Basic256Sha256", ua.SecurityPolicyURIBasic256Sha256:
+		return ua.SecurityPolicyURIBasic256Sha256, nil
+	case "Aes128Sha256RsaOaep", strings.ReplaceAll(ua.SecurityPolicyURIAes128Sha256RsaOaep, "_", ""):
+		return ua.SecurityPolicyURIAes128Sha256RsaOaep, nil
+	default:
+		return "", fmt.Errorf("unsupported security policy %q (None, Basic256Sha256 or Aes128_Sha256_RsaOaep)", name)
+	}
+}
+
+// loadOrCreateCertificate loads the client certificate, creating a
+// self-signed one when neither file exists yet.
+func loadOrCreateCertificate(certFile, keyFile string, log zerolog.Logger) ([]byte, *rsa.PrivateKey, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		if err := generateCertificate(certFile, keyFile); err != nil {
+			return nil, nil, fmt.Errorf("generate client certificate: %w", err)
+		}
+		log.Info().Str("certificate", certFile).Msg("🔏 Generated self-signed OPC UA client certificate")
+	}
+	return loadCertificate(certFile, keyFile)
+}
+
+// generateCertificate writes a self-signed RSA certificate and key as PEM.
+// The URI SAN must match the ApplicationURI we present to the server.
+func generateCertificate(certFile, keyFile string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	uri, err := url.Parse(applicationURI)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+
+	notBefore := time.Now().Add(-time.Hour)
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   applicationName,
+			Organization: []string{applicationName},
+		},
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(certificateLifetime),
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+			x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{uri},
+	}
+	if host != "" {
+		tmpl.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600)
+}
+
+// loadCertificate reads a certificate and RSA key, PEM or DER encoded.
+func loadCertificate(certFile, keyFile string) ([]byte, *rsa.PrivateKey, error) {
+	certData, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := parseCertificate(certData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", certFile, err)
+	}
+
+	keyData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block, _ := pem.Decode(keyData); block != nil {
+		keyData = block.Bytes
+	}
+
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS1PrivateKey(keyData); err == nil {
+		key = k
+	} else if k, err := x509.ParsePKCS8PrivateKey(keyData); err == nil {
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: not an RSA key", keyFile)
+		}
+		key = rk
+	} else {
+		return nil, nil, fmt.Errorf("%s: unsupported private key format", keyFile)
+	}
+
+	return cert.Raw, key, nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+// verifyServer checks the server certificate against the trust store.
+// Unknown certificates are either trusted on first use or written to the
+// rejected directory so an operator can move them to trusted.
+func (s *security) verifyServer(der []byte, log zerolog.Logger) error {
+	if s.policy == ua.SecurityPolicyURINone {
+		return nil
+	}
+	if len(der) == 0 {
+		return fmt.Errorf("%w: server sent no certificate", ErrUntrustedServer)
+	}
+
+	cert, err := parseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("parse server certificate: %w", err)
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: %q is not valid until %s / expired %s",
+			ErrUntrustedServer, cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+	}
+
+	trusted, err := s.isTrusted(cert.Raw)
+	if err != nil {
+		return err
+	}
+	if trusted {
+		return nil
+	}
+
+	thumb := thumbprint(cert.Raw)
+	file := fmt.Sprintf("%s-%s.der", safeName(cert.Subject.CommonName), thumb)
+
+	if s.autoAccept {
+		if err := writeCert(s.trustedDir, file, cert.Raw); err != nil {
+			return fmt.Errorf("trust server certificate: %w", err)
+		}
+		log.Warn().Str("subject", cert.Subject.CommonName).Str("thumbprint", thumb).Msg("⚠️ Trusting OPC UA server certificate on first use")
+		return nil
+	}
+
+	if err := writeCert(s.rejectedDir, file, cert.Raw); err != nil {
+		log.Warn().Err(err).Msg("⚠️ Could not store rejected server certificate")
+	}
+	return fmt.Errorf("%w: %q (thumbprint %s) — move %s from %s to %s to trust it",
+		ErrUntrustedServer, cert.Subject.CommonName, thumb, file, s.rejectedDir, s.trustedDir)
+}
+
+// isTrusted reports whether der is one of the certificates in trustedDir.
+func (s *security) isTrusted(der []byte) (bool, error) {
+	entries, err := os.ReadDir(s.trustedDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read trust store: %w", err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.trustedDir, e.Name()))
+		if err != nil {
+			return false, fmt.Errorf("read trust store: %w", err)
+		}
+		cert, err := parseCertificate(data)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(cert.Raw, der) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func writeCert(dir, name string, der []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), der, 0o644)
+}
+
+// thumbprint is the SHA-1 hash OPC UA uses to identify certificates.
+func thumbprint(der []byte) string {
+	sum := sha1.Sum(der)
+	return hex.EncodeToString(sum[:])
+}
+
+func safeName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+	if s == "" {
+		return "server"
+	}
+	return s
+}
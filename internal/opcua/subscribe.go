@@ -2,97 +2,147 @@ package opcua
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/MrBoggi/goTOV/internal/metrics"
 	"github.com/gopcua/opcua"
 	"github.com/gopcua/opcua/ua"
 )
 
-// SubscribeAll subscribes to all provided nodes and pushes updates to c.Updates.
-func (c *Client) SubscribeAll(ctx context.Context, nodes []*ua.NodeID) error {
-	if len(nodes) == 0 {
-		return fmt.Errorf("no nodes to subscribe")
+// subscribe creates a subscription with one monitored item per tag on conn and
+// pushes updates to c.Updates. It blocks until ctx is cancelled or the
+// connection reports that it is no longer usable.
+func (c *Client) subscribe(ctx context.Context, conn *opcua.Client, tags []*Tag, stateCh <-chan opcua.ConnState) error {
+	c.log.Info().Msgf("📡 Subscribing to %d tags...", len(tags))
+
+	// Publish at the fastest sampling interval so no samples are held back
+	interval := time.Second
+	for _, t := range tags {
+		if t.SamplingInterval > 0 && t.SamplingInterval < interval {
+			interval = t.SamplingInterval
+		}
 	}
 
-	c.log.Info().Msgf("📡 Subscribing to %d nodes...", len(nodes))
-
 	ch := make(chan *opcua.PublishNotificationData, 20)
-	params := &opcua.SubscriptionParameters{Interval: time.Second}
+	params := &opcua.SubscriptionParameters{Interval: interval}
 
-	sub, err := c.conn.Subscribe(ctx, params, ch)
+	sub, err := conn.Subscribe(ctx, params, ch)
 	if err != nil {
 		return fmt.Errorf("create subscription failed: %w", err)
 	}
+	defer func() {
+		// avslutt sub når context stoppes eller sesjonen faller
+		_ = sub.Cancel(context.Background())
+		c.log.Info().Msg("🧭 Subscription stopped")
+	}()
 
-	// --- Opprett handle → tag-navn map ---
-	handleMap := make(map[uint32]string)
-	for i, id := range nodes {
+	// --- Opprett handle → tag map ---
+	handleMap := make(map[uint32]*Tag)
+	for i, t := range tags {
 		handle := uint32(i + 1000)
-		handleMap[handle] = id.String()
+		handleMap[handle] = t
 
-		req := opcua.NewMonitoredItemCreateRequestWithDefaults(id, ua.AttributeIDValue, handle)
+		req := opcua.NewMonitoredItemCreateRequestWithDefaults(t.ID(), ua.AttributeIDValue, handle)
+		if t.SamplingInterval > 0 {
+			req.RequestedParameters.SamplingInterval = float64(t.SamplingInterval.Milliseconds())
+		}
 		if _, err := sub.Monitor(ctx, ua.TimestampsToReturnBoth, req); err != nil {
-			c.log.Warn().Err(err).Msgf("⚠️ Failed to monitor %v", id)
+			c.log.Warn().Err(err).Msgf("⚠️ Failed to monitor %s (%s)", t.Name, t.NodeID)
 		}
 	}
 
-	// --- Les meldinger kontinuerlig ---
-	go func() {
-		defer func() {
-			// avslutt sub når context stoppes eller loop avsluttes
-			_ = sub.Cancel(context.Background())
-			c.log.Info().Msg("🧭 Subscription stopped gracefully")
-		}()
-
-		for {
-			select {
-			case <-ctx.Done():
-				c.log.Info().Msg("🛑 Subscription context cancelled")
-				return
-
-			case n := <-ch:
-				if n == nil || n.Value == nil {
-					continue
+	c.log.Info().Msg("✅ Subscription started")
+
+	// --- Les meldinger til sesjonen faller eller context stoppes ---
+	for {
+		select {
+		case <-ctx.Done():
+			c.log.Info().Msg("🛑 Subscription context cancelled")
+			return nil
+
+		case st := <-stateCh:
+			if st == opcua.Disconnected || st == opcua.Closed {
+				return fmt.Errorf("connection %s", st)
+			}
+
+		case n := <-ch:
+			if n == nil {
+				continue
+			}
+			if n.Error != nil {
+				if isSessionError(n.Error) {
+					return fmt.Errorf("subscription failed: %w", n.Error)
 				}
+				c.log.Warn().Err(n.Error).Msg("⚠️ Subscription notification error")
+				continue
+			}
+			if n.Value == nil {
+				continue
+			}
 
-				switch x := n.Value.(type) {
-				case *ua.DataChangeNotification:
-					for _, item := range x.MonitoredItems {
-						if item.Value == nil || item.Value.Value == nil {
-							continue
-						}
-						val := item.Value.Value.Value()
-						tag := handleMap[item.ClientHandle]
-
-						display := ""
-						if c.displayNames != nil {
-							display = c.displayNames[tag]
-						}
-
-						// Logg til konsoll
-						c.log.Info().Msgf("🔄 %s = %v (%T)", display, val, val)
-
-						// Push til WS via kanal
-						select {
-						case c.Updates <- TagUpdate{
-							Name:        tag,
-							DisplayName: display, // 👈 bruker variabelen
-							Value:       val,
-							Type:        fmt.Sprintf("%T", val),
-						}:
-						default:
-							c.log.Warn().Msg("⚠️ Update channel full, skipping")
-						}
+			switch x := n.Value.(type) {
+			case *ua.DataChangeNotification:
+				for _, item := range x.MonitoredItems {
+					if item.Value == nil || item.Value.Value == nil {
+						continue
+					}
+					val := item.Value.Value.Value()
+					t, ok := handleMap[item.ClientHandle]
+					if !ok {
+						continue
+					}
+					display := t.Name
+					at := item.Value.SourceTimestamp
+					if at.IsZero() {
+						at = time.Now()
+					}
+					c.lastMu.Lock()
+					c.last[t.NodeID] = val
+					c.lastMu.Unlock()
+					metrics.OPCUANotifications.WithLabelValues(display).Inc()
+
+					// Logg til konsoll
+					c.log.Info().Msgf("🔄 %s = %v (%T)", display, val, val)
+
+					// Push til WS via kanal
+					select {
+					case c.Updates <- TagUpdate{
+						Name:        t.NodeID,
+						DisplayName: display, // 👈 bruker variabelen
+						Value:       val,
+						Type:        fmt.Sprintf("%T", val),
+						Unit:        t.Unit,
+						Role:        t.Role,
+						Time:        at,
+					}:
+					default:
+						metrics.OPCUADroppedUpdates.Inc()
+						c.log.Warn().Msg("⚠️ Update channel full, skipping")
 					}
 				}
 			}
 		}
-	}()
-
-	c.log.Info().Msg("✅ Subscription started (Ctrl+C to stop)")
+	}
+}
 
-	// Blocker til context kanselleres
-	<-ctx.Done()
-	return nil
+// isSessionError reports errors that mean the session or subscription is gone
+// and must be re-created.
+func isSessionError(err error) bool {
+	for _, code := range []ua.StatusCode{
+		ua.StatusBadSessionIDInvalid,
+		ua.StatusBadSessionClosed,
+		ua.StatusBadSessionNotActivated,
+		ua.StatusBadSecureChannelIDInvalid,
+		ua.StatusBadSecureChannelClosed,
+		ua.StatusBadSubscriptionIDInvalid,
+		ua.StatusBadConnectionClosed,
+		ua.StatusBadServerNotConnected,
+	} {
+		if errors.Is(err, code) {
+			return true
+		}
+	}
+	return false
 }
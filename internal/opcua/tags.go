@@ -0,0 +1,134 @@
+package opcua
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/gopcua/opcua/ua"
+)
+
+// Tag is a configured PLC variable.
+type Tag struct {
+	Name             string        `json:"name"`
+	NodeID           string        `json:"node_id"`
+	Unit             string        `json:"unit,omitempty"`
+	DataType         string        `json:"data_type,omitempty"`
+	Role             string        `json:"role,omitempty"`
+	Writable         bool          `json:"writable"`
+	SamplingInterval time.Duration `json:"-"`
+	Deadband         float64       `json:"deadband,omitempty"`
+	HistoryInterval  time.Duration `json:"-"`
+	Min              *float64      `json:"min,omitempty"`
+	Max              *float64      `json:"max,omitempty"`
+	Clamp            bool          `json:"clamp,omitempty"`
+
+	id *ua.NodeID
+}
+
+// ID returns the parsed node ID.
+func (t *Tag) ID() *ua.NodeID {
+	return t.id
+}
+
+// TagMap looks up configured tags by name, node ID or bare symbol.
+type TagMap struct {
+	tags             []*Tag
+	byKey            map[string]*Tag
+	defaultNamespace int
+}
+
+// NewTagMap builds a TagMap from the tags section in config.yaml.
+func NewTagMap(cfgs []config.TagConfig, defaultNamespace int) (*TagMap, error) {
+	m := &TagMap{
+		byKey:            make(map[string]*Tag),
+		defaultNamespace: defaultNamespace,
+	}
+
+	for _, tc := range cfgs {
+		id, err := ua.ParseNodeID(tc.NodeID)
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: invalid node id %q: %w", tc.Name, tc.NodeID, err)
+		}
+
+		interval, err := time.ParseDuration(tc.SamplingInterval)
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: invalid sampling_interval %q: %w", tc.Name, tc.SamplingInterval, err)
+		}
+
+		var historyInterval time.Duration
+		if tc.HistoryInterval != "" {
+			historyInterval, err = time.ParseDuration(tc.HistoryInterval)
+			if err != nil {
+				return nil, fmt.Errorf("tag %q: invalid history_interval %q: %w", tc.Name, tc.HistoryInterval, err)
+			}
+		}
+
+		t := &Tag{
+			Name:             tc.Name,
+			NodeID:           id.String(),
+			Unit:             tc.Unit,
+			DataType:         tc.DataType,
+			Role:             tc.Role,
+			Writable:         tc.Writable,
+			SamplingInterval: interval,
+			Deadband:         tc.Deadband,
+			HistoryInterval:  historyInterval,
+			Min:              tc.Min,
+			Max:              tc.Max,
+			Clamp:            tc.Clamp,
+			id:               id,
+		}
+
+		if t.Min != nil && t.Max != nil && *t.Min > *t.Max {
+			return nil, fmt.Errorf("tag %q: min %g is greater than max %g", t.Name, *t.Min, *t.Max)
+		}
+		if tc.DataType != "" {
+			if _, ok := TypeIDByName(tc.DataType); !ok {
+				return nil, fmt.Errorf("tag %q: unknown data_type %q", t.Name, tc.DataType)
+			}
+		}
+
+		for _, key := range []string{t.Name, t.NodeID, symbol(t.NodeID)} {
+			if other, dup := m.byKey[key]; dup && other != t {
+				return nil, fmt.Errorf("tag %q: %q is already used by tag %q", t.Name, key, other.Name)
+			}
+			m.byKey[key] = t
+		}
+		m.tags = append(m.tags, t)
+	}
+
+	return m, nil
+}
+
+// All returns the tags in config order.
+func (m *TagMap) All() []*Tag {
+	return m.tags
+}
+
+// Lookup finds a tag by name, node ID or bare symbol.
+func (m *TagMap) Lookup(key string) (*Tag, bool) {
+	t, ok := m.byKey[key]
+	return t, ok
+}
+
+// Resolve turns a tag reference into a node ID. Unknown references without
+// "ns=" are placed in the default namespace.
+func (m *TagMap) Resolve(key string) string {
+	if t, ok := m.byKey[key]; ok {
+		return t.NodeID
+	}
+	if strings.HasPrefix(key, "ns=") {
+		return key
+	}
+	return fmt.Sprintf("ns=%d;s=%s", m.defaultNamespace, key)
+}
+
+// symbol strips the namespace from a string node ID ("ns=4;s=MAIN.x" → "MAIN.x").
+func symbol(nodeID string) string {
+	if i := strings.Index(nodeID, ";s="); i >= 0 {
+		return nodeID[i+3:]
+	}
+	return nodeID
+}
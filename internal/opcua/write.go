@@ -2,41 +2,161 @@ package opcua
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/MrBoggi/goTOV/internal/audit"
 	"github.com/gopcua/opcua/ua"
 )
 
-func (c *Client) WriteNodeValue(ctx context.Context, nodeID string, value interface{}) error {
-	id, err := ua.ParseNodeID(nodeID)
+// Feil fra WriteTag. API-et og MQTT mapper dem til 4xx/feilsvar.
+var (
+	ErrUnknownTag   = errors.New("unknown tag")
+	ErrNotWritable  = errors.New("tag is not writable")
+	ErrInvalidValue = errors.New("invalid value")
+	ErrOutOfRange   = errors.New("value out of range")
+)
+
+// WriteResult describes a validated write.
+type WriteResult struct {
+	Tag     string      `json:"tag"`
+	NodeID  string      `json:"node_id"`
+	Value   interface{} `json:"value"` // verdien som ble skrevet, etter konvertering
+	Type    string      `json:"type"`
+	Clamped bool        `json:"clamped,omitempty"`
+}
+
+// WriteTag is the shared write path for the HTTP API and MQTT commands.
+// The tag must be configured and writable; the value is clamped or rejected
+// against min/max and converted to the node's DataType before writing.
+// Every attempt, including rejected ones, is recorded in the audit log.
+func (c *Client) WriteTag(ctx context.Context, key string, value interface{}) (*WriteResult, error) {
+	tag, ok := c.tags.Lookup(key)
+	if !ok {
+		err := fmt.Errorf("%w: %q", ErrUnknownTag, key)
+		c.audit.Record(ctx, audit.ActionTagWrite, key, nil, value, audit.Rejected(err))
+		return nil, err
+	}
+	old, _ := c.LastValue(tag.NodeID)
+
+	res, err := c.validate(ctx, tag, value)
 	if err != nil {
-		return fmt.Errorf("invalid node id: %w", err)
+		if !errors.Is(err, ErrNotConnected) {
+			err = audit.Rejected(err)
+		}
+		c.audit.Record(ctx, audit.ActionTagWrite, tag.Name, old, value, err)
+		return nil, err
+	}
+
+	err = c.writeNode(ctx, tag.NodeID, res.Value)
+	c.audit.Record(ctx, audit.ActionTagWrite, tag.Name, old, res.Value, err)
+	return res, err
+}
+
+// validate sjekker writable og min/max og konverterer verdien til nodens datatype.
+func (c *Client) validate(ctx context.Context, tag *Tag, value interface{}) (*WriteResult, error) {
+	if !tag.Writable {
+		return nil, fmt.Errorf("%w: %q", ErrNotWritable, tag.Name)
 	}
 
-	v, err := ua.NewVariant(value)
+	typ, err := c.dataType(ctx, tag)
 	if err != nil {
-		return fmt.Errorf("invalid value: %w", err)
+		return nil, err
+	}
+
+	res := &WriteResult{Tag: tag.Name, NodeID: tag.NodeID, Type: typeName(typ)}
+	if typ != ua.TypeIDBoolean && typ != ua.TypeIDString && (tag.Min != nil || tag.Max != nil) {
+		f, err := toNumber(value)
+		if err != nil {
+			return nil, err
+		}
+		if f, res.Clamped, err = limit(tag, f); err != nil {
+			return nil, err
+		}
+		value = f
+	}
+
+	if res.Value, err = Coerce(value, typ); err != nil {
+		return nil, fmt.Errorf("tag %q: %w", tag.Name, err)
+	}
+	return res, nil
+}
+
+// limit sjekker min/max og klemmer verdien når taggen har clamp: true.
+func limit(tag *Tag, f float64) (float64, bool, error) {
+	switch {
+	case tag.Min != nil && f < *tag.Min:
+		if tag.Clamp {
+			return *tag.Min, true, nil
+		}
+		return 0, false, fmt.Errorf("%w: %g is below min %g for %q", ErrOutOfRange, f, *tag.Min, tag.Name)
+	case tag.Max != nil && f > *tag.Max:
+		if tag.Clamp {
+			return *tag.Max, true, nil
+		}
+		return 0, false, fmt.Errorf("%w: %g is above max %g for %q", ErrOutOfRange, f, *tag.Max, tag.Name)
 	}
+	return f, false, nil
+}
 
-	req := &ua.WriteRequest{
-		NodesToWrite: []*ua.WriteValue{{
-			NodeID:      id,
-			AttributeID: ua.AttributeIDValue,
-			Value: &ua.DataValue{
-				EncodingMask: ua.DataValueValue,
-				Value:        v,
-			},
-		}},
+// dataType returns the node's built-in DataType. It is read from the server
+// the first time and cached until the next reconnect; if the server reports
+// a non built-in type, data_type from config.yaml is used.
+func (c *Client) dataType(ctx context.Context, tag *Tag) (ua.TypeID, error) {
+	c.typesMu.Lock()
+	typ, ok := c.types[tag.NodeID]
+	c.typesMu.Unlock()
+	if ok {
+		return typ, nil
 	}
 
-	resp, err := c.conn.Write(ctx, req)
+	conn, err := c.session()
+	if err != nil {
+		return 0, err
+	}
+	resp, err := conn.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{{NodeID: tag.ID(), AttributeID: ua.AttributeIDDataType}},
+	})
 	if err != nil {
-		return fmt.Errorf("write failed: %w", err)
+		return 0, fmt.Errorf("read data type of %q: %w", tag.Name, err)
+	}
+	if len(resp.Results) == 0 || resp.Results[0].Status != ua.StatusOK {
+		status := ua.StatusBadUnexpectedError
+		if len(resp.Results) > 0 {
+			status = resp.Results[0].Status
+		}
+		return 0, fmt.Errorf("read data type of %q: %v", tag.Name, status)
+	}
+
+	id, _ := resp.Results[0].Value.Value().(*ua.NodeID)
+	typ, ok = builtinType(id)
+	if !ok {
+		if typ, ok = TypeIDByName(tag.DataType); !ok {
+			return 0, fmt.Errorf("tag %q: server data type %v is not a built-in type; set data_type in config.yaml", tag.Name, id)
+		}
 	}
-	if resp.Results[0] != ua.StatusOK {
-		return fmt.Errorf("write not OK: %v", resp.Results[0])
+
+	c.typesMu.Lock()
+	c.types[tag.NodeID] = typ
+	c.typesMu.Unlock()
+	c.log.Debug().Str("tag", tag.Name).Str("type", typeName(typ)).Msg("🔎 Resolved tag data type")
+	return typ, nil
+}
+
+// WriteNodeValue writes a single value to a node, converted to its DataType
+// but without writable or min/max checks. See WriteNodeValues.
+func (c *Client) WriteNodeValue(ctx context.Context, nodeID string, value interface{}) error {
+	errs, err := c.WriteNodeValues(ctx, []NodeWrite{{NodeID: nodeID, Value: value}})
+	if err != nil {
+		return err
 	}
+	return errs[0]
+}
 
-	c.log.Info().Msgf("✅ Wrote %v to %s", value, nodeID)
-	return nil
+func (c *Client) writeNode(ctx context.Context, nodeID string, value interface{}) error {
+	errs, err := c.writeNodes(ctx, []NodeWrite{{NodeID: nodeID, Value: value}})
+	if err != nil {
+		return err
+	}
+	return errs[0]
 }
@@ -0,0 +1,122 @@
+package simulator
+
+import (
+	"math"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/gopcua/opcua/ua"
+)
+
+// Modellkonstanter. Grovt tilpasset en 50 L tank med glykolkappe: kjølingen
+// tar ~5 °C/t fra 20 °C, varmekappen gir 1,5 °C/t og tanken drar mot
+// romtemperatur med 5 % av forskjellen per time.
+const (
+	ambientLoss  = 0.05  // andel av (rom − tank) per time
+	coolingRate  = 0.3   // andel av (glykol − tank) per time med åpen ventil
+	heaterPower  = 1.5   // °C per time med varmekappe på
+	attenuation  = 0.02  // andel av (SG − FG) som gjæres ut per time ved 18 °C
+	heatPerPoint = 0.1   // °C per gravity-punkt (0.001) som gjæres ut
+	maxStep      = 0.025 // timer; lengre steg deles opp så Euler holder seg stabil
+)
+
+// tank er modelltilstanden til én gjæringstank.
+type tank struct {
+	no          int
+	temperature *node
+	cooling     *node
+	heater      *node
+	gravity     *node
+
+	temp float64 // °C
+	sg   float64 // specific gravity
+}
+
+// Step advances the model by d of simulated time and notifies subscribers
+// of changed values. Start calls it every update_interval with
+// update_interval × speed; tests can call it directly to skip ahead.
+func (s *Simulator) Step(d time.Duration) {
+	hours := d.Hours()
+	if hours <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	steps := int(math.Ceil(hours / maxStep))
+	dt := hours / float64(steps)
+	for _, t := range s.tanks {
+		cooling, heating := isOn(t.cooling), isOn(t.heater)
+		for range steps {
+			t.advance(s, dt, cooling, heating)
+		}
+	}
+	s.mu.Unlock()
+
+	s.publish()
+}
+
+// advance regner ut ett Euler-steg på dt timer.
+func (t *tank) advance(s *Simulator, dt float64, cooling, heating bool) {
+	dT := ambientLoss * (s.cfg.AmbientTemp - t.temp)
+	if cooling {
+		dT += coolingRate * (s.cfg.GlycolTemp - t.temp)
+	}
+	if heating {
+		dT += heaterPower
+	}
+
+	// Gjæringen går dobbelt så fort for hver 10 °C og gir litt varme
+	if t.sg > s.cfg.FinalGravity {
+		rate := attenuation * math.Pow(2, (t.temp-18)/10)
+		dSG := min(rate*(t.sg-s.cfg.FinalGravity)*dt, t.sg-s.cfg.FinalGravity)
+		t.sg -= dSG
+		t.temp += dSG * 1000 * heatPerPoint
+	}
+
+	t.temp += dT * dt
+}
+
+// publish skriver modelltilstanden til nodene og varsler abonnenter om det
+// som er endret.
+func (s *Simulator) publish() {
+	for _, nid := range s.update() {
+		s.srv.ChangeNotification(nid)
+	}
+}
+
+// update skriver modelltilstanden til nodene og gir ID-ene som endret seg.
+func (s *Simulator) update() []*ua.NodeID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []*ua.NodeID
+	for _, t := range s.tanks {
+		if s.set(t.temperature, round(t.temp, 2)) {
+			changed = append(changed, t.temperature.id)
+		}
+		if s.set(t.gravity, round(t.sg, 4)) {
+			changed = append(changed, t.gravity.id)
+		}
+	}
+	if s.set(s.glycol, s.cfg.GlycolTemp) {
+		changed = append(changed, s.glycol.id)
+	}
+	return changed
+}
+
+// isOn tolker en ventil eller varmekappe; tallverdier ≠ 0 regnes som på.
+func isOn(n *node) bool {
+	if n == nil {
+		return false
+	}
+	if b, ok := n.value.(bool); ok {
+		return b
+	}
+	f, ok := brew.ToFloat(n.value)
+	return ok && f != 0
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,225 @@
+package simulator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/server/attrs"
+	"github.com/gopcua/opcua/ua"
+)
+
+// node er ett objekt eller én variabel i det simulerte adresserommet.
+type node struct {
+	id       *ua.NodeID
+	name     string
+	class    ua.NodeClass
+	typ      ua.TypeID // variabler
+	writable bool
+	value    interface{}
+	updated  time.Time
+	children []*node
+}
+
+// namespace implementerer server.NameSpace over simulatorens noder, så
+// verdiene alltid leses fra (og skrives til) modellen under sim.mu.
+// gopcua sin NodeNameSpace blander DataType og TypeDefinition, og klienten
+// vår trenger riktig DataType for å konvertere skrivinger.
+type namespace struct {
+	sim  *Simulator
+	id   uint16
+	name string
+}
+
+func (ns *namespace) Name() string       { return ns.name }
+func (ns *namespace) ID() uint16         { return ns.id }
+func (ns *namespace) SetID(id uint16)    { ns.id = id }
+func (ns *namespace) Root() *server.Node { return ns.Objects() }
+
+// AddNode støttes ikke; adresserommet bygges fra config.
+func (ns *namespace) AddNode(n *server.Node) *server.Node { return n }
+
+func (ns *namespace) Objects() *server.Node {
+	return ns.Node(ua.NewNumericNodeID(ns.id, id.ObjectsFolder))
+}
+
+// Node gir en server.Node med det ns=0 trenger for å referere til noden.
+func (ns *namespace) Node(nid *ua.NodeID) *server.Node {
+	ns.sim.mu.RLock()
+	n, ok := ns.sim.nodes[nid.String()]
+	ns.sim.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return server.NewNode(n.id, map[ua.AttributeID]*ua.DataValue{
+		ua.AttributeIDNodeClass:   server.DataValueFromValue(uint32(n.class)),
+		ua.AttributeIDBrowseName:  server.DataValueFromValue(attrs.BrowseName(n.name)),
+		ua.AttributeIDDisplayName: server.DataValueFromValue(attrs.DisplayName(n.name, "")),
+		// server.Node.DataType brukes som TypeDefinition i referanser
+		ua.AttributeIDDataType: server.DataValueFromValue(ua.NewNumericExpandedNodeID(0, typeDefinition(n.class))),
+	}, nil, nil)
+}
+
+func (ns *namespace) Browse(bd *ua.BrowseDescription) *ua.BrowseResult {
+	ns.sim.mu.RLock()
+	defer ns.sim.mu.RUnlock()
+
+	n, ok := ns.sim.nodes[bd.NodeID.String()]
+	if !ok {
+		return &ua.BrowseResult{StatusCode: ua.StatusBadNodeIDUnknown}
+	}
+	// Bare framover-referanser (HasComponent) finnes
+	if bd.BrowseDirection == ua.BrowseDirectionInverse || !hierarchical(bd.ReferenceTypeID) {
+		return &ua.BrowseResult{StatusCode: ua.StatusOK}
+	}
+
+	refs := make([]*ua.ReferenceDescription, 0, len(n.children))
+	for _, c := range n.children {
+		if bd.NodeClassMask != 0 && bd.NodeClassMask&uint32(c.class) == 0 {
+			continue
+		}
+		refs = append(refs, &ua.ReferenceDescription{
+			ReferenceTypeID: ua.NewNumericNodeID(0, id.HasComponent),
+			IsForward:       true,
+			NodeID:          ua.NewExpandedNodeID(c.id, "", 0),
+			BrowseName:      &ua.QualifiedName{NamespaceIndex: c.id.Namespace(), Name: c.name},
+			DisplayName:     &ua.LocalizedText{EncodingMask: ua.LocalizedTextText, Text: c.name},
+			NodeClass:       c.class,
+			TypeDefinition:  ua.NewNumericExpandedNodeID(0, typeDefinition(c.class)),
+		})
+	}
+	return &ua.BrowseResult{StatusCode: ua.StatusOK, References: refs}
+}
+
+func (ns *namespace) Attribute(nid *ua.NodeID, attr ua.AttributeID) *ua.DataValue {
+	ns.sim.mu.RLock()
+	defer ns.sim.mu.RUnlock()
+
+	dv := &ua.DataValue{
+		EncodingMask:    ua.DataValueServerTimestamp | ua.DataValueStatusCode,
+		ServerTimestamp: time.Now(),
+		Status:          ua.StatusOK,
+	}
+	n, ok := ns.sim.nodes[nid.String()]
+	if !ok {
+		dv.Status = ua.StatusBadNodeIDUnknown
+		return dv
+	}
+
+	var v interface{}
+	switch attr {
+	case ua.AttributeIDNodeID:
+		v = n.id
+	case ua.AttributeIDNodeClass:
+		v = int32(n.class)
+	case ua.AttributeIDBrowseName:
+		v = attrs.BrowseName(n.name)
+	case ua.AttributeIDDisplayName:
+		v = attrs.DisplayName(n.name, "")
+	case ua.AttributeIDDescription:
+		v = &ua.LocalizedText{EncodingMask: ua.LocalizedTextText}
+	case ua.AttributeIDEventNotifier:
+		if n.class != ua.NodeClassObject {
+			dv.Status = ua.StatusBadAttributeIDInvalid
+			return dv
+		}
+		v = byte(0)
+	default:
+		if n.class != ua.NodeClassVariable {
+			dv.Status = ua.StatusBadAttributeIDInvalid
+			return dv
+		}
+		switch attr {
+		case ua.AttributeIDValue:
+			v = n.value
+			dv.EncodingMask |= ua.DataValueSourceTimestamp
+			dv.SourceTimestamp = n.updated
+		case ua.AttributeIDDataType:
+			v = ua.NewNumericNodeID(0, uint32(n.typ))
+		case ua.AttributeIDValueRank:
+			v = int32(-1)
+		case ua.AttributeIDArrayDimensions:
+			v = []uint32{}
+		case ua.AttributeIDAccessLevel, ua.AttributeIDUserAccessLevel:
+			level := ua.AccessLevelTypeCurrentRead
+			if n.writable {
+				level |= ua.AccessLevelTypeCurrentWrite
+			}
+			v = byte(level)
+		case ua.AttributeIDMinimumSamplingInterval:
+			v = float64(0)
+		case ua.AttributeIDHistorizing:
+			v = false
+		default:
+			dv.Status = ua.StatusBadAttributeIDInvalid
+			return dv
+		}
+	}
+
+	variant, err := ua.NewVariant(v)
+	if err != nil {
+		dv.Status = ua.StatusBadInternalError
+		return dv
+	}
+	dv.EncodingMask |= ua.DataValueValue
+	dv.Value = variant
+	return dv
+}
+
+// SetAttribute tar imot skrivinger fra klienter. Bare Value på skrivbare
+// variabler, og verdien må ha nodens datatype – som på PLS-en.
+func (ns *namespace) SetAttribute(nid *ua.NodeID, attr ua.AttributeID, val *ua.DataValue) ua.StatusCode {
+	if attr != ua.AttributeIDValue {
+		return ua.StatusBadNotWritable
+	}
+	if val == nil || val.Value == nil {
+		return ua.StatusBadTypeMismatch
+	}
+
+	ns.sim.mu.Lock()
+	n, ok := ns.sim.nodes[nid.String()]
+	switch {
+	case !ok:
+		ns.sim.mu.Unlock()
+		return ua.StatusBadNodeIDUnknown
+	case n.class != ua.NodeClassVariable || !n.writable:
+		ns.sim.mu.Unlock()
+		return ua.StatusBadNotWritable
+	case val.Value.Type() != n.typ:
+		ns.sim.mu.Unlock()
+		return ua.StatusBadTypeMismatch
+	}
+	n.value, n.updated = val.Value.Value(), time.Now()
+	ns.sim.mu.Unlock()
+
+	ns.sim.log.Debug().Str("node", nid.String()).Msgf("✏️ Client wrote %v", val.Value.Value())
+	ns.sim.srv.ChangeNotification(nid)
+	return ua.StatusOK
+}
+
+// hierarchical sier om en Browse etter refType skal se HasComponent.
+func hierarchical(refType *ua.NodeID) bool {
+	if refType == nil {
+		return true
+	}
+	if refType.Namespace() != 0 {
+		return false
+	}
+	switch refType.IntID() {
+	case 0, id.References, id.HierarchicalReferences, id.HasChild, id.Aggregates, id.HasComponent:
+		return true
+	}
+	return false
+}
+
+func typeDefinition(class ua.NodeClass) uint32 {
+	if class == ua.NodeClassVariable {
+		return id.BaseDataVariableType
+	}
+	return id.FolderType
+}
+
+func namespaceURI(ns uint16) string {
+	return fmt.Sprintf("urn:gotov:simulator:ns%d", ns)
+}
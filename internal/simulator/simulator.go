@@ -0,0 +1,327 @@
+// Package simulator runs a local OPC UA server with the same nodes as the PLC
+// and a simple thermal model of the fermentation tanks, so goTØV can be
+// developed and tested without the brewery hardware.
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/MrBoggi/goTOV/internal/version"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/ua"
+	"github.com/rs/zerolog"
+)
+
+// Simulator is a local OPC UA server exposing every configured tag.
+type Simulator struct {
+	log      zerolog.Logger
+	cfg      config.SimulatorConfig
+	srv      *server.Server
+	interval time.Duration
+
+	mu     sync.RWMutex
+	nodes  map[string]*node // NodeID.String() → node
+	tanks  []*tank
+	glycol *node
+	cancel context.CancelFunc
+}
+
+// New builds the address space from the tag map and tanks. Tags with role
+// temperature that are not a tank or the glycol tag stay at ambient.
+func New(cfg config.SimulatorConfig, tags *opcua.TagMap, tanks []brew.Tank, log zerolog.Logger) (*Simulator, error) {
+	interval, err := time.ParseDuration(cfg.UpdateInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("simulator: invalid update_interval %q", cfg.UpdateInterval)
+	}
+
+	s := &Simulator{
+		log:      log,
+		cfg:      cfg,
+		interval: interval,
+		nodes:    make(map[string]*node),
+		srv: server.New(
+			server.EndPoint(cfg.Host, cfg.Port),
+			server.EnableSecurity("None", ua.MessageSecurityModeNone),
+			server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+			server.ServerName("goTØV simulator"),
+			server.ProductName("goTØV simulator"),
+			server.SoftwareVersion(version.Version),
+			server.SetLogger(serverLogger{log}),
+		),
+	}
+
+	// Aktuatorer i tankene må kunne skrives selv om tagen mangler writable
+	actuators := make(map[string]bool)
+	for _, t := range tanks {
+		actuators[t.Tags.Cooling] = true
+		actuators[t.Tags.Heater] = true
+	}
+
+	for _, tag := range tags.All() {
+		typ, ok := opcua.TypeIDByName(tag.DataType)
+		if !ok {
+			typ = ua.TypeIDFloat // REAL, som temperaturene på PLS-en
+			switch tag.Role {
+			case config.RoleValve, config.RoleHeater, config.RolePump:
+				typ = ua.TypeIDBoolean
+			}
+		}
+		writable := tag.Writable || actuators[tag.NodeID]
+		if _, err := s.addVariable(tag.ID(), typ, writable); err != nil {
+			return nil, fmt.Errorf("simulator: tag %q: %w", tag.Name, err)
+		}
+	}
+
+	for _, t := range tanks {
+		tk := &tank{no: t.No, temp: cfg.InitialTemp, sg: cfg.OriginalGravity}
+		for _, ref := range []struct {
+			dst      **node
+			nodeID   string
+			typ      ua.TypeID
+			writable bool
+		}{
+			{&tk.temperature, t.Tags.Temperature, ua.TypeIDFloat, false},
+			{&tk.cooling, t.Tags.Cooling, ua.TypeIDBoolean, true},
+			{&tk.heater, t.Tags.Heater, ua.TypeIDBoolean, true},
+			{&tk.gravity, t.Tags.Gravity, ua.TypeIDFloat, false},
+		} {
+			if ref.nodeID == "" {
+				continue
+			}
+			if *ref.dst, err = s.ensureVariable(ref.nodeID, ref.typ, ref.writable); err != nil {
+				return nil, fmt.Errorf("simulator: tank %d: %w", t.No, err)
+			}
+		}
+		s.tanks = append(s.tanks, tk)
+	}
+
+	if cfg.GlycolTag != "" {
+		if s.glycol, err = s.ensureVariable(tags.Resolve(cfg.GlycolTag), ua.TypeIDFloat, false); err != nil {
+			return nil, fmt.Errorf("simulator: glycol_tag: %w", err)
+		}
+	}
+
+	if err := s.addNamespaces(); err != nil {
+		return nil, err
+	}
+
+	// Startverdier: andre temperaturer står på romtemperatur
+	for _, tag := range tags.All() {
+		if tag.Role == config.RoleTemperature {
+			s.set(s.nodes[tag.ID().String()], cfg.AmbientTemp)
+		}
+	}
+	s.update() // serveren er ikke startet, så ingen abonnenter å varsle
+	return s, nil
+}
+
+// Start begins listening and runs the model every update_interval until ctx
+// is cancelled or Close is called.
+func (s *Simulator) Start(ctx context.Context) error {
+	if err := s.srv.Start(ctx); err != nil {
+		return fmt.Errorf("simulator: start server: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Step(time.Duration(float64(s.interval) * s.cfg.Speed))
+			}
+		}
+	}()
+
+	s.log.Info().
+		Str("endpoint", s.Endpoint()).
+		Float64("speed", s.cfg.Speed).
+		Int("nodes", len(s.nodes)).
+		Int("tanks", len(s.tanks)).
+		Msg("🧪 OPC UA simulator running")
+	return nil
+}
+
+// Close stops the model and the server.
+func (s *Simulator) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return s.srv.Close()
+}
+
+// Endpoint is the URL clients connect to (opcua.endpoint in config.yaml).
+func (s *Simulator) Endpoint() string {
+	return fmt.Sprintf("opc.tcp://%s:%d", s.cfg.Host, s.cfg.Port)
+}
+
+// Value returns the current value of a node, as a client would read it.
+func (s *Simulator) Value(nodeID string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n, ok := s.nodes[nodeID]
+	if !ok || n.class != ua.NodeClassVariable {
+		return nil, false
+	}
+	return n.value, true
+}
+
+// Set forces a node to a value, e.g. a tank temperature at the start of a
+// test. Setting a tank temperature or gravity also moves the model.
+func (s *Simulator) Set(nodeID string, value interface{}) error {
+	s.mu.Lock()
+	n, ok := s.nodes[nodeID]
+	if !ok || n.class != ua.NodeClassVariable {
+		s.mu.Unlock()
+		return fmt.Errorf("unknown node %q", nodeID)
+	}
+	v, err := opcua.Coerce(value, n.typ)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	n.value, n.updated = v, time.Now()
+	if f, ok := brew.ToFloat(v); ok {
+		for _, t := range s.tanks {
+			switch n {
+			case t.temperature:
+				t.temp = f
+			case t.gravity:
+				t.sg = f
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	s.srv.ChangeNotification(n.id)
+	return nil
+}
+
+// addVariable legger til en variabel og objektene over den. For string-ID-er
+// blir hvert ledd i "MAIN.fbUA.x" et objekt, som i TwinCAT.
+func (s *Simulator) addVariable(nid *ua.NodeID, typ ua.TypeID, writable bool) (*node, error) {
+	if nid.Namespace() == 0 {
+		return nil, fmt.Errorf("node %s is in namespace 0", nid)
+	}
+	if n, ok := s.nodes[nid.String()]; ok {
+		return n, nil
+	}
+
+	parent := s.object(ua.NewNumericNodeID(nid.Namespace(), id.ObjectsFolder), fmt.Sprintf("ns%d", nid.Namespace()), nil)
+	name := nid.String()
+	if nid.Type() == ua.NodeIDTypeString {
+		segments := strings.Split(nid.StringID(), ".")
+		for i := 1; i < len(segments); i++ {
+			oid := ua.NewStringNodeID(nid.Namespace(), strings.Join(segments[:i], "."))
+			parent = s.object(oid, segments[i-1], parent)
+		}
+		name = segments[len(segments)-1]
+	}
+
+	zero, err := opcua.Coerce(0, typ)
+	if err != nil {
+		return nil, err
+	}
+	n := &node{id: nid, name: name, class: ua.NodeClassVariable, typ: typ, writable: writable, value: zero, updated: time.Now()}
+	s.nodes[nid.String()] = n
+	parent.children = append(parent.children, n)
+	return n, nil
+}
+
+// ensureVariable brukes for tank-noder som ikke står i tags:.
+func (s *Simulator) ensureVariable(nodeID string, typ ua.TypeID, writable bool) (*node, error) {
+	nid, err := ua.ParseNodeID(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node id %q: %w", nodeID, err)
+	}
+	n, err := s.addVariable(nid, typ, writable)
+	if err != nil {
+		return nil, err
+	}
+	n.writable = n.writable || writable
+	return n, nil
+}
+
+func (s *Simulator) object(nid *ua.NodeID, name string, parent *node) *node {
+	if n, ok := s.nodes[nid.String()]; ok {
+		return n
+	}
+	n := &node{id: nid, name: name, class: ua.NodeClassObject}
+	s.nodes[nid.String()] = n
+	if parent != nil {
+		parent.children = append(parent.children, n)
+	}
+	return n
+}
+
+// addNamespaces registrerer ns=1..høyeste brukte namespace, så node-ID-ene
+// blir de samme som på PLS-en (TwinCAT bruker ns=4), og henger Objects-mappen
+// i hvert namespace under Objects i ns=0.
+func (s *Simulator) addNamespaces() error {
+	var highest uint16
+	for _, n := range s.nodes {
+		highest = max(highest, n.id.Namespace())
+	}
+
+	root, err := s.srv.Namespace(0)
+	if err != nil {
+		return err
+	}
+	for i := len(s.srv.Namespaces()); i <= int(highest); i++ {
+		ns := &namespace{sim: s, name: namespaceURI(uint16(i))}
+		if got := s.srv.AddNamespace(ns); got != i {
+			return fmt.Errorf("simulator: namespace %d registered as %d", i, got)
+		}
+		if objects := ns.Objects(); objects != nil {
+			root.Objects().AddRef(objects, id.HasComponent, true)
+		}
+	}
+	return nil
+}
+
+// set skriver en modellverdi til noden med nodens datatype. Kalles med s.mu låst.
+func (s *Simulator) set(n *node, value float64) bool {
+	if n == nil {
+		return false
+	}
+	if n.typ != ua.TypeIDFloat && n.typ != ua.TypeIDDouble {
+		value = math.Round(value)
+	}
+	v, err := opcua.Coerce(value, n.typ)
+	if err != nil || v == n.value {
+		return false
+	}
+	n.value, n.updated = v, time.Now()
+	return true
+}
+
+// serverLogger sender gopcua-serverens logg til zerolog, ett nivå ned:
+// serveren logger hver Read på debug og hver ny forbindelse på info.
+type serverLogger struct {
+	log zerolog.Logger
+}
+
+func (l serverLogger) Debug(msg string, args ...any) { l.log.Trace().Msgf(msg, args...) }
+func (l serverLogger) Info(msg string, args ...any)  { l.log.Debug().Msgf(msg, args...) }
+func (l serverLogger) Warn(msg string, args ...any)  { l.log.Warn().Msgf(msg, args...) }
+func (l serverLogger) Error(msg string, args ...any) {
+	// server.New laster ns=0 fra nodeset-filen, som har duplikate referansetyper
+	if strings.HasPrefix(msg, "Duplicate reference type") {
+		l.log.Trace().Msgf(msg, args...)
+		return
+	}
+	l.log.Error().Msgf(msg, args...)
+}
@@ -0,0 +1,384 @@
+package simulator_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MrBoggi/goTOV/internal/brew"
+	"github.com/MrBoggi/goTOV/internal/config"
+	"github.com/MrBoggi/goTOV/internal/fermentation"
+	"github.com/MrBoggi/goTOV/internal/opcua"
+	"github.com/MrBoggi/goTOV/internal/simulator"
+	"github.com/rs/zerolog"
+)
+
+const (
+	tankTemp    = "ns=4;s=MAIN.fbUA.fermenter1Temp"
+	tankCooling = "ns=4;s=MAIN.fbUA.fermenter1Kjoleventil"
+	tankHeater  = "ns=4;s=MAIN.fbUA.fermenter1Varmekappe"
+	pump        = "ns=4;s=MAIN.fbUA.glykolkjolerPumpe"
+	hltSetpoint = "ns=4;s=MAIN.fbUA.hltSetpoint"
+)
+
+// testbed er en simulator på en ledig loopback-port med en klient koblet til.
+type testbed struct {
+	sim    *simulator.Simulator
+	client *opcua.Client
+	tanks  *brew.Tanks
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// start kjører simulatoren med speed 0, så modellen bare går når testen
+// kaller Step, og venter til klienten har et abonnement.
+func start(t *testing.T) *testbed {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	lo, hi := 0.0, 100.0
+	tag := func(name, dataType, role string, writable bool) config.TagConfig {
+		return config.TagConfig{
+			Name:             name,
+			NodeID:           "ns=4;s=MAIN.fbUA." + name,
+			DataType:         dataType,
+			Role:             role,
+			Writable:         writable,
+			SamplingInterval: "50ms",
+		}
+	}
+	setpoint := tag("hltSetpoint", "real", "", true)
+	setpoint.Min, setpoint.Max = &lo, &hi
+	tags, err := opcua.NewTagMap([]config.TagConfig{
+		tag("fermenter1Temp", "real", config.RoleTemperature, false),
+		tag("fermenter1Kjoleventil", "bool", config.RoleValve, false),
+		// Varmekappen er INT på PLS-en: motoren skriver bool som 0/1
+		tag("fermenter1Varmekappe", "int", config.RoleHeater, false),
+		tag("glykolkjolerPumpe", "bool", config.RolePump, true),
+		setpoint,
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tanks := brew.NewTanks([]config.TankConfig{{
+		No:             1,
+		Name:           "Fermenter 1",
+		TemperatureTag: "fermenter1Temp",
+		CoolingTag:     "fermenter1Kjoleventil",
+		HeaterTag:      "fermenter1Varmekappe",
+	}}, tags.Resolve)
+
+	sim, err := simulator.New(config.SimulatorConfig{
+		Host:            "127.0.0.1",
+		Port:            freePort(t),
+		Speed:           0,
+		UpdateInterval:  "1s",
+		AmbientTemp:     20,
+		InitialTemp:     20,
+		GlycolTemp:      2,
+		OriginalGravity: 1.010, // ingen gjæringsvarme
+		FinalGravity:    1.010,
+	}, tags, tanks.List(), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sim.Close() })
+
+	var cfg config.OPCUAConfig
+	cfg.Endpoint = sim.Endpoint()
+	cfg.Auth = "anonymous"
+	cfg.Security.Policy, cfg.Security.Mode = "None", "None"
+	cfg.Reconnect.MinBackoff, cfg.Reconnect.MaxBackoff = "100ms", "1s"
+	client, err := opcua.NewClient(cfg, tags, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Klienten stoppes før simulatoren, ellers venter den på svar fra en
+	// server som ikke lenger behandler forespørsler
+	clientCtx, stopClient := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = client.Run(clientCtx)
+	}()
+	t.Cleanup(func() {
+		stopClient()
+		<-done
+	})
+
+	eventually(t, 10*time.Second, "client connected", func() bool {
+		return client.State() == opcua.StateConnected
+	})
+	return &testbed{sim: sim, client: client, tanks: tanks}
+}
+
+// forward legger abonnementsverdiene inn i tankene, som app-en gjør.
+func (tb *testbed) forward(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case u := <-tb.client.Updates:
+				tb.tanks.Update(u.Name, u.Value, u.Time)
+			}
+		}
+	}()
+}
+
+func (tb *testbed) float(t *testing.T, nodeID string) float64 {
+	t.Helper()
+	v, ok := tb.sim.Value(nodeID)
+	if !ok {
+		t.Fatalf("simulator has no node %s", nodeID)
+	}
+	f, ok := brew.ToFloat(v)
+	if !ok {
+		t.Fatalf("%s = %v (%T), want a number", nodeID, v, v)
+	}
+	return f
+}
+
+// on tolker en ventil eller varmekappe som simulatoren gjør: bool, eller tall ≠ 0.
+func (tb *testbed) on(t *testing.T, nodeID string) bool {
+	t.Helper()
+	if v, ok := tb.sim.Value(nodeID); ok {
+		if b, ok := v.(bool); ok {
+			return b
+		}
+	}
+	return tb.float(t, nodeID) != 0
+}
+
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscriptionDeliversUpdates(t *testing.T) {
+	tb := start(t)
+
+	if err := tb.sim.Set(tankTemp, 21.5); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case u := <-tb.client.Updates:
+			if u.Name != tankTemp {
+				continue
+			}
+			if f, ok := brew.ToFloat(u.Value); !ok || f != 21.5 {
+				continue // startverdien kan komme først
+			}
+			if u.DisplayName != "fermenter1Temp" || u.Role != config.RoleTemperature || u.Time.IsZero() {
+				t.Errorf("update = %+v, want tag name, role and time", u)
+			}
+			if v, ok := tb.client.LastValue(tankTemp); !ok || v != u.Value {
+				t.Errorf("LastValue = %v, want %v", v, u.Value)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no update for the tank temperature")
+		}
+	}
+}
+
+func TestWriteTagReachesSimulator(t *testing.T) {
+	tb := start(t)
+	ctx := context.Background()
+
+	res, err := tb.client.WriteTag(ctx, "glykolkjolerPumpe", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != true {
+		t.Errorf("written value = %v (%T), want true", res.Value, res.Value)
+	}
+	if v, _ := tb.sim.Value(pump); v != true {
+		t.Errorf("pump = %v, want true", v)
+	}
+
+	if _, err := tb.client.WriteTag(ctx, "hltSetpoint", 66.5); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := tb.sim.Value(hltSetpoint); v != float32(66.5) {
+		t.Errorf("setpoint = %v (%T), want float32 66.5", v, v)
+	}
+
+	if _, err := tb.client.WriteTag(ctx, "hltSetpoint", 120); !errors.Is(err, opcua.ErrOutOfRange) {
+		t.Errorf("write above max = %v, want ErrOutOfRange", err)
+	}
+	if _, err := tb.client.WriteTag(ctx, "fermenter1Temp", 5); !errors.Is(err, opcua.ErrNotWritable) {
+		t.Errorf("write to read-only tag = %v, want ErrNotWritable", err)
+	}
+	if v, _ := tb.sim.Value(hltSetpoint); v != float32(66.5) {
+		t.Errorf("rejected write changed setpoint to %v", v)
+	}
+}
+
+func TestWriteTagsReachesSimulator(t *testing.T) {
+	tb := start(t)
+	ctx := context.Background()
+
+	results, err := tb.client.WriteTags(ctx, []opcua.TagWrite{
+		{Tag: "glykolkjolerPumpe", Value: "on"},
+		{Tag: "hltSetpoint", Value: 72},
+	})
+	if err != nil {
+		t.Fatalf("WriteTags: %v (%+v)", err, results)
+	}
+	for _, r := range results {
+		if r.Status != "ok" {
+			t.Errorf("%s: status %q, want ok", r.Tag, r.Status)
+		}
+	}
+	if v, _ := tb.sim.Value(pump); v != true {
+		t.Errorf("pump = %v, want true", v)
+	}
+	if v, _ := tb.sim.Value(hltSetpoint); v != float32(72) {
+		t.Errorf("setpoint = %v, want 72", v)
+	}
+
+	// Én avvist verdi: ingenting skrives
+	results, err = tb.client.WriteTags(ctx, []opcua.TagWrite{
+		{Tag: "glykolkjolerPumpe", Value: false},
+		{Tag: "hltSetpoint", Value: "hot"},
+	})
+	if !errors.Is(err, opcua.ErrInvalidValue) {
+		t.Fatalf("WriteTags with bad value = %v, want ErrInvalidValue", err)
+	}
+	if results[0].Status != "skipped" || results[1].Status != "rejected" {
+		t.Errorf("statuses = %q/%q, want skipped/rejected", results[0].Status, results[1].Status)
+	}
+	if v, _ := tb.sim.Value(pump); v != true {
+		t.Errorf("pump = %v after rejected batch, want it unchanged", v)
+	}
+}
+
+// TestEngineHoldsEachStep kjører motoren mot termomodellen: for hvert steg
+// skal tanken nå hysteresebåndet rundt target og holde seg der.
+func TestEngineHoldsEachStep(t *testing.T) {
+	tb := start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tb.forward(ctx)
+
+	store, err := fermentation.NewSQLiteStore(filepath.Join(t.TempDir(), "fermentation.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	plan := fermentation.FermentationPlan{Name: "Sim", Steps: []fermentation.FermentationStep{
+		{StepNumber: 1, Temperature: 12, DurationHours: 240},
+		{StepNumber: 2, Temperature: 19, DurationHours: 240},
+		{StepNumber: 3, Temperature: 8, DurationHours: 240},
+	}}
+	planID, err := store.SavePlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg config.FermentationConfig
+	const hyst = 0.5
+	cfg.Hysteresis.Cooling, cfg.Hysteresis.Heating = hyst, hyst
+	cfg.StepCheckInterval, cfg.StabilizationTime, cfg.StatePersistInterval = "20ms", "0s", "1m"
+	engine, err := fermentation.NewEngine(zerolog.Nop(), tb.client, store, tb.tanks, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = engine.Run(ctx) }()
+
+	eventually(t, 10*time.Second, "tank temperature from subscription", func() bool {
+		tank, _ := tb.tanks.Get(1)
+		return tank.Temperature != nil
+	})
+	if _, err := engine.Start(planID, 1, "sim", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// settle venter til motoren har regulert på simulatorens nåværende
+	// temperatur, så modellen aldri går videre med utdaterte utganger.
+	settle := func() {
+		want := tb.float(t, tankTemp)
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if st := engine.Active(); len(st) == 1 && st[0].ActualTemp != nil && math.Abs(*st[0].ActualTemp-want) < 0.005 {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	for i, step := range plan.Steps {
+		if i > 0 {
+			if _, err := engine.Skip(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		target := step.Temperature
+		// Utgangene slår først om når båndet er passert, så tanken kan drive
+		// ett modellsteg (noen hundredeler) utenfor før motoren svarer
+		inBand := func(temp float64) bool { return temp >= target-hyst-0.1 && temp <= target+hyst+0.1 }
+
+		// Opptil 12 simulerte timer på å nå båndet
+		reached := false
+		for range 12 * 12 {
+			settle()
+			temp := tb.float(t, tankTemp)
+			if inBand(temp) {
+				reached = true
+				break
+			}
+			cooling, heating := tb.on(t, tankCooling), tb.on(t, tankHeater)
+			if temp > target+hyst && (!cooling || heating) {
+				t.Fatalf("step %d: %.2f °C above %g but cooling=%v heating=%v", i+1, temp, target, cooling, heating)
+			}
+			if temp < target-hyst && (cooling || !heating) {
+				t.Fatalf("step %d: %.2f °C below %g but cooling=%v heating=%v", i+1, temp, target, cooling, heating)
+			}
+			tb.sim.Step(5 * time.Minute)
+		}
+		if !reached {
+			t.Fatalf("step %d: tank at %.2f °C never reached %g ± %g", i+1, tb.float(t, tankTemp), target, hyst)
+		}
+
+		// … og holder seg der i to simulerte timer
+		for range 2 * 12 {
+			tb.sim.Step(5 * time.Minute)
+			settle()
+			if temp := tb.float(t, tankTemp); !inBand(temp) {
+				t.Fatalf("step %d: tank left the band at %.2f °C (target %g)", i+1, temp, target)
+			}
+		}
+	}
+
+	if err := engine.Abort(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if tb.on(t, tankCooling) || tb.on(t, tankHeater) {
+		t.Error("outputs should be off after abort")
+	}
+}